@@ -0,0 +1,113 @@
+package entropy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+)
+
+// Results of assessing a dataset with every estimator
+type Report struct {
+	BitsPerSample    int
+	Samples          int
+	IID              []IIDResult // Permutation test results, empty if they were not run
+	Estimates        []Estimate  // Estimates over the samples
+	BitEstimates     []Estimate  // Estimates over the samples' bits, when samples are wider than one bit
+	NonIIDEntropy    float64     // Min-entropy per sample assuming the data is not IID
+	MinEntropy       float64     // Final min-entropy per sample
+	MinEntropyPerBit float64
+}
+
+// Splits [bs] into samples of [bitsPerSample] bits, discarding any extra bits at the end
+func SamplesFromBitString(bs *bitstring.BitString, bitsPerSample int) []int {
+	parts := bs.Partition(bitsPerSample)
+	s := make([]int, len(parts))
+	for i, p := range parts {
+		s[i] = p.Int()
+	}
+	return s
+}
+
+// Runs every estimator applicable to [s], a dataset over an alphabet of size [k]
+func NonIID(s []int, k int) []Estimate {
+	tuples := countTuples(s)
+	estimates := []Estimate{MostCommonValue(s, k)}
+	if k == 2 {
+		estimates = append(estimates, Collision(s), Markov(s), Compression(s))
+	}
+	return append(estimates, tTuple(s, tuples), lrs(s, tuples), MultiMCW(s, k), Lag(s, k), MultiMMC(s, k),
+		LZ78Y(s, k))
+}
+
+// The lowest applicable estimate in [estimates]
+func minEstimate(estimates []Estimate) float64 {
+	h := math.Inf(1)
+	for _, e := range estimates {
+		if e.Applicable {
+			h = math.Min(h, e.MinEntropy)
+		}
+	}
+	return h
+}
+
+// Estimates the min-entropy of [bs] as a sequence of [bitsPerSample] bit samples, following SP 800-90B section 3.1.
+// The IID permutation tests are run with [permutations] shuffles, DefaultPermutations if it is 0, or skipped if it is
+// negative. If the data passes them only the most common value estimate is used
+func Assess(bs *bitstring.BitString, bitsPerSample, permutations int, seed int64) *Report {
+	s := SamplesFromBitString(bs, bitsPerSample)
+	k := 1 << uint(bitsPerSample)
+	r := &Report{BitsPerSample: bitsPerSample, Samples: len(s)}
+
+	// Non-IID track, also estimating over the bits when samples are wider than one bit
+	r.Estimates = NonIID(s, k)
+	r.NonIIDEntropy = minEstimate(r.Estimates)
+	var bits []int
+	if bitsPerSample > 1 {
+		bits = SamplesFromBitString(bs.Substring(0, len(s)*bitsPerSample), 1)
+		r.BitEstimates = NonIID(bits, 2)
+		r.NonIIDEntropy = math.Min(r.NonIIDEntropy, float64(bitsPerSample)*minEstimate(r.BitEstimates))
+	}
+	r.MinEntropy = r.NonIIDEntropy
+
+	// IID track
+	if permutations >= 0 {
+		r.IID = PermutationTests(s, permutations, seed)
+		if IsIID(r.IID) {
+			r.MinEntropy = r.Estimates[0].MinEntropy
+			if bits != nil {
+				r.MinEntropy = math.Min(r.MinEntropy, float64(bitsPerSample)*MostCommonValue(bits, 2).MinEntropy)
+			}
+		}
+	}
+
+	r.MinEntropy = math.Min(r.MinEntropy, float64(bitsPerSample))
+	r.MinEntropyPerBit = r.MinEntropy / float64(bitsPerSample)
+	return r
+}
+
+func (r *Report) String() string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "Samples: %d of %d bits\n", r.Samples, r.BitsPerSample)
+	if len(r.IID) > 0 {
+		fmt.Fprintln(b, "\nIID permutation tests")
+		for _, res := range r.IID {
+			fmt.Fprintf(b, "\t%s\n", res)
+		}
+	}
+	fmt.Fprintln(b, "\nNon-IID estimates")
+	for _, e := range r.Estimates {
+		fmt.Fprintf(b, "\t%s\n", e)
+	}
+	if len(r.BitEstimates) > 0 {
+		fmt.Fprintln(b, "\nNon-IID estimates over bits")
+		for _, e := range r.BitEstimates {
+			fmt.Fprintf(b, "\t%s\n", e)
+		}
+	}
+	if len(r.IID) > 0 {
+		fmt.Fprintf(b, "\nData is IID: %t\n", IsIID(r.IID))
+	}
+	fmt.Fprintf(b, "Min-entropy: %.6f bits per sample (%.6f per bit)\n", r.MinEntropy, r.MinEntropyPerBit)
+	return b.String()
+}
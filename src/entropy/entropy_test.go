@@ -0,0 +1,151 @@
+package entropy
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Generates [n] samples uniformly distributed over [0, k)
+func uniform(n, k int, seed int64) []int {
+	rng := rand.New(rand.NewSource(seed))
+	s := make([]int, n)
+	for i := range s {
+		s[i] = rng.Intn(k)
+	}
+	return s
+}
+
+// Generates [n] binary samples which repeat the previous sample with probability [p]
+func sticky(n int, p float64, seed int64) []int {
+	rng := rand.New(rand.NewSource(seed))
+	s := make([]int, n)
+	for i := 1; i < n; i++ {
+		s[i] = s[i-1]
+		if rng.Float64() >= p {
+			s[i] = 1 - s[i]
+		}
+	}
+	return s
+}
+
+func TestCountTuples(t *testing.T) {
+	s := uniform(2000, 3, 1)
+	c := countTuples(s)
+	for w := 1; w < 12; w++ {
+		// Count tuples naively
+		counts := make(map[string]int)
+		for i := 0; i+w <= len(s); i++ {
+			counts[contextKey(s, i, i+w)]++
+		}
+		max, pairs := 1, 0.0
+		for _, n := range counts {
+			if n > max {
+				max = n
+			}
+			pairs += float64(n*(n-1)) / 2
+		}
+		if w < len(c.maxCount) && c.maxCount[w] != max {
+			t.Errorf("countTuples maxCount[%d] == %d, wanted %d", w, c.maxCount[w], max)
+		}
+		if got := 0.0; w < len(c.pairs) {
+			got = c.pairs[w]
+			if got != pairs {
+				t.Errorf("countTuples pairs[%d] == %g, wanted %g", w, got, pairs)
+			}
+		} else if pairs != 0 {
+			t.Errorf("countTuples found no repeated %d-tuples, wanted %g pairs", w, pairs)
+		}
+	}
+}
+
+func TestMostCommonValue(t *testing.T) {
+	s := make([]int, 1000)
+	for i := 600; i < 1000; i++ {
+		s[i] = 1
+	}
+	got := MostCommonValue(s, 2)
+	if math.Abs(got.P-0.639926) > 2e-6 {
+		t.Errorf("MostCommonValue == %f, wanted 0.639926", got.P)
+	}
+}
+
+func TestEstimatorsRandom(t *testing.T) {
+	s := uniform(100000, 2, 2)
+	for _, e := range NonIID(s, 2) {
+		if !e.Applicable || e.MinEntropy < 0.7 {
+			t.Errorf("%s estimated %f bits of min-entropy per random bit", e.Name, e.MinEntropy)
+		}
+	}
+	bytes := uniform(100000, 256, 3)
+	for _, e := range NonIID(bytes, 256) {
+		if !e.Applicable || e.MinEntropy < 6 {
+			t.Errorf("%s estimated %f bits of min-entropy per random byte", e.Name, e.MinEntropy)
+		}
+	}
+}
+
+func TestEstimatorsConstant(t *testing.T) {
+	s := make([]int, 10000)
+	for _, e := range NonIID(s, 2) {
+		if e.Applicable && e.MinEntropy > 0.01 {
+			t.Errorf("%s estimated %f bits of min-entropy per constant bit", e.Name, e.MinEntropy)
+		}
+	}
+}
+
+func TestEstimatorsCorrelated(t *testing.T) {
+	// The most common value sees a balanced source, but the predictors and Markov estimate should not
+	s := sticky(100000, 0.9, 4)
+	if h := MostCommonValue(s, 2).MinEntropy; h < 0.9 {
+		t.Errorf("MostCommonValue estimated %f bits of min-entropy on a balanced source", h)
+	}
+	for _, e := range []Estimate{Markov(s), Lag(s, 2), MultiMMC(s, 2)} {
+		if e.MinEntropy > 0.25 {
+			t.Errorf("%s estimated %f bits of min-entropy on a correlated source", e.Name, e.MinEntropy)
+		}
+	}
+}
+
+func TestLZ78Y(t *testing.T) {
+	// A context is added with its first continuation counted, so once the contexts before the 17th sample are added,
+	// every prediction of an alternating sequence is right
+	s := make([]int, 40)
+	for i := range s {
+		s[i] = i % 2
+	}
+	if score := lz78yPredict(s); score.n != 23 || score.correct != 22 {
+		t.Errorf("LZ78Y predicted %d of %d samples correctly, want 22 of 23", score.correct, score.n)
+	}
+}
+
+func TestPermutationTests(t *testing.T) {
+	if results := PermutationTests(uniform(8000, 2, 5), 2000, 1); !IsIID(results) {
+		t.Errorf("PermutationTests rejected IID data: %v", results)
+	}
+	s := uniform(5000, 256, 6)
+	sort.Ints(s[:2500])
+	if IsIID(PermutationTests(s, 200, 1)) {
+		t.Error("PermutationTests accepted partially sorted data")
+	}
+}
+
+func TestAssess(t *testing.T) {
+	r := Assess(bitstringOf(uniform(64000, 2, 7)), 8, -1, 0)
+	if r.Samples != 8000 || len(r.BitEstimates) == 0 {
+		t.Errorf("Assess did not estimate over both samples and bits")
+	}
+	if r.MinEntropyPerBit < 0.7 || r.MinEntropy > 8 {
+		t.Errorf("Assess estimated %f bits of min-entropy per random byte", r.MinEntropy)
+	}
+}
+
+func bitstringOf(s []int) *bitstring.BitString {
+	bs := bitstring.BitStringOfLength(len(s))
+	for i, v := range s {
+		bs.Data[i] = v == 1
+	}
+	return bs
+}
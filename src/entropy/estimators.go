@@ -0,0 +1,279 @@
+/* Implements the min-entropy estimators for non-IID sources described in section 6.3 of
+ * https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-90B.pdf
+ *
+ * Samples are represented as ints in [0, k), where k is the size of the source's alphabet. The collision, Markov
+ * and compression estimators only apply to binary sources (k = 2).
+ */
+
+package entropy
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	zAlpha             = 2.576 // Z score for the 99% confidence intervals used throughout SP 800-90B
+	compressionBlock   = 6     // Bits per symbol used by the compression estimator
+	compressionDictLen = 1000  // Number of symbols used to initialise the compression estimator's dictionary
+)
+
+// The result of a single min-entropy estimator
+type Estimate struct {
+	Name       string
+	P          float64 // Upper bound on the probability of the most likely sample (or its per-bit equivalent)
+	MinEntropy float64 // Min-entropy per sample in bits
+	Applicable bool    // False if the dataset was too small or of the wrong kind for this estimator
+}
+
+func (e Estimate) String() string {
+	if !e.Applicable {
+		return fmt.Sprintf("%s: not applicable", e.Name)
+	}
+	return fmt.Sprintf("%s: p = %.6f, min-entropy = %.6f", e.Name, e.P, e.MinEntropy)
+}
+
+// Builds an estimate from an upper bound [p] on the probability of the most likely sample
+func estimate(name string, p float64) Estimate {
+	return Estimate{name, p, -math.Log2(p), true}
+}
+
+func notApplicable(name string) Estimate {
+	return Estimate{Name: name}
+}
+
+// Upper bound of the 99% confidence interval on a proportion [p] estimated from [n] observations
+func upperBound(p float64, n int) float64 {
+	return math.Min(1, p+zAlpha*math.Sqrt(p*(1-p)/float64(n-1)))
+}
+
+// Checks every sample is binary
+func isBinary(s []int) bool {
+	for _, v := range s {
+		if v != 0 && v != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Finds [x] in [lo, hi] such that f(x) = target for a monotone function f, by binary search
+func solve(f func(float64) float64, target, lo, hi float64, increasing bool) float64 {
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if (f(mid) < target) == increasing {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// Most common value estimate (6.3.1)
+func MostCommonValue(s []int, k int) Estimate {
+	const name = "Most Common Value"
+	if len(s) < 2 {
+		return notApplicable(name)
+	}
+	counts := make([]int, k)
+	max := 0
+	for _, v := range s {
+		counts[v]++
+		if counts[v] > max {
+			max = counts[v]
+		}
+	}
+	return estimate(name, upperBound(float64(max)/float64(len(s)), len(s)))
+}
+
+// Collision estimate (6.3.2), for binary sources
+func Collision(s []int) Estimate {
+	const name = "Collision"
+	if !isBinary(s) {
+		return notApplicable(name)
+	}
+
+	// Record the number of samples until the first repeated value, which for binary data is always 2 or 3
+	var t []float64
+	for i := 0; i < len(s)-1; {
+		if s[i] == s[i+1] {
+			t = append(t, 2)
+			i += 2
+		} else if i < len(s)-2 {
+			t = append(t, 3)
+			i += 3
+		} else {
+			break
+		}
+	}
+	v := len(t)
+	if v < 2 {
+		return notApplicable(name)
+	}
+
+	// Lower bound on the mean collision time
+	mean, sd := meanStdDev(t)
+	lower := mean - zAlpha*sd/math.Sqrt(float64(v))
+
+	// For a binary source with P(1) = p the expected collision time is 2 + 2p(1-p). Solve for p >= 1/2
+	pq := (lower - 2) / 2
+	p := 1.0
+	if pq >= 0.25 {
+		p = 0.5
+	} else if pq > 0 {
+		p = (1 + math.Sqrt(1-4*pq)) / 2
+	}
+	return estimate(name, p)
+}
+
+// Markov estimate (6.3.3), for binary sources. Bounds the probability of the most likely 128 bit sequence under a
+// first-order Markov model of the source
+func Markov(s []int) Estimate {
+	const name = "Markov"
+	const length = 128
+	if !isBinary(s) || len(s) < 2 {
+		return notApplicable(name)
+	}
+
+	// Initial and transition probabilities
+	var c [2]float64
+	var ct [2][2]float64
+	for i, v := range s {
+		c[v]++
+		if i < len(s)-1 {
+			ct[v][s[i+1]]++
+		}
+	}
+	p0, p1 := c[0]/float64(len(s)), c[1]/float64(len(s))
+	var t [2][2]float64
+	for a := 0; a < 2; a++ {
+		if total := ct[a][0] + ct[a][1]; total > 0 {
+			t[a][0], t[a][1] = ct[a][0]/total, ct[a][1]/total
+		}
+	}
+
+	// Log probabilities of the candidates for the most likely sequence
+	lg := func(p float64, n int) float64 {
+		if n == 0 {
+			return 0
+		}
+		return float64(n) * math.Log2(p)
+	}
+	candidates := []float64{
+		math.Log2(p0) + lg(t[0][0], length-1),
+		math.Log2(p0) + lg(t[0][1], length/2) + lg(t[1][0], length/2-1),
+		math.Log2(p0) + lg(t[0][1], 1) + lg(t[1][1], length-2),
+		math.Log2(p1) + lg(t[1][0], 1) + lg(t[0][0], length-2),
+		math.Log2(p1) + lg(t[1][0], length/2) + lg(t[0][1], length/2-1),
+		math.Log2(p1) + lg(t[1][1], length-1),
+	}
+	max := math.Inf(-1)
+	for _, lp := range candidates {
+		if !math.IsNaN(lp) && lp > max {
+			max = lp
+		}
+	}
+
+	h := math.Min(-max/length, 1)
+	return Estimate{name, math.Pow(2, -h), h, true}
+}
+
+// Compression estimate (6.3.4), for binary sources. Based on Maurer's universal statistic over 6 bit symbols
+func Compression(s []int) Estimate {
+	const name = "Compression"
+	b := compressionBlock
+	d := compressionDictLen
+	n := len(s) / b
+	v := n - d
+	if !isBinary(s) || v < 2 {
+		return notApplicable(name)
+	}
+
+	// Pack the bits into b bit symbols
+	symbols := make([]int, n)
+	for i := range symbols {
+		for j := 0; j < b; j++ {
+			symbols[i] = symbols[i]<<1 | s[i*b+j]
+		}
+	}
+
+	// Build the dictionary from the first d symbols, then record the distance to each symbol's last occurrence
+	last := make([]int, 1<<uint(b))
+	for i := 1; i <= d; i++ {
+		last[symbols[i-1]] = i
+	}
+	logs := make([]float64, 0, v)
+	for i := d + 1; i <= n; i++ {
+		a := i
+		if last[symbols[i-1]] != 0 {
+			a = i - last[symbols[i-1]]
+		}
+		last[symbols[i-1]] = i
+		logs = append(logs, math.Log2(float64(a)))
+	}
+
+	// Lower bound on the mean, with the correction factor for the standard deviation
+	mean, _ := meanStdDev(logs)
+	sumSq := 0.0
+	for _, l := range logs {
+		sumSq += l * l
+	}
+	sd := 0.5907 * math.Sqrt(math.Max(0, sumSq/float64(v-1)-mean*mean))
+	lower := mean - zAlpha*sd/math.Sqrt(float64(v))
+
+	// Solve G(p) + (2^b - 1) G(q) = lower for the most likely symbol probability p
+	k := float64(int(1) << uint(b))
+	f := func(p float64) float64 {
+		q := (1 - p) / (k - 1)
+		return compressionG(p, n, d) + (k-1)*compressionG(q, n, d)
+	}
+	pMin := 1 / k
+	if f(pMin) < lower {
+		// No solution, the data appears ideally random
+		return Estimate{name, pMin, 1, true}
+	}
+	p := solve(f, lower, pMin, 1, false)
+	h := -math.Log2(p) / float64(b)
+	return Estimate{name, math.Pow(2, -h), h, true}
+}
+
+// The G function of the compression estimate: the expected mean of log2 of the distance between repeated symbols
+// when a symbol occurs with probability z. Evaluated in O(n) by summing over each distance u once
+func compressionG(z float64, n, d int) float64 {
+	v := float64(n - d)
+	sum := 0.0
+	pow := 1.0 // (1-z)^(u-1)
+	for u := 1; u <= n; u++ {
+		lu := math.Log2(float64(u))
+		// Terms where the distance u is shorter than the position t
+		count := n - u
+		if u <= d {
+			count = n - d
+		}
+		sum += lu * z * z * pow * float64(count)
+		// The term where u == t, when the symbol has not been seen before
+		if u > d {
+			sum += lu * z * pow
+		}
+		pow *= 1 - z
+		if pow == 0 {
+			break
+		}
+	}
+	return sum / v
+}
+
+// Computes the mean and sample standard deviation of [xs]
+func meanStdDev(xs []float64) (float64, float64) {
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
@@ -0,0 +1,325 @@
+package entropy
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const DefaultPermutations = 10000 // Number of shuffles used by SP 800-90B's permutation tests
+
+// Compressors are expensive to allocate, so they are shared between permutations
+var flateWriters = sync.Pool{New: func() interface{} {
+	w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return w
+}}
+
+var permutationLags = []int{1, 2, 8, 16, 32} // Lags used by the periodicity and covariance tests
+
+// Result of one permutation test statistic
+type IIDResult struct {
+	Name      string
+	Statistic float64 // Value of the statistic on the original data
+	Greater   int     // Number of shuffles giving a greater value
+	Equal     int     // Number of shuffles giving an equal value
+	Pass      bool
+}
+
+func (r IIDResult) String() string {
+	status := "PASSED"
+	if !r.Pass {
+		status = "FAILED"
+	}
+	return fmt.Sprintf("%s: %g (C0 = %d, C1 = %d) %s", r.Name, r.Statistic, r.Greater, r.Equal, status)
+}
+
+// A named test statistic over a dataset
+type permutationStatistic struct {
+	name string
+	f    func(d *iidData) float64
+}
+
+// A dataset along with the derived forms used by the permutation tests on binary data
+type iidData struct {
+	s      []int
+	median float64
+	hw     []int // Hamming weights of 8 bit blocks (binary data), or the data itself
+	bytes  []int // 8 bit blocks (binary data), or the data itself
+}
+
+func newIIDData(s []int, binary bool) *iidData {
+	d := &iidData{s: s, hw: s, bytes: s}
+	if binary {
+		d.hw = make([]int, len(s)/8)
+		d.bytes = make([]int, len(s)/8)
+		for i := range d.hw {
+			for _, b := range s[i*8 : (i+1)*8] {
+				d.hw[i] += b
+				d.bytes[i] = d.bytes[i]<<1 | b
+			}
+		}
+	}
+	return d
+}
+
+// Builds the list of statistics of section 5.1
+func permutationStatistics() []permutationStatistic {
+	stats := []permutationStatistic{
+		{"Excursion", excursion},
+		{"Number of Directional Runs", func(d *iidData) float64 { n, _ := directionalRuns(d.hw); return n }},
+		{"Length of Directional Runs", func(d *iidData) float64 { _, l := directionalRuns(d.hw); return l }},
+		{"Numbers of Increases and Decreases", func(d *iidData) float64 { return increasesDecreases(d.hw) }},
+		{"Number of Runs Based on the Median", func(d *iidData) float64 { n, _ := medianRuns(d); return n }},
+		{"Length of Runs Based on the Median", func(d *iidData) float64 { _, l := medianRuns(d); return l }},
+		{"Average Collision", func(d *iidData) float64 { a, _ := collisions(d.bytes); return a }},
+		{"Maximum Collision", func(d *iidData) float64 { _, m := collisions(d.bytes); return m }},
+	}
+	for _, p := range permutationLags {
+		p := p
+		stats = append(stats, permutationStatistic{fmt.Sprintf("Periodicity (lag %d)", p),
+			func(d *iidData) float64 { return periodicity(d.bytes, p) }})
+	}
+	for _, p := range permutationLags {
+		p := p
+		stats = append(stats, permutationStatistic{fmt.Sprintf("Covariance (lag %d)", p),
+			func(d *iidData) float64 { return covariance(d.bytes, p) }})
+	}
+	return append(stats, permutationStatistic{"Compression", compressedLength})
+}
+
+// Runs the permutation tests of section 5.1 over [s], shuffling it [permutations] times using a PRNG seeded with
+// [seed], or DefaultPermutations times if it is 0. The data is considered IID only if every test passes
+func PermutationTests(s []int, permutations int, seed int64) []IIDResult {
+	if permutations < 0 {
+		panic("PermutationTests: number of permutations must not be negative")
+	}
+	if permutations == 0 {
+		permutations = DefaultPermutations
+	}
+	binary := isBinary(s)
+	stats := permutationStatistics()
+	original := newIIDData(s, binary)
+	original.median = median(s)
+	if binary {
+		original.median = 0.5
+	}
+
+	results := make([]IIDResult, len(stats))
+	for i, stat := range stats {
+		results[i] = IIDResult{Name: stat.name, Statistic: stat.f(original)}
+	}
+
+	// Shuffle in parallel, each worker with its own copy of the data and PRNG
+	workers := runtime.NumCPU()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(w)))
+			shuffled := make([]int, len(s))
+			copy(shuffled, s)
+			greater := make([]int, len(stats))
+			equal := make([]int, len(stats))
+			for n := w; n < permutations; n += workers {
+				rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				d := newIIDData(shuffled, binary)
+				d.median = original.median
+				for i, stat := range stats {
+					switch v := stat.f(d); {
+					case v > results[i].Statistic:
+						greater[i]++
+					case v == results[i].Statistic:
+						equal[i]++
+					}
+				}
+			}
+			mu.Lock()
+			for i := range results {
+				results[i].Greater += greater[i]
+				results[i].Equal += equal[i]
+			}
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+
+	// The original should rank neither among the very highest nor the very lowest values
+	tail := 0.0005 * float64(permutations)
+	for i := range results {
+		r := &results[i]
+		r.Pass = float64(r.Greater+r.Equal) > tail && float64(r.Greater) < float64(permutations)-tail
+	}
+	return results
+}
+
+// Reports whether every permutation test passed
+func IsIID(results []IIDResult) bool {
+	for _, r := range results {
+		if !r.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+func median(s []int) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	sorted := make([]int, len(s))
+	copy(sorted, s)
+	sort.Ints(sorted)
+	if len(sorted)%2 == 1 {
+		return float64(sorted[len(sorted)/2])
+	}
+	return float64(sorted[len(sorted)/2-1]+sorted[len(sorted)/2]) / 2
+}
+
+// Excursion test statistic (5.1.1), the furthest the running sum strays from its expected value
+func excursion(d *iidData) float64 {
+	mean := 0.0
+	for _, v := range d.s {
+		mean += float64(v)
+	}
+	mean /= float64(len(d.s))
+	sum, max := 0.0, 0.0
+	for _, v := range d.s {
+		sum += float64(v) - mean
+		max = math.Max(max, math.Abs(sum))
+	}
+	return max
+}
+
+// Directional runs test statistics (5.1.2, 5.1.3), the number and longest length of runs of increases or decreases
+func directionalRuns(s []int) (float64, float64) {
+	if len(s) < 2 {
+		return 0, 0
+	}
+	runs, longest, current := 1, 1, 1
+	prev := s[0] <= s[1]
+	for i := 1; i < len(s)-1; i++ {
+		up := s[i] <= s[i+1]
+		if up == prev {
+			current++
+		} else {
+			runs++
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+		prev = up
+	}
+	return float64(runs), float64(longest)
+}
+
+// Increases and decreases test statistic (5.1.4)
+func increasesDecreases(s []int) float64 {
+	up := 0
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] <= s[i+1] {
+			up++
+		}
+	}
+	return math.Max(float64(up), float64(len(s)-1-up))
+}
+
+// Runs based on the median test statistics (5.1.5, 5.1.6)
+func medianRuns(d *iidData) (float64, float64) {
+	if len(d.s) == 0 {
+		return 0, 0
+	}
+	runs, longest, current := 1, 1, 1
+	prev := float64(d.s[0]) >= d.median
+	for _, v := range d.s[1:] {
+		above := float64(v) >= d.median
+		if above == prev {
+			current++
+		} else {
+			runs++
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+		prev = above
+	}
+	return float64(runs), float64(longest)
+}
+
+// Collision test statistics (5.1.7, 5.1.8), the average and maximum number of samples read until a repeat
+func collisions(s []int) (float64, float64) {
+	top := 0
+	for _, v := range s {
+		if v > top {
+			top = v
+		}
+	}
+	seen := make([]int, top+1)
+	var sum, count, max int
+	for i, start := 0, 0; i < len(s); i++ {
+		if seen[s[i]] == start+1 {
+			// Collision found, start looking again after it
+			length := i - start + 1
+			sum += length
+			count++
+			if length > max {
+				max = length
+			}
+			start = i + 1
+			continue
+		}
+		seen[s[i]] = start + 1
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(count), float64(max)
+}
+
+// Periodicity test statistic (5.1.9), the number of samples equal to the sample [p] positions later
+func periodicity(s []int, p int) float64 {
+	t := 0
+	for i := 0; i < len(s)-p; i++ {
+		if s[i] == s[i+p] {
+			t++
+		}
+	}
+	return float64(t)
+}
+
+// Covariance test statistic (5.1.10)
+func covariance(s []int, p int) float64 {
+	t := 0
+	for i := 0; i < len(s)-p; i++ {
+		t += s[i] * s[i+p]
+	}
+	return float64(t)
+}
+
+// Compression test statistic (5.1.11), the compressed length of the data encoded as decimal text. DEFLATE is used
+// in place of bzip2, which has no compressor in the standard library
+func compressedLength(d *iidData) float64 {
+	var text bytes.Buffer
+	for i, v := range d.s {
+		if i > 0 {
+			text.WriteByte(' ')
+		}
+		text.WriteString(strconv.Itoa(v))
+	}
+	var out bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&out)
+	w.Write(text.Bytes())
+	w.Close()
+	flateWriters.Put(w)
+	return float64(out.Len())
+}
@@ -0,0 +1,281 @@
+package entropy
+
+import (
+	"math"
+)
+
+const (
+	noPrediction       = -1
+	mmcMaxOrder        = 16     // Number of Markov models used by the MultiMMC predictor
+	mmcMaxEntries      = 100000 // Maximum number of contexts stored by each MultiMMC model
+	lagDepth           = 128    // Number of lags used by the Lag predictor
+	lz78yMaxString     = 16     // Longest context used by the LZ78Y predictor
+	lz78yMaxDictionary = 65536  // Maximum number of contexts stored by the LZ78Y predictor
+)
+
+// Window sizes of the MultiMCW predictor
+var mcwWindows = []int{63, 255, 1023, 4095}
+
+// Tracks the correctness of a predictor's predictions
+type predictionScore struct {
+	n       int // Number of predictions made
+	correct int
+	run     int // Current run of correct predictions
+	longest int // Longest run of correct predictions
+}
+
+func (s *predictionScore) add(prediction, actual int) {
+	s.n++
+	if prediction == actual {
+		s.correct++
+		s.run++
+		if s.run > s.longest {
+			s.longest = s.run
+		}
+	} else {
+		s.run = 0
+	}
+}
+
+// Converts a predictor's score to a min-entropy estimate using the larger of the global and local bounds on the
+// probability of a correct prediction (6.3.7 steps 9-11)
+func (s *predictionScore) estimate(name string, k int) Estimate {
+	n := float64(s.n)
+	if s.n < 2 {
+		return notApplicable(name)
+	}
+
+	// Global prediction accuracy
+	var pGlobal float64
+	if s.correct == 0 {
+		pGlobal = 1 - math.Pow(0.01, 1/n)
+	} else {
+		pGlobal = upperBound(float64(s.correct)/n, s.n)
+	}
+
+	// Local prediction accuracy, based on the longest run of correct predictions. Solves for p such that a run of
+	// length r is seen within n predictions with probability 0.01
+	r := float64(s.longest + 1)
+	f := func(p float64) float64 {
+		q := 1 - p
+		x := 1.0
+		for j := 0; j < 10; j++ {
+			x = 1 + q*math.Pow(p, r)*math.Pow(x, r+1)
+		}
+		v := math.Log(1-p*x) - math.Log((r+1-r*x)*q) - (n+1)*math.Log(x)
+		if math.IsNaN(v) {
+			// The iteration has diverged, which only happens for p well above the solution
+			return math.Inf(-1)
+		}
+		return v
+	}
+	pLocal := solve(f, math.Log(0.99), 0, 1, false)
+
+	return estimate(name, math.Max(math.Max(pGlobal, pLocal), 1/float64(k)))
+}
+
+// Selects the prediction of the subpredictor with the highest score, ties going to the later subpredictor
+func winner(scores []int) int {
+	w := 0
+	for i, s := range scores {
+		if s >= scores[w] {
+			w = i
+		}
+	}
+	return w
+}
+
+// Credits every subpredictor that predicted [actual]
+func updateScores(scores, predictions []int, actual int) {
+	for i, p := range predictions {
+		if p == actual {
+			scores[i]++
+		}
+	}
+}
+
+// Most common value over a sliding window, ties going to the most recently seen value
+type mcwWindow struct {
+	size   int
+	counts []int
+	last   []int // Position at which each value was last seen
+	best   int
+}
+
+func (w *mcwWindow) add(s []int, i int) {
+	v := s[i]
+	w.counts[v]++
+	w.last[v] = i
+	if w.counts[v] >= w.counts[w.best] {
+		w.best = v
+	}
+	if i < w.size {
+		return
+	}
+
+	// Remove the value leaving the window, rescanning if it was the most common
+	old := s[i-w.size]
+	w.counts[old]--
+	if old == w.best {
+		for c := range w.counts {
+			if w.counts[c] > w.counts[w.best] || (w.counts[c] == w.counts[w.best] && w.last[c] > w.last[w.best]) {
+				w.best = c
+			}
+		}
+	}
+}
+
+// MultiMCW prediction estimate (6.3.7), predicting the most common value over several window sizes
+func MultiMCW(s []int, k int) Estimate {
+	const name = "MultiMCW Prediction"
+	if len(s) == 0 {
+		return notApplicable(name)
+	}
+	windows := make([]*mcwWindow, len(mcwWindows))
+	for j, size := range mcwWindows {
+		windows[j] = &mcwWindow{size, make([]int, k), make([]int, k), s[0]}
+	}
+	scores := make([]int, len(windows))
+	predictions := make([]int, len(windows))
+	var score predictionScore
+
+	for i := 0; i < len(s); i++ {
+		if i >= mcwWindows[0] {
+			for j, w := range windows {
+				predictions[j] = noPrediction
+				if i >= w.size {
+					predictions[j] = w.best
+				}
+			}
+			score.add(predictions[winner(scores)], s[i])
+			updateScores(scores, predictions, s[i])
+		}
+		for _, w := range windows {
+			w.add(s, i)
+		}
+	}
+	return score.estimate(name, k)
+}
+
+// Lag prediction estimate (6.3.8), predicting the value seen d samples ago for each d up to 128
+func Lag(s []int, k int) Estimate {
+	const name = "Lag Prediction"
+	scores := make([]int, lagDepth)
+	predictions := make([]int, lagDepth)
+	var score predictionScore
+
+	for i := 1; i < len(s); i++ {
+		for d := 1; d <= lagDepth; d++ {
+			predictions[d-1] = noPrediction
+			if d <= i {
+				predictions[d-1] = s[i-d]
+			}
+		}
+		score.add(predictions[winner(scores)], s[i])
+		updateScores(scores, predictions, s[i])
+	}
+	return score.estimate(name, k)
+}
+
+// Encodes the context s[start:end] as a map key
+func contextKey(s []int, start, end int) string {
+	b := make([]byte, 0, 2*(end-start))
+	for _, v := range s[start:end] {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return string(b)
+}
+
+// Finds the value with the highest count, ties going to the larger value
+func mostFrequent(counts map[int]int) (int, int) {
+	best, max := noPrediction, -1
+	for v, c := range counts {
+		if c > max || (c == max && v > best) {
+			best, max = v, c
+		}
+	}
+	return best, max
+}
+
+// MultiMMC prediction estimate (6.3.9), predicting with Markov models of orders 1 to 16
+func MultiMMC(s []int, k int) Estimate {
+	const name = "MultiMMC Prediction"
+	models := make([]map[string]map[int]int, mmcMaxOrder)
+	for d := range models {
+		models[d] = make(map[string]map[int]int)
+	}
+	scores := make([]int, mmcMaxOrder)
+	predictions := make([]int, mmcMaxOrder)
+	var score predictionScore
+
+	for i := 2; i < len(s); i++ {
+		// Train each model on the transition into the previous sample
+		for d := 1; d <= mmcMaxOrder; d++ {
+			if d < i {
+				key := contextKey(s, i-d-1, i-1)
+				counts, ok := models[d-1][key]
+				if !ok && len(models[d-1]) < mmcMaxEntries {
+					counts = make(map[int]int)
+					models[d-1][key] = counts
+				}
+				if counts != nil {
+					counts[s[i-1]]++
+				}
+			}
+		}
+
+		// Predict the next sample from the most recent context of each order
+		for d := 1; d <= mmcMaxOrder; d++ {
+			predictions[d-1] = noPrediction
+			if d <= i {
+				if counts, ok := models[d-1][contextKey(s, i-d, i)]; ok {
+					predictions[d-1], _ = mostFrequent(counts)
+				}
+			}
+		}
+		score.add(predictions[winner(scores)], s[i])
+		updateScores(scores, predictions, s[i])
+	}
+	return score.estimate(name, k)
+}
+
+// LZ78Y prediction estimate (6.3.10), predicting with a dictionary of previously seen contexts of up to 16 samples
+func LZ78Y(s []int, k int) Estimate {
+	score := lz78yPredict(s)
+	return score.estimate("LZ78Y Prediction", k)
+}
+
+// Scores the LZ78Y predictor over [s]
+func lz78yPredict(s []int) predictionScore {
+	b := lz78yMaxString
+	dict := make(map[string]map[int]int)
+	var score predictionScore
+
+	for i := b + 1; i < len(s); i++ {
+		// Add the contexts preceding the previous sample to the dictionary
+		for j := b; j >= 1; j-- {
+			key := contextKey(s, i-j-1, i-1)
+			counts, ok := dict[key]
+			if !ok {
+				if len(dict) >= lz78yMaxDictionary {
+					continue
+				}
+				counts = make(map[int]int)
+				dict[key] = counts
+			}
+			counts[s[i-1]]++
+		}
+
+		// Predict using the context with the most frequently seen continuation
+		prediction, max := noPrediction, 0
+		for j := b; j >= 1; j-- {
+			if counts, ok := dict[contextKey(s, i-j, i)]; ok {
+				if y, c := mostFrequent(counts); c > max {
+					prediction, max = y, c
+				}
+			}
+		}
+		score.add(prediction, s[i])
+	}
+	return score
+}
@@ -0,0 +1,211 @@
+package entropy
+
+import (
+	"math"
+	"sort"
+)
+
+const tupleThreshold = 35 // Minimum number of occurrences for a tuple to be used by the t-tuple estimate
+
+// Counts of repeated tuples in a dataset, for every tuple length, computed from its suffix array
+type tupleCounts struct {
+	maxCount []int     // maxCount[w]: occurrences of the most common w-tuple
+	pairs    []float64 // pairs[w]: number of pairs of positions starting with the same w-tuple
+}
+
+// Computes repeated tuple counts for [s] using a suffix array and its LCP array. Every pair of suffixes shares a
+// prefix of length equal to the minimum of the LCP array between them, so counting, for each LCP entry, the ranges
+// in which it is the minimum gives the counts for all tuple lengths in O(n log n)
+func countTuples(s []int) *tupleCounts {
+	n := len(s)
+	lcp := lcpArray(s, suffixArray(s))
+	maxLCP := 0
+	for _, l := range lcp {
+		if l > maxLCP {
+			maxLCP = l
+		}
+	}
+
+	// For each lcp[i] find the extent of the ranges in which it is the rightmost minimum
+	left := make([]int, n)
+	right := make([]int, n)
+	stack := []int{}
+	for i := 1; i < n; i++ {
+		for len(stack) > 0 && lcp[stack[len(stack)-1]] >= lcp[i] {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			left[i] = i
+		} else {
+			left[i] = i - stack[len(stack)-1]
+		}
+		stack = append(stack, i)
+	}
+	stack = stack[:0]
+	for i := n - 1; i >= 1; i-- {
+		for len(stack) > 0 && lcp[stack[len(stack)-1]] > lcp[i] {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			right[i] = n - i
+		} else {
+			right[i] = stack[len(stack)-1] - i
+		}
+		stack = append(stack, i)
+	}
+
+	// Tally pairs and group sizes by the length of their shared prefix
+	c := &tupleCounts{make([]int, maxLCP+2), make([]float64, maxLCP+2)}
+	for i := 1; i < n; i++ {
+		l := lcp[i]
+		c.pairs[l] += float64(left[i]) * float64(right[i])
+		if group := left[i] + right[i]; group > c.maxCount[l] {
+			c.maxCount[l] = group
+		}
+	}
+
+	// Pairs sharing a prefix of length l also share every shorter prefix
+	for w := maxLCP - 1; w >= 0; w-- {
+		c.pairs[w] += c.pairs[w+1]
+		if c.maxCount[w+1] > c.maxCount[w] {
+			c.maxCount[w] = c.maxCount[w+1]
+		}
+	}
+	for w := 1; w <= maxLCP+1; w++ {
+		if c.maxCount[w] == 0 {
+			c.maxCount[w] = 1
+		}
+	}
+	return c
+}
+
+// Builds the suffix array of [s] by prefix doubling
+func suffixArray(s []int) []int {
+	n := len(s)
+	sa := make([]int, n)
+	rank := make([]int, n)
+	tmp := make([]int, n)
+	for i := range sa {
+		sa[i] = i
+		rank[i] = s[i]
+	}
+	if n < 2 {
+		return sa
+	}
+
+	for k := 1; ; k *= 2 {
+		key := func(i int) (int, int) {
+			if i+k < n {
+				return rank[i], rank[i+k]
+			}
+			return rank[i], -1
+		}
+		sort.Slice(sa, func(a, b int) bool {
+			a1, a2 := key(sa[a])
+			b1, b2 := key(sa[b])
+			if a1 != b1 {
+				return a1 < b1
+			}
+			return a2 < b2
+		})
+
+		// Re-rank, stopping once every suffix has a distinct rank
+		tmp[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			p1, p2 := key(sa[i-1])
+			c1, c2 := key(sa[i])
+			tmp[sa[i]] = tmp[sa[i-1]]
+			if p1 != c1 || p2 != c2 {
+				tmp[sa[i]]++
+			}
+		}
+		copy(rank, tmp)
+		if rank[sa[n-1]] == n-1 {
+			return sa
+		}
+	}
+}
+
+// Builds the LCP array using Kasai's algorithm, where lcp[i] is the length of the common prefix of the suffixes at
+// sa[i-1] and sa[i]
+func lcpArray(s, sa []int) []int {
+	n := len(s)
+	rank := make([]int, n)
+	for i, p := range sa {
+		rank[p] = i
+	}
+	lcp := make([]int, n)
+	h := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			h = 0
+			continue
+		}
+		j := sa[rank[i]-1]
+		for i+h < n && j+h < n && s[i+h] == s[j+h] {
+			h++
+		}
+		lcp[rank[i]] = h
+		if h > 0 {
+			h--
+		}
+	}
+	return lcp
+}
+
+// t-Tuple estimate (6.3.5), bounding the probability of the most likely sample using frequently repeated tuples
+func TTuple(s []int) Estimate {
+	return tTuple(s, countTuples(s))
+}
+
+func tTuple(s []int, c *tupleCounts) Estimate {
+	const name = "t-Tuple"
+	n := len(s)
+
+	// Find the largest t such that some t-tuple occurs at least 35 times
+	t := 0
+	for w := 1; w < len(c.maxCount) && c.maxCount[w] >= tupleThreshold; w++ {
+		t = w
+	}
+	if t == 0 {
+		return notApplicable(name)
+	}
+
+	pMax := 0.0
+	for i := 1; i <= t; i++ {
+		p := math.Pow(float64(c.maxCount[i])/float64(n-i+1), 1/float64(i))
+		pMax = math.Max(pMax, p)
+	}
+	return estimate(name, upperBound(pMax, n))
+}
+
+// Longest repeated substring estimate (6.3.6), using tuples too rare for the t-tuple estimate
+func LRS(s []int) Estimate {
+	return lrs(s, countTuples(s))
+}
+
+func lrs(s []int, c *tupleCounts) Estimate {
+	const name = "Longest Repeated Substring"
+	n := len(s)
+
+	// u is the smallest length with no tuple repeated 35 times, v the longest repeated tuple
+	u := 1
+	for u < len(c.maxCount) && c.maxCount[u] >= tupleThreshold {
+		u++
+	}
+	v := 0
+	for w := 1; w < len(c.pairs) && c.pairs[w] > 0; w++ {
+		v = w
+	}
+	if u > v {
+		return notApplicable(name)
+	}
+
+	pMax := 0.0
+	for w := u; w <= v; w++ {
+		total := float64(n-w+1) * float64(n-w) / 2
+		p := math.Pow(c.pairs[w]/total, 1/float64(w))
+		pMax = math.Max(pMax, p)
+	}
+	return estimate(name, upperBound(pMax, n))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/adamhosier/random/src/random"
+	"io"
+	"os"
+	"strings"
+)
+
+// Runs the NIST statistical tests over one sequence from a configured generator or a file, or the TestU01 style
+// battery over bits read from it, writing every result in the chosen format and exiting with status 1 if any test
+// fails, so it can gate a CI job, e.g.
+//
+//	go run src/evaluation/check_random.go -config prng -length 1000000 -format junit > nist.xml
+//	go run src/evaluation/check_random.go -config prng -battery
+//	go run src/evaluation/check_random.go -file sample.bin -length 1000000000 -stream
+func main() {
+	config := flag.String("config", "", "name of the generator config to read bits from")
+	file := flag.String("file", "", "file to read bits from, instead of a generator")
+	length := flag.Int("length", 1000000, "number of bits to test with the NIST tests")
+	stream := flag.Bool("stream", false, "read the bits in chunks, so samples too large for memory can be tested")
+	battery := flag.Bool("battery", false, "run the TestU01 style battery instead of the NIST tests")
+	alpha := flag.Float64("alpha", random.DefaultSignificance, "significance level of each test")
+	tests := flag.String("tests", "", "comma separated tests to run, from: "+strings.Join(random.CheckNames(), ", ")+
+		"; or with -battery: "+strings.Join(random.BatteryNames(), ", "))
+	format := flag.String("format", "text", "output format: text, json, csv or junit")
+	flag.Parse()
+
+	var source random.Extractable
+	switch {
+	case *file != "":
+		source = random.NewFileInput(*file, random.EOFFail)
+	case *config != "":
+		source = random.NewGeneratorFromConfig(*config)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := random.CheckOptions{Significance: *alpha}
+	if *tests != "" {
+		options.Tests = strings.Split(*tests, ",")
+	}
+	var passed bool
+	var results []random.TestResult
+	if *battery {
+		passed, results = random.RunBattery(source, options)
+	} else if *stream {
+		passed, results = random.StreamCheck(source, *length, random.StreamOptions{CheckOptions: options})
+	} else {
+		passed, results = random.CheckRandom(source.GetBits(*length), options)
+	}
+
+	var err error
+	switch *format {
+	case "text":
+		err = writeText(os.Stdout, results)
+	case "json":
+		err = random.WriteJSON(os.Stdout, results)
+	case "csv":
+		err = random.WriteCSV(os.Stdout, results)
+	case "junit":
+		suite := "NIST SP 800-22"
+		if *battery {
+			suite = "Battery"
+		}
+		err = random.WriteJUnit(os.Stdout, suite, results)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+// Writes one line per result, giving its status, smallest P value and the reason it was inconclusive if it was
+func writeText(w io.Writer, results []random.TestResult) error {
+	for _, r := range results {
+		line := fmt.Sprintf("%-12s %8.6f  %s", strings.ToUpper(r.Status.String()), r.P, r.Name)
+		if r.Reason != "" {
+			line += " (" + r.Reason + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
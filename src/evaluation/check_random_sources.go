@@ -28,11 +28,13 @@ func main() {
 
 func test(e random.Extractable, numBits int) {
 	bits := e.GetBits(numBits)
-	passed, results := random.CheckRandom(bits)
+	passed, results := random.CheckRandom(bits, random.CheckOptions{})
 	if !passed {
 		for _, res := range results {
 			fmt.Printf("Test \"%s\"\n", res.Name)
-			if res.Result {
+			if res.Status == random.StatusInconclusive {
+				fmt.Printf("\tINCONCLUSIVE (%s)\n", res.Reason)
+			} else if res.Result {
 				fmt.Println("\tPASSED")
 			} else {
 				fmt.Printf("\tFAILED (p = %g at %f significance)\n", res.P, res.Significance)
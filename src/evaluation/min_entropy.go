@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/adamhosier/random/src/entropy"
+	"github.com/adamhosier/random/src/random"
+	"os"
+	"time"
+)
+
+// Estimates the min-entropy of a configured generator or a file of raw samples, e.g.
+//
+//	go run src/evaluation/min_entropy.go -config prng -bits 1000000
+//	go run src/evaluation/min_entropy.go -file capture.bin -sample 8
+func main() {
+	config := flag.String("config", "", "name of the generator config to read bits from")
+	file := flag.String("file", "", "file to read bits from, instead of a generator")
+	numBits := flag.Int("bits", 1000000, "number of bits to assess")
+	sampleBits := flag.Int("sample", 1, "number of bits per sample")
+	permutations := flag.Int("permutations", entropy.DefaultPermutations,
+		"number of shuffles for the IID permutation tests, negative to skip them")
+	flag.Parse()
+
+	var source random.Extractable
+	switch {
+	case *file != "":
+		source = random.NewFileInput(*file, random.EOFFail)
+	case *config != "":
+		source = random.NewGeneratorFromConfig(*config)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	bits := source.GetBits(*numBits)
+	report := entropy.Assess(bits, *sampleBits, *permutations, time.Now().UnixNano())
+	fmt.Print(report)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/adamhosier/random/src/random"
+	"os"
+	"strings"
+)
+
+// Runs the NIST statistical tests over many sequences from a configured generator or a file, printing a report in
+// the layout of NIST's finalAnalysisReport.txt, e.g.
+//
+//	go run src/evaluation/nist_assess.go -config prng -sequences 100 -length 1000000
+func main() {
+	config := flag.String("config", "", "name of the generator config to read bits from")
+	file := flag.String("file", "", "file to read bits from, instead of a generator")
+	sequences := flag.Int("sequences", 100, "number of sequences to test")
+	length := flag.Int("length", 1000000, "number of bits in each sequence")
+	alpha := flag.Float64("alpha", random.DefaultSignificance, "significance level of each test")
+	tests := flag.String("tests", "", "comma separated tests to run, from: "+strings.Join(random.CheckNames(), ", "))
+	flag.Parse()
+
+	var source random.Extractable
+	switch {
+	case *file != "":
+		source = random.NewFileInput(*file, random.EOFFail)
+	case *config != "":
+		source = random.NewGeneratorFromConfig(*config)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := random.CheckOptions{Significance: *alpha}
+	if *tests != "" {
+		options.Tests = strings.Split(*tests, ",")
+	}
+	assessment := random.Assess(source, *sequences, *length, options)
+	fmt.Print(assessment)
+	if !assessment.Passed() {
+		os.Exit(1)
+	}
+}
@@ -9,67 +9,20 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
+	"github.com/adamhosier/random/src/random"
+	"os"
 )
 
-type Request struct {
-	JsonRPC string         `json:"jsonrpc"`
-	Method  string         `json:"method"`
-	Params  *RequestParams `json:"params"`
-	Id      int            `json:"id"`
-}
-
-type RequestParams struct {
-	ApiKey string `json:"apiKey"`
-	N      int    `json:"n"`
-	Size   int    `json:"size"`
-}
-
-type Response struct {
-	Error *struct {
-		Code    int
-		Message string
-	}
-	Result *struct {
-		Random *struct {
-			Data []string
-		}
-	}
-}
-
+// Writes 256 random bits fetched from random.org to stdout, using the API key in $RANDOM_ORG_API_KEY
 func main() {
-	url := "https://api.random.org/json-rpc/1/invoke"
-	method := "generateBlobs"
-	params := RequestParams{"c463485b-1a4d-4f26-af04-792affc469bb", 1, 256}
-	request := &Request{JsonRPC: "2.0", Method: method, Params: &params, Id: 1}
-
-	// Build request
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(request)
-
-	// Send request
-	resp, err := http.Post(url, "application/json-rpc", b)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if resp.StatusCode != 200 {
-		log.Fatalf("Invalid return code: %d", resp.StatusCode)
-	}
-
-	// Extract body
-	var data Response
-	json.NewDecoder(resp.Body).Decode(&data)
-
-	// Handle json-rpc errors
-	if data.Error != nil {
-		log.Fatalf("JSON response error: %s", data.Error.Message)
-	}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(os.Stderr, r)
+			os.Exit(1)
+		}
+	}()
 
-	// Collect result
-	result := data.Result.Random.Data[0]
-	fmt.Println(result[:len(result)-1])
+	source := random.NewRandomOrgSource(random.RandomOrgConfig{})
+	os.Stdout.Write(source.GetBits(256).Bytes())
 }
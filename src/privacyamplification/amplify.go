@@ -0,0 +1,43 @@
+/* Privacy amplification, described in
+ * C. H. Bennett, G. Brassard, C. Crepeau and U. M. Maurer, Generalized privacy amplification, IEEE Trans. Inf. Theory
+ * 41(6), 1995
+ *
+ * After reconciliation Alice and Bob share a key that Eve knows something about, from tapping the private channel and
+ * from everything revealed on the public channel. Hashing the key with a 2-universal hash chosen at random leaves a
+ * shorter key that is close to uniform given Eve's information, by the leftover hash lemma
+ */
+
+package privacyamplification
+
+import (
+	"errors"
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"math"
+)
+
+const (
+	verifyBits = 64 // Length of the hash comparing the reconciled keys
+)
+
+// Returned when Eve may know too much of the reconciled key for any of it to be kept secret
+var ErrNoSecrecy = errors.New("privacyamplification: no secret key can be extracted")
+
+// Estimates the bits Eve may know of an [n] bit key sent over a channel with error rate [qber], where [leaked] bits
+// were revealed on the public channel. The channel contributes n h(qber), the bound on what an eavesdropper causing
+// that error rate can learn in BB84 style protocols
+func EveInformation(n int, qber float64, leaked int) float64 {
+	return float64(n)*BinaryEntropy(qber) + float64(leaked)
+}
+
+// Length of the key that can be extracted from an [n] bit key of which Eve knows [eve] bits, so that it is within
+// [epsilon] of uniform given her information. By the leftover hash lemma, hashing k bits of min-entropy to m bits is
+// 2^-((k-m)/2) close to uniform, so m = k - 2 log2(1/epsilon)
+func SecretKeyLength(n int, eve, epsilon float64) int {
+	return int(math.Max(0, math.Floor(float64(n)-eve-2*math.Log2(1/epsilon))))
+}
+
+// Hashes the reconciled [key] to its final [length], with a Toeplitz matrix whose diagonals are the public [seed]
+func Amplify(key, seed *bitstring.BitString, length int) *bitstring.BitString {
+	return random.ToeplitzHash(seed, key, length)
+}
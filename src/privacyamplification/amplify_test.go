@@ -0,0 +1,48 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/random"
+	"testing"
+)
+
+func TestSecretKeyLength(t *testing.T) {
+	tests := []struct {
+		n       int
+		eve     float64
+		epsilon float64
+		want    int
+	}{
+		{1000, 0, 0.5, 998},
+		{1000, 100.5, random.DefaultEntropyErr, 835},
+		{1000, 936, random.DefaultEntropyErr, 0},
+		{1000, 2000, 0.5, 0},
+	}
+	for _, test := range tests {
+		if got := SecretKeyLength(test.n, test.eve, test.epsilon); got != test.want {
+			t.Errorf("SecretKeyLength(%d, %g, %g) == %d, want %d", test.n, test.eve, test.epsilon, got, test.want)
+		}
+	}
+	if got := EveInformation(1000, 0.5, 10); got != 1010 {
+		t.Errorf("EveInformation(1000, 0.5, 10) == %g, want 1010", got)
+	}
+}
+
+func TestAmplify(t *testing.T) {
+	rng := seeded(1)
+	key := rng.GetBits(256)
+	seed := rng.GetBits(256 + 100 - 1)
+	amplified := Amplify(key, seed, 100)
+	if amplified.Length != 100 {
+		t.Fatalf("Amplify() gave %d bits, want 100", amplified.Length)
+	}
+
+	// Changing a single bit of the key changes about half the output
+	flipped := key.Copy()
+	flipped.Invert(17)
+	if d := differences(amplified, Amplify(flipped, seed, 100)); d < 30 || d > 70 {
+		t.Errorf("Flipping a bit of the key changed %d of 100 bits of Amplify()", d)
+	}
+	if !Amplify(key, seed, 100).Equals(amplified) {
+		t.Errorf("Amplify() is not deterministic")
+	}
+}
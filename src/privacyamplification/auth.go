@@ -0,0 +1,208 @@
+/* Authentication of the public channel with Wegman-Carter MACs, described in
+ * M. N. Wegman and J. L. Carter, New hash functions and their use in authentication and set equality, JCSS 22, 1981
+ *
+ * Each party hashes every message it sends and receives with a polynomial hash over GF(2^64), keyed by a secret
+ * shared in advance. At the end of a session each sends the hash of its messages, encrypted with a one time pad, and
+ * checks the other's against its own hash of the messages it received. The hash key is reused, but each tag spends
+ * fresh pad bits from a pool that agreed keys replenish
+ */
+
+package privacyamplification
+
+import (
+	"errors"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"sync"
+)
+
+const (
+	tagBits    = 64
+	gf64Reduce = 0x1B // x^64 = x^4 + x^3 + x + 1 in GF(2^64)
+)
+
+// Returned when the key pool has too few bits left to authenticate a session
+var ErrPoolExhausted = errors.New("privacyamplification: authentication key pool exhausted")
+
+// Returned when the messages one party received differ from those the other sent, so the public channel has been
+// tampered with
+type AuthenticationError struct {
+	Messages int // Messages received before the failed verification
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("privacyamplification: public channel failed authentication after %d messages", e.Messages)
+}
+
+// Pool of secret key shared by Alice and Bob, each holding their own copy, from which authentication tags are drawn
+type KeyPool struct {
+	mu   sync.Mutex
+	hash uint64               // Key of the polynomial hash, reused for every tag
+	pads *bitstring.BitString // One time pads encrypting tags, each used once
+}
+
+// Creates a pool from a [preshared] key, the first 64 bits of which key the hash. Panics if the key is too short
+func NewKeyPool(preshared *bitstring.BitString) *KeyPool {
+	if preshared.Length < tagBits {
+		panic("KeyPool: preshared key must be at least 64 bits")
+	}
+	return &KeyPool{hash: word(preshared, 0), pads: preshared.Substring(tagBits, preshared.Length-tagBits)}
+}
+
+// Number of pad bits left in the pool
+func (p *KeyPool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pads.Length
+}
+
+// Adds the bits of a newly agreed [key] to the pool
+func (p *KeyPool) Replenish(key *bitstring.BitString) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pads = p.pads.Extend(key)
+}
+
+// Takes the next [n] pad bits from the pool
+func (p *KeyPool) take(n int) (*bitstring.BitString, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pads.Length < n {
+		return nil, ErrPoolExhausted
+	}
+	pad := p.pads.Substring(0, n)
+	p.pads = p.pads.Substring(n, p.pads.Length-n)
+	return pad, nil
+}
+
+// The 64 bits of [bs] from [start] as a word, padded with zeros past the end
+func word(bs *bitstring.BitString, start int) uint64 {
+	var w uint64
+	for i := start; i < start+tagBits && i < bs.Length; i++ {
+		if bs.Data[i] {
+			w |= 1 << uint(tagBits-1-(i-start))
+		}
+	}
+	return w
+}
+
+func wordBits(w uint64) *bitstring.BitString {
+	bs := bitstring.BitStringOfLength(tagBits)
+	for i := range bs.Data {
+		bs.Data[i] = w>>uint(tagBits-1-i)&1 == 1
+	}
+	return bs
+}
+
+// Multiplies [a] and [b] in GF(2^64)
+func gf64Mul(a, b uint64) uint64 {
+	var product uint64
+	for ; b != 0; b >>= 1 {
+		if b&1 == 1 {
+			product ^= a
+		}
+		carry := a >> 63
+		a <<= 1
+		if carry == 1 {
+			a ^= gf64Reduce
+		}
+	}
+	return product
+}
+
+// Polynomial hash over GF(2^64) of a sequence of messages, evaluated at the key by Horner's rule. Each message is
+// preceded by its length, and the number of blocks ends the polynomial, so that no two sequences share coefficients
+type transcript struct {
+	key      uint64
+	acc      uint64
+	blocks   int
+	messages int
+}
+
+func (t *transcript) block(b uint64) {
+	t.acc = gf64Mul(t.acc^b, t.key)
+	t.blocks++
+}
+
+func (t *transcript) add(bs *bitstring.BitString) {
+	t.block(uint64(bs.Length))
+	for start := 0; start < bs.Length; start += tagBits {
+		t.block(word(bs, start))
+	}
+	t.messages++
+}
+
+func (t *transcript) sum() uint64 {
+	return gf64Mul(t.acc^uint64(t.blocks), t.key)
+}
+
+// A public channel whose messages are authenticated once the session verifies them
+type AuthenticatedChannel struct {
+	Channel
+	pool      *KeyPool
+	initiator bool // Whether this end sends its tag first, taking the first pad
+	sent      transcript
+	received  transcript
+}
+
+// Authenticates [ch] with tags drawn from [pool]. The ends of a channel must be given identical pools, and one of them
+// must be the [initiator]
+func NewAuthenticatedChannel(ch Channel, pool *KeyPool, initiator bool) *AuthenticatedChannel {
+	return &AuthenticatedChannel{ch, pool, initiator, transcript{key: pool.hash}, transcript{key: pool.hash}}
+}
+
+func (c *AuthenticatedChannel) Send(bs *bitstring.BitString) error {
+	if err := c.Channel.Send(bs); err != nil {
+		return err
+	}
+	c.sent.add(bs)
+	return nil
+}
+
+func (c *AuthenticatedChannel) Receive() (*bitstring.BitString, error) {
+	bs, err := c.Channel.Receive()
+	if err != nil {
+		return nil, err
+	}
+	c.received.add(bs)
+	return bs, nil
+}
+
+// Exchanges tags of the messages sent each way since the channel was created, returning an AuthenticationError if the
+// messages received are not those the other end sent. The initiator sends its tag first, and the other end only replies
+// with its own once the initiator's is verified, so a valid reply tells the initiator that both directions were
+// untouched
+func (c *AuthenticatedChannel) Verify() error {
+	pads, err := c.pool.take(2 * tagBits)
+	if err != nil {
+		return err
+	}
+	first, second := word(pads, 0), word(pads, tagBits)
+	if !c.initiator {
+		first, second = second, first
+	}
+
+	send := func() error {
+		return c.Channel.Send(wordBits(c.sent.sum() ^ first))
+	}
+	check := func() error {
+		tag, err := c.Channel.Receive()
+		if err != nil {
+			return err
+		}
+		if tag.Length != tagBits || word(tag, 0) != c.received.sum()^second {
+			return &AuthenticationError{c.received.messages}
+		}
+		return nil
+	}
+	steps := []func() error{send, check}
+	if !c.initiator {
+		steps = []func() error{check, send}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
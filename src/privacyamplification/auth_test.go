@@ -0,0 +1,89 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"testing"
+)
+
+func TestGF64Mul(t *testing.T) {
+	tests := []struct {
+		a, b, want uint64
+	}{
+		{0x1234, 1, 0x1234},
+		{0x1234, 0, 0},
+		{3, 3, 5},
+		{1 << 63, 2, gf64Reduce},
+		{1 << 63, 1 << 63, gf64Mul(gf64Reduce, 1<<62)},
+	}
+	for _, test := range tests {
+		if got := gf64Mul(test.a, test.b); got != test.want {
+			t.Errorf("gf64Mul(%#x, %#x) == %#x, want %#x", test.a, test.b, got, test.want)
+		}
+		if gf64Mul(test.a, test.b) != gf64Mul(test.b, test.a) {
+			t.Errorf("gf64Mul(%#x, %#x) does not commute", test.a, test.b)
+		}
+	}
+}
+
+// Sends [messages] from a to b and back, then verifies both ends, returning their errors
+func exchange(a, b *AuthenticatedChannel, messages []*bitstring.BitString) (errA, errB error) {
+	done := make(chan struct{})
+	go func() {
+		for _, m := range messages {
+			a.Send(m)
+			a.Receive()
+		}
+		errA = a.Verify()
+		close(done)
+	}()
+	for range messages {
+		m, _ := b.Receive()
+		b.Send(m)
+	}
+	if errB = b.Verify(); errB != nil {
+		b.Close()
+	}
+	<-done
+	return
+}
+
+func TestAuthenticatedChannel(t *testing.T) {
+	preshared := seeded(1).GetBits(tagBits + 4*tagBits)
+	messages := []*bitstring.BitString{bitstring.BitStringFromInt(8, 0xA5), bitstring.NewBitString(),
+		seeded(2).GetBits(200)}
+
+	// Untouched messages verify, spending a pad each way
+	endA, endB := NewPerfectLink()
+	poolA, poolB := NewKeyPool(preshared), NewKeyPool(preshared)
+	a, b := NewAuthenticatedChannel(endA, poolA, true), NewAuthenticatedChannel(endB, poolB, false)
+	if errA, errB := exchange(a, b, messages); errA != nil || errB != nil {
+		t.Fatalf("Verify() failed with %v, %v", errA, errB)
+	}
+	if poolA.Available() != 2*tagBits || poolB.Available() != 2*tagBits {
+		t.Errorf("Pools have %d and %d bits after verifying, want %d", poolA.Available(), poolB.Available(),
+			2*tagBits)
+	}
+
+	// Any change to a message is detected by the receiver, and the sender sees the session end
+	endA, endB = NewPerfectLink()
+	flip := func(i int, bs *bitstring.BitString) *bitstring.BitString {
+		if i == 2 {
+			bs.Invert(100)
+		}
+		return bs
+	}
+	a = NewAuthenticatedChannel(NewTamperingLink(endA, flip), poolA, true)
+	b = NewAuthenticatedChannel(endB, poolB, false)
+	errA, errB := exchange(a, b, messages)
+	if err, ok := errB.(*AuthenticationError); !ok || err.Messages != len(messages) {
+		t.Errorf("Verify() of a tampered message failed with %v, want an AuthenticationError", errB)
+	}
+	if errA != ErrClosed {
+		t.Errorf("Verify() by the sender of a tampered message failed with %v, want ErrClosed", errA)
+	}
+
+	// Nothing is verified once the pool runs out
+	if err := a.Verify(); err != ErrPoolExhausted {
+		t.Errorf("Verify() with an empty pool failed with %v, want ErrPoolExhausted", err)
+	}
+}
@@ -0,0 +1,372 @@
+/* Quantum key distribution, simulated classically, described in
+ * C. H. Bennett and G. Brassard, Quantum cryptography: Public key distribution and coin tossing, 1984, and
+ * C. H. Bennett, Quantum cryptography using any two nonorthogonal states, PRL 68(21), 1992
+ *
+ * Alice sends photons over the private channel, each encoding a bit in the rectilinear or diagonal basis. Bob measures
+ * each in a basis of his own, learning the bit when the bases match and a random bit otherwise, and the two sift out
+ * the bits Bob measured conclusively by discussing bases on the public channel. Measuring a photon disturbs it, so an
+ * eavesdropper on the photons raises the error rate, which Alice and Bob estimate by disclosing a random sample of the
+ * sifted bits. What is left is the secret that reconciliation and privacy amplification go on to process
+ */
+
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"math"
+)
+
+const (
+	photonBits        = 2    // Bits encoding a photon on the private channel, its value and its basis
+	photonMargin      = 64   // Photons sent beyond those expected to be needed, so that one batch usually suffices
+	defaultSampleSize = 256  // Sifted bits disclosed to estimate the error rate
+	defaultMaxQBER    = 0.11 // Highest error rate from which BB84 can extract a key whatever Eve does
+)
+
+// A photon, simulated by the bit it encodes and whether it was prepared in the diagonal basis or the rectilinear one
+type Photon struct {
+	Value    bool
+	Diagonal bool
+}
+
+// Measures the photon in the [diagonal] or rectilinear basis, giving its value if it was prepared in that basis, or
+// a bit chosen by [rng] otherwise
+func (p Photon) Measure(diagonal bool, rng *random.Generator) bool {
+	if p.Diagonal == diagonal {
+		return p.Value
+	}
+	return rng.NextBool()
+}
+
+func encodePhotons(photons []Photon) *bitstring.BitString {
+	bs := bitstring.BitStringOfLength(photonBits * len(photons))
+	for i, p := range photons {
+		bs.Data[photonBits*i], bs.Data[photonBits*i+1] = p.Value, p.Diagonal
+	}
+	return bs
+}
+
+func decodePhotons(bs *bitstring.BitString) ([]Photon, error) {
+	if bs.Length%photonBits != 0 {
+		return nil, ErrMalformed
+	}
+	photons := make([]Photon, bs.Length/photonBits)
+	for i := range photons {
+		photons[i] = Photon{bs.Data[photonBits*i], bs.Data[photonBits*i+1]}
+	}
+	return photons, nil
+}
+
+// Noise flipping the value of photons, which Bob sees as errors in the bits he measures in the right basis
+type PhotonNoise struct {
+	p   float64
+	rng *random.Generator
+}
+
+// Flips the value of each photon with probability [p] chosen by [rng]
+func NewPhotonNoise(p float64, rng *random.Generator) *PhotonNoise {
+	checkRate("PhotonNoise", p)
+	return &PhotonNoise{p, rng}
+}
+
+func (n *PhotonNoise) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	cp := bs.Copy()
+	for i := 0; i < bs.Length; i += photonBits {
+		if n.rng.NextNormalizedFloat() < n.p {
+			cp.Invert(i)
+		}
+	}
+	return cp
+}
+
+// Eve measuring photons in a basis of her choosing and sending on a photon prepared in the state she measured. Where
+// she chose the wrong basis her photon is in the wrong basis for Bob too, who then measures the wrong bit half the time
+type InterceptResend struct {
+	fraction float64
+	rng      *random.Generator
+}
+
+// Intercepts each photon with probability [fraction], measuring it in a basis chosen by [rng]
+func NewInterceptResend(fraction float64, rng *random.Generator) *InterceptResend {
+	checkRate("InterceptResend", fraction)
+	return &InterceptResend{fraction, rng}
+}
+
+func (n *InterceptResend) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	photons, err := decodePhotons(bs)
+	if err != nil {
+		return bs.Copy()
+	}
+	for i, p := range photons {
+		if n.rng.NextNormalizedFloat() < n.fraction {
+			diagonal := n.rng.NextBool()
+			photons[i] = Photon{p.Measure(diagonal, n.rng), diagonal}
+		}
+	}
+	return encodePhotons(photons)
+}
+
+// Sifting and error estimation, shared by BB84 and B92
+type sifting struct {
+	sampleSize int
+	maxQBER    float64
+	yield      float64 // Chance of each photon giving a sifted bit
+}
+
+func newSifting(sampleSize int, maxQBER, yield float64) sifting {
+	if sampleSize <= 0 {
+		sampleSize = defaultSampleSize
+	}
+	if maxQBER <= 0 {
+		maxQBER = defaultMaxQBER
+	}
+	return sifting{sampleSize, maxQBER, yield}
+}
+
+// Alice's half of sifting a batch of [m] photons, returning the bits she keeps
+type sendBatch func(conn *Conn, private Channel, rng *random.Generator, m int) (*bitstring.BitString, error)
+
+// Bob's half of sifting a batch of photons, returning the bits he keeps and the number of photons
+type receiveBatch func(conn *Conn, private Channel, rng *random.Generator) (*bitstring.BitString, int, error)
+
+// Alice's side, sending batches of photons until an [n] bit secret and the sample are sifted, then estimating the
+// error rate
+func (s sifting) send(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats,
+	batch sendBatch) (*bitstring.BitString, float64, error) {
+	if conn.Version() < siftingVersion {
+		return nil, 0, ErrVersion
+	}
+	need := n + s.sampleSize
+	sifted := bitstring.NewBitString()
+	for sifted.Length < need {
+		m := int(float64(need-sifted.Length)/s.yield) + photonMargin
+		kept, err := batch(conn, private, rng, m)
+		if err != nil {
+			return nil, 0, err
+		}
+		stats.Photons += m
+		sifted = sifted.Extend(kept)
+	}
+	stats.Sifted = sifted.Length
+
+	// Disclose a sample chosen at random, and compare it with Bob's
+	seed := rng.GetBits(reconcileSeedBits)
+	sample, secret := splitSample(sifted.Substring(0, need), seed.Int(), s.sampleSize)
+	if err := conn.Send(Sample, seed.Extend(sample)); err != nil {
+		return nil, 0, err
+	}
+	theirs, err := conn.Receive(Sample)
+	if err != nil {
+		return nil, 0, err
+	}
+	if theirs.Length != s.sampleSize {
+		return nil, 0, ErrMalformed
+	}
+	qber, err := s.estimate(sample, theirs, stats)
+	return secret, qber, err
+}
+
+// Bob's side of send
+func (s sifting) receive(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats,
+	batch receiveBatch) (*bitstring.BitString, float64, error) {
+	if conn.Version() < siftingVersion {
+		return nil, 0, ErrVersion
+	}
+	need := n + s.sampleSize
+	sifted := bitstring.NewBitString()
+	for sifted.Length < need {
+		kept, m, err := batch(conn, private, rng)
+		if err != nil {
+			return nil, 0, err
+		}
+		stats.Photons += m
+		sifted = sifted.Extend(kept)
+	}
+	stats.Sifted = sifted.Length
+
+	theirs, err := conn.Receive(Sample)
+	if err != nil {
+		return nil, 0, err
+	}
+	if theirs.Length != reconcileSeedBits+s.sampleSize {
+		return nil, 0, ErrMalformed
+	}
+	seed := theirs.Substring(0, reconcileSeedBits).Int()
+	sample, secret := splitSample(sifted.Substring(0, need), seed, s.sampleSize)
+	if err := conn.Send(Sample, sample); err != nil {
+		return nil, 0, err
+	}
+	qber, err := s.estimate(theirs.Substring(reconcileSeedBits, s.sampleSize), sample, stats)
+	return secret, qber, err
+}
+
+// Splits the [k] bits of [sifted] chosen at random by [seed] from the rest, each kept in order
+func splitSample(sifted *bitstring.BitString, seed, k int) (sample, rest *bitstring.BitString) {
+	chosen := make([]bool, sifted.Length)
+	for _, i := range permutations(seed, sifted.Length, 2)[1][:k] {
+		chosen[i] = true
+	}
+	sample, rest = bitstring.NewBitString(), bitstring.NewBitString()
+	for i, b := range sifted.Data {
+		if chosen[i] {
+			sample.Add(b)
+		} else {
+			rest.Add(b)
+		}
+	}
+	return sample, rest
+}
+
+// Estimates the error rate from Alice's and Bob's samples, failing with ErrNoSecrecy if it is too high. A sample
+// without errors is taken to have one, allowing for errors that it missed
+func (s sifting) estimate(alice, bob *bitstring.BitString, stats *Stats) (float64, error) {
+	errors := differences(alice, bob)
+	stats.Sampled, stats.SampleErrors = alice.Length, errors
+	stats.ErrorRate = float64(errors) / float64(alice.Length)
+	if stats.ErrorRate > s.maxQBER {
+		return 0, ErrNoSecrecy
+	}
+	return math.Max(float64(errors), 1) / float64(alice.Length), nil
+}
+
+// BB84, in which Alice encodes each bit in a random basis, and they keep the bits Bob measured in the same basis
+type BB84 struct {
+	SampleSize int     // Sifted bits disclosed to estimate the error rate, zero is replaced by a default
+	MaxQBER    float64 // Highest error rate estimated from which a key is extracted, zero is replaced by a default
+}
+
+func (b BB84) Send(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	return newSifting(b.SampleSize, b.MaxQBER, 0.5).send(conn, private, rng, n, stats, b.sendBatch)
+}
+
+func (b BB84) Receive(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	return newSifting(b.SampleSize, b.MaxQBER, 0.5).receive(conn, private, rng, n, stats, b.receiveBatch)
+}
+
+func (BB84) sendBatch(conn *Conn, private Channel, rng *random.Generator, m int) (*bitstring.BitString, error) {
+	values, bases := rng.GetBits(m), rng.GetBits(m)
+	photons := make([]Photon, m)
+	for i := range photons {
+		photons[i] = Photon{values.Data[i], bases.Data[i]}
+	}
+	if err := private.Send(encodePhotons(photons)); err != nil {
+		return nil, err
+	}
+
+	// Bob announces his bases, and Alice which of them match hers
+	theirs, err := conn.Receive(Bases)
+	if err != nil {
+		return nil, err
+	}
+	if theirs.Length != m {
+		return nil, ErrMalformed
+	}
+	match, kept := bitstring.BitStringOfLength(m), bitstring.NewBitString()
+	for i := range match.Data {
+		if match.Data[i] = bases.Data[i] == theirs.Data[i]; match.Data[i] {
+			kept.Add(values.Data[i])
+		}
+	}
+	return kept, conn.Send(Bases, match)
+}
+
+func (BB84) receiveBatch(conn *Conn, private Channel, rng *random.Generator) (*bitstring.BitString, int, error) {
+	photons, err := receivePhotons(private)
+	if err != nil {
+		return nil, 0, err
+	}
+	m := len(photons)
+	bases := rng.GetBits(m)
+	results := make([]bool, m)
+	for i, p := range photons {
+		results[i] = p.Measure(bases.Data[i], rng)
+	}
+	if err := conn.Send(Bases, bases); err != nil {
+		return nil, 0, err
+	}
+	match, err := conn.Receive(Bases)
+	if err != nil {
+		return nil, 0, err
+	}
+	if match.Length != m {
+		return nil, 0, ErrMalformed
+	}
+	kept := bitstring.NewBitString()
+	for i, ok := range match.Data {
+		if ok {
+			kept.Add(results[i])
+		}
+	}
+	return kept, m, nil
+}
+
+func receivePhotons(private Channel) ([]Photon, error) {
+	bs, err := private.Receive()
+	if err != nil {
+		return nil, err
+	}
+	return decodePhotons(bs)
+}
+
+// B92, in which Alice sends a zero as a rectilinear zero and a one as a diagonal zero. Bob measures a one only in the
+// basis the photon was not prepared in, which tells him the bit, and they keep the bits where he did
+type B92 struct {
+	SampleSize int     // Sifted bits disclosed to estimate the error rate, zero is replaced by a default
+	MaxQBER    float64 // Highest error rate estimated from which a key is extracted, zero is replaced by a default
+}
+
+func (b B92) Send(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	return newSifting(b.SampleSize, b.MaxQBER, 0.25).send(conn, private, rng, n, stats, b.sendBatch)
+}
+
+func (b B92) Receive(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	return newSifting(b.SampleSize, b.MaxQBER, 0.25).receive(conn, private, rng, n, stats, b.receiveBatch)
+}
+
+func (B92) sendBatch(conn *Conn, private Channel, rng *random.Generator, m int) (*bitstring.BitString, error) {
+	values := rng.GetBits(m)
+	photons := make([]Photon, m)
+	for i := range photons {
+		photons[i] = Photon{false, values.Data[i]}
+	}
+	if err := private.Send(encodePhotons(photons)); err != nil {
+		return nil, err
+	}
+
+	// Bob announces which photons he measured conclusively
+	conclusive, err := conn.Receive(Bases)
+	if err != nil {
+		return nil, err
+	}
+	if conclusive.Length != m {
+		return nil, ErrMalformed
+	}
+	kept := bitstring.NewBitString()
+	for i, ok := range conclusive.Data {
+		if ok {
+			kept.Add(values.Data[i])
+		}
+	}
+	return kept, nil
+}
+
+func (B92) receiveBatch(conn *Conn, private Channel, rng *random.Generator) (*bitstring.BitString, int, error) {
+	photons, err := receivePhotons(private)
+	if err != nil {
+		return nil, 0, err
+	}
+	m := len(photons)
+	bases := rng.GetBits(m)
+	conclusive, kept := bitstring.BitStringOfLength(m), bitstring.NewBitString()
+	for i, p := range photons {
+		if conclusive.Data[i] = p.Measure(bases.Data[i], rng); conclusive.Data[i] {
+			kept.Add(!bases.Data[i])
+		}
+	}
+	return kept, m, conn.Send(Bases, conclusive)
+}
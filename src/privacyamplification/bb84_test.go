@@ -0,0 +1,104 @@
+package privacyamplification
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPhoton(t *testing.T) {
+	rng := seeded(1)
+	var ones int
+	for i := 0; i < 10000; i++ {
+		p := Photon{i%2 == 0, i%3 == 0}
+		if p.Measure(p.Diagonal, rng) != p.Value {
+			t.Fatalf("%+v measured in its own basis gave the wrong value", p)
+		}
+		if p.Measure(!p.Diagonal, rng) {
+			ones++
+		}
+	}
+	if math.Abs(float64(ones)/10000-0.5) > 0.02 {
+		t.Errorf("Photons measured in the other basis gave %d ones in 10000", ones)
+	}
+
+	photons := []Photon{{false, false}, {true, false}, {false, true}, {true, true}}
+	if got, err := decodePhotons(encodePhotons(photons)); err != nil || len(got) != 4 || got[3] != photons[3] {
+		t.Errorf("decodePhotons(encodePhotons(%v)) == %v, %v", photons, got, err)
+	}
+	if _, err := decodePhotons(seeded(1).GetBits(3)); err != ErrMalformed {
+		t.Errorf("decodePhotons() of an odd number of bits gave %v, want ErrMalformed", err)
+	}
+}
+
+func TestInterceptResend(t *testing.T) {
+	// Intercepting every photon corrupts a quarter of the bits measured in Alice's basis
+	const n = 20000
+	rng := seeded(1)
+	photons := make([]Photon, n)
+	for i := range photons {
+		photons[i] = Photon{rng.NextBool(), rng.NextBool()}
+	}
+	received, _ := decodePhotons(NewInterceptResend(1, seeded(2)).Corrupt(encodePhotons(photons)))
+	var errs int
+	for i, p := range received {
+		if p.Measure(photons[i].Diagonal, rng) != photons[i].Value {
+			errs++
+		}
+	}
+	if rate := float64(errs) / n; math.Abs(rate-0.25) > 0.01 {
+		t.Errorf("InterceptResend(1) caused error rate %g, want 0.25", rate)
+	}
+}
+
+func TestSessionQKD(t *testing.T) {
+	tests := []struct {
+		d     Distributor
+		noise Noise
+		qber  float64 // Error rate expected in the sample
+		err   error
+	}{
+		{BB84{}, NewPhotonNoise(0.03, seeded(1)), 0.03, nil},
+		{B92{}, NewPhotonNoise(0.02, seeded(1)), 0.02, nil},
+		{BB84{SampleSize: 512}, Chain(NewInterceptResend(0.1, seeded(1)), NewPhotonNoise(0.01, seeded(2))), 0.035, nil},
+		{BB84{}, NewInterceptResend(1, seeded(1)), 0.25, ErrNoSecrecy},
+		{B92{MaxQBER: 0.01}, NewPhotonNoise(0.05, seeded(1)), 0.05, ErrNoSecrecy},
+	}
+	for _, test := range tests {
+		publicA, publicB := NewPerfectLink()
+		a, privateB := NewPerfectLink()
+		config := Config{SecretLength: 1024, Distributor: test.d}
+		configA, configB := config, config
+		configA.Generator, configB.Generator = seeded(3), seeded(4)
+		alice := NewAlice(publicA, NewLossyChannel(a, test.noise), configA)
+		bob := NewBob(publicB, privateB, configB)
+		secretA, secretB, errA, errB := runSession(alice, bob)
+		if errA != test.err || errB != test.err {
+			t.Fatalf("Session with %T failed with %v, %v, want %v", test.d, errA, errB, test.err)
+		}
+
+		stats := bob.Stats()
+		sampled := float64(stats.SampleErrors) / float64(stats.Sampled)
+		if math.Abs(sampled-test.qber) > 0.03 || stats.Photons == 0 || stats.Sifted < 1024+stats.Sampled {
+			t.Errorf("Session with %T gave stats %+v", test.d, stats)
+		}
+		if test.err != nil {
+			continue
+		}
+		if !secretA.Equals(secretB) {
+			t.Errorf("Session with %T agreed different secrets", test.d)
+		}
+		// Both estimate the same error rate, but only Bob knows how many errors he corrected
+		if stats.Corrected = 0; stats != alice.Stats() {
+			t.Errorf("Session with %T gave stats %+v and %+v", test.d, alice.Stats(), bob.Stats())
+		}
+	}
+}
+
+func TestSiftingVersion(t *testing.T) {
+	a, _ := NewPerfectLink()
+	conn := NewConn(a, true)
+	conn.version = 1
+	if _, _, err := (BB84{}).Send(conn, a, seeded(1), 512, &Stats{}); err != ErrVersion {
+		t.Errorf("BB84.Send() at version 1 gave %v, want ErrVersion", err)
+	}
+}
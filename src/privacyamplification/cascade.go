@@ -0,0 +1,231 @@
+/* Cascade information reconciliation, described in
+ * G. Brassard and L. Salvail, Secret-Key Reconciliation by Public Discussion, EUROCRYPT '93
+ *
+ * Bob corrects his copy of the key by asking Alice for the parities of blocks of it. Each pass splits a differently
+ * shuffled key into blocks, doubling the block size each pass, and a binary search over the blocks whose parities
+ * differ locates an error in each. Correcting a bit changes the parity of the block holding it in every other pass, so
+ * those blocks are searched in turn, cascading until every block known has the same parity as Alice's
+ */
+
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+)
+
+const (
+	defaultCascadePasses = 4
+	cascadeBlockFactor   = 0.73 // The first block size is this over the error rate, expecting 0.73 errors per block
+)
+
+// Requests Bob makes of Alice during Cascade
+const (
+	cascadeBlockParities = iota // Parities of every block of a pass
+	cascadeParity               // Parity of a range of positions in a pass
+	cascadeDone                 // Reconciliation has finished
+)
+
+// Chooses the block size of the first pass for a key of length [n] with error rate [qber]
+func cascadeBlockSize(qber float64, n int) int {
+	if qber <= 0 {
+		return n
+	}
+	return int(math.Max(1, math.Min(float64(n), math.Ceil(cascadeBlockFactor/qber))))
+}
+
+// Cascade reconciliation, which corrects every error given enough passes
+type Cascade struct {
+	Passes int // Passes over the key, zero is replaced by a default
+}
+
+func (c Cascade) passes() int {
+	if c.Passes <= 0 {
+		return defaultCascadePasses
+	}
+	return c.Passes
+}
+
+// Alice's side of Cascade, answering Bob's requests for parities of her [key] until he is done
+func (c Cascade) Reveal(conn *Conn, key *bitstring.BitString, seed int, qber float64, stats *Stats) error {
+	passes := c.passes()
+	perms := conn.permutations(seed, key.Length, passes)
+	for {
+		req, err := conn.Receive(ParityRequest)
+		if err != nil {
+			return err
+		}
+		kind, pass, a, b, err := decodeRequest(req)
+		if err != nil {
+			return err
+		}
+		if kind == cascadeDone {
+			return nil
+		}
+		if pass >= passes {
+			return ErrMalformed
+		}
+
+		reply := bitstring.NewBitString()
+		switch kind {
+		case cascadeBlockParities:
+			// Parities of every block of size a
+			if a <= 0 {
+				return ErrMalformed
+			}
+			for lo := 0; lo < key.Length; lo += a {
+				hi := int(math.Min(float64(lo+a), float64(key.Length)))
+				reply.Add(rangeParity(key, perms[pass], lo, hi) == 1)
+			}
+		case cascadeParity:
+			if a < 0 || b > key.Length || a >= b {
+				return ErrMalformed
+			}
+			reply.Add(rangeParity(key, perms[pass], a, b) == 1)
+		default:
+			return ErrMalformed
+		}
+		if err := conn.Send(ParityReply, reply); err != nil {
+			return err
+		}
+		stats.reveal(reply.Length)
+	}
+}
+
+// A block of a pass, covering positions [lo, hi) of the pass's permutation
+type cascadeBlock struct {
+	pass, lo, hi int
+}
+
+// State of Bob's side of Cascade
+type cascadeCorrector struct {
+	conn  *Conn
+	key   *bitstring.BitString
+	perms [][]int
+	pos   [][]int // Inverse of each permutation, the position of each bit in each pass
+	sizes []int   // Block size of each pass
+	known map[cascadeBlock]int
+	stats *Stats
+}
+
+// Bob's side of Cascade, correcting [key] by asking Alice for parities
+func (c Cascade) Correct(conn *Conn, key *bitstring.BitString, seed int, qber float64,
+	stats *Stats) (*bitstring.BitString, error) {
+	return newCascadeCorrector(conn, key, seed, c.passes(), qber, stats).run()
+}
+
+func newCascadeCorrector(conn *Conn, key *bitstring.BitString, seed, passes int, qber float64,
+	stats *Stats) *cascadeCorrector {
+	n := key.Length
+	c := &cascadeCorrector{conn: conn, key: key.Copy(), perms: conn.permutations(seed, n, passes),
+		pos: make([][]int, passes), sizes: make([]int, passes), known: make(map[cascadeBlock]int), stats: stats}
+	for p, perm := range c.perms {
+		c.pos[p] = make([]int, n)
+		for i, j := range perm {
+			c.pos[p][j] = i
+		}
+		c.sizes[p] = cascadeBlockSize(qber, n) << uint(p)
+	}
+	return c
+}
+
+func (c *cascadeCorrector) run() (*bitstring.BitString, error) {
+	n := c.key.Length
+	for p := range c.perms {
+		// Learn the parity of every block of this pass, searching those that differ
+		if err := c.conn.Send(ParityRequest, encodeRequest(cascadeBlockParities, p, c.sizes[p], 0)); err != nil {
+			return nil, err
+		}
+		parities, err := c.conn.Receive(ParityReply)
+		if err != nil {
+			return nil, err
+		}
+		if parities.Length != (n+c.sizes[p]-1)/c.sizes[p] {
+			return nil, ErrMalformed
+		}
+		c.stats.reveal(parities.Length)
+
+		var odd []cascadeBlock
+		for i, parity := range parities.Data {
+			block := c.block(p, i*c.sizes[p])
+			c.known[block] = 0
+			if parity {
+				c.known[block] = 1
+			}
+			odd = append(odd, block)
+		}
+		if err := c.cascade(odd, p); err != nil {
+			return nil, err
+		}
+	}
+	return c.key, c.conn.Send(ParityRequest, encodeRequest(cascadeDone, 0, 0, 0))
+}
+
+// The block of pass [p] containing position [i]
+func (c *cascadeCorrector) block(p, i int) cascadeBlock {
+	lo := i / c.sizes[p] * c.sizes[p]
+	return cascadeBlock{p, lo, int(math.Min(float64(lo+c.sizes[p]), float64(c.key.Length)))}
+}
+
+// Searches each block of [odd] whose parity differs from Alice's, along with the blocks of passes up to [pass]
+// that each correction makes odd
+func (c *cascadeCorrector) cascade(odd []cascadeBlock, pass int) error {
+	for len(odd) > 0 {
+		block := odd[0]
+		odd = odd[1:]
+		if c.known[block] == rangeParity(c.key, c.perms[block.pass], block.lo, block.hi) {
+			continue
+		}
+		i, err := c.search(block)
+		if err != nil {
+			return err
+		}
+		c.key.Invert(i)
+		c.stats.Corrected++
+		for p := 0; p <= pass; p++ {
+			if p != block.pass {
+				odd = append(odd, c.block(p, c.pos[p][i]))
+			}
+		}
+	}
+	return nil
+}
+
+// Binary search for an error in [block], whose parity is known to differ from Alice's, returning its index in the key
+func (c *cascadeCorrector) search(block cascadeBlock) (int, error) {
+	perm := c.perms[block.pass]
+	lo, hi := block.lo, block.hi
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		parity, err := c.parity(cascadeBlock{block.pass, lo, mid})
+		if err != nil {
+			return 0, err
+		}
+		if parity != rangeParity(c.key, perm, lo, mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return perm[lo], nil
+}
+
+// Alice's parity of [block], asking her unless it is already known
+func (c *cascadeCorrector) parity(block cascadeBlock) (int, error) {
+	if parity, ok := c.known[block]; ok {
+		return parity, nil
+	}
+	if err := c.conn.Send(ParityRequest, encodeRequest(cascadeParity, block.pass, block.lo, block.hi)); err != nil {
+		return 0, err
+	}
+	reply, err := c.conn.Receive(ParityReply)
+	if err != nil {
+		return 0, err
+	}
+	if reply.Length != 1 {
+		return 0, ErrMalformed
+	}
+	c.stats.reveal(1)
+	c.known[block] = reply.Int()
+	return c.known[block], nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/privacyamplification"
+	"github.com/adamhosier/random/src/random"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	mode       = flag.String("mode", "local", "local runs both parties in this process, alice or bob runs just one")
+	verbose    = flag.Bool("v", true, "log the progress of the session")
+	length     = flag.Int("length", 512, "length of the secret in bits")
+	reconciler = flag.String("reconciler", "cascade", "reconciliation protocol, one of cascade, winnow or ldpc")
+	generator  = flag.String("generator", "innerprod", "configuration of the generator choosing the secret")
+	auth       = flag.Bool("auth", false, "authenticate the public channel with a key shared in advance, in local mode")
+	preshared  = flag.String("preshared", "", "at least 8 bytes of hex shared in advance, authenticating alice and bob")
+	network    = flag.String("network", "tcp", "network of the sockets, tcp or unix")
+	public     = flag.String("public", "", "address of the public channel, bob listening and alice connecting")
+	private    = flag.String("private", "", "address of the private channel, bob listening and alice connecting")
+	timeout    = flag.Duration("timeout", 30*time.Second, "longest to wait to connect, or for any message")
+	errorRate  = flag.Float64("p", 1.0/32, "rate at which alice corrupts bits sent over the private channel")
+	noise      = flag.String("noise", "bsc", "noise on the private channel, one of bsc, burst, erasure, indel or trace")
+	trace      = flag.String("trace", "", "file of zeros and ones marking the errors replayed by trace noise")
+	qkd        = flag.String("qkd", "", "quantum key distribution sending the secret as photons, bb84 or b92")
+	intercept  = flag.Float64("intercept", 0, "fraction of photons intercepted and resent by an eavesdropper")
+	eve        = flag.Float64("eve", 0, "error rate of an eavesdropper tapping alice's channels, or none if zero")
+	seed       = flag.Int("seed", 0, "seed of the noise, to reproduce a session, or seeded from the clock if zero")
+)
+
+// Listeners and channels closed on an interrupt
+var (
+	closing sync.Mutex
+	closers []io.Closer
+)
+
+// Default socket addresses of each network
+var addresses = map[string][2]string{
+	"tcp":  {"localhost:7301", "localhost:7302"},
+	"unix": {os.TempDir() + "/privacyamplification-public.sock", os.TempDir() + "/privacyamplification-private.sock"},
+}
+
+// Agrees a key between Alice and Bob, connected by a perfect public channel and a lossy private channel. In local mode
+// both run in this process over simulated links, otherwise each runs in its own process over sockets
+func main() {
+	flag.Parse()
+	config, err := configure()
+	if err != nil {
+		fail(err, 2)
+	}
+	defaults, ok := addresses[*network]
+	if !ok {
+		fail(fmt.Errorf("unknown network %q", *network), 2)
+	}
+	if *public == "" {
+		*public = defaults[0]
+	}
+	if *private == "" {
+		*private = defaults[1]
+	}
+
+	go closeOnInterrupt()
+
+	switch *mode {
+	case "local":
+		err = runLocal(config)
+	case "alice":
+		err = runAlice(config)
+	case "bob":
+		err = runBob(config)
+	default:
+		err = fmt.Errorf("unknown mode %q", *mode)
+	}
+	if err != nil {
+		fail(err, 1)
+	}
+}
+
+func fail(err error, code int) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
+
+// Fetches the configuration of a session from the flags
+func configure() (privacyamplification.Config, error) {
+	config := privacyamplification.Config{SecretLength: *length, QBER: *errorRate,
+		Generator: random.NewGeneratorFromConfig(*generator)}
+	switch *reconciler {
+	case "cascade":
+		config.Reconciler = privacyamplification.Cascade{}
+	case "winnow":
+		config.Reconciler = privacyamplification.Winnow{}
+	case "ldpc":
+		config.Reconciler = privacyamplification.LDPC{}
+	default:
+		return config, fmt.Errorf("unknown reconciler %q", *reconciler)
+	}
+	switch *qkd {
+	case "":
+	case "bb84":
+		config.Distributor = privacyamplification.BB84{}
+	case "b92":
+		config.Distributor = privacyamplification.B92{}
+	default:
+		return config, fmt.Errorf("unknown quantum key distribution %q", *qkd)
+	}
+	if *qkd != "" && *eve > 0 {
+		return config, fmt.Errorf("eve taps classical secrets, use -intercept to attack photons")
+	}
+	if *verbose {
+		config.Logger = log.New(os.Stdout, "", 0)
+	}
+	if *preshared != "" {
+		bytes, err := hex.DecodeString(*preshared)
+		if err != nil || len(bytes) < 8 {
+			return config, fmt.Errorf("preshared key must be at least 8 bytes of hex")
+		}
+		key, err := bitstring.BitStringFromBytes(&bytes)
+		if err != nil {
+			return config, err
+		}
+		config.Pool = privacyamplification.NewKeyPool(key)
+	}
+	return config, nil
+}
+
+// Closes everything registered once interrupted, so that a session in progress fails rather than leaving the other
+// party waiting
+func closeOnInterrupt() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	fmt.Fprintln(os.Stderr, "interrupted, closing channels")
+	closing.Lock()
+	defer closing.Unlock()
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// Registers [cs] to be closed on an interrupt
+func closeLater(cs ...io.Closer) {
+	closing.Lock()
+	defer closing.Unlock()
+	closers = append(closers, cs...)
+}
+
+// Fetches the noise model of the private channel from the flags
+func noiseModel() (privacyamplification.Noise, error) {
+	rng := random.NewGeneratorFromConfig("prng")
+	if *seed != 0 {
+		rng = random.NewGeneratorFromExtractable(random.NewPseudoRandomExtractor(*seed))
+	}
+	if *qkd != "" {
+		// Photons are corrupted in flight, and measured by Eve if she intercepts them
+		photons := privacyamplification.NewPhotonNoise(*errorRate, rng)
+		if *intercept <= 0 {
+			return photons, nil
+		}
+		return privacyamplification.Chain(privacyamplification.NewInterceptResend(*intercept, rng), photons), nil
+	}
+	switch *noise {
+	case "bsc":
+		return privacyamplification.NewBinarySymmetric(*errorRate, rng), nil
+	case "burst":
+		// Bursts of ten bits on average, a tenth as often as good stretches, giving an error rate of p overall
+		return privacyamplification.NewGilbertElliott(0.01, 0.1, 0, math.Min(0.5, 11**errorRate), rng), nil
+	case "erasure":
+		return privacyamplification.NewErasure(*errorRate, rng), nil
+	case "indel":
+		return privacyamplification.NewInsertionDeletion(*errorRate/2, *errorRate/2, rng), nil
+	case "trace":
+		f, err := os.Open(*trace)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return privacyamplification.ReadTrace(f)
+	}
+	return nil, fmt.Errorf("unknown noise %q", *noise)
+}
+
+// Taps Alice's channels with an eavesdropper, if one is configured
+func tap(config privacyamplification.Config, public, private privacyamplification.Channel) (
+	*privacyamplification.Eve, privacyamplification.Channel, privacyamplification.Channel) {
+	if *eve <= 0 {
+		return nil, public, private
+	}
+	e := privacyamplification.NewEve(config, *eve)
+	rng := random.NewGeneratorFromConfig("prng")
+	if *seed != 0 {
+		rng = random.NewGeneratorFromExtractable(random.NewPseudoRandomExtractor(*seed + 1))
+	}
+	return e, e.TapPublic(public), e.TapPrivate(private, privacyamplification.NewBinarySymmetric(*eve, rng))
+}
+
+// Reports what the eavesdropper learnt of the [key] Alice agreed
+func reportEve(e *privacyamplification.Eve, key *bitstring.BitString) error {
+	if e == nil {
+		return nil
+	}
+	k, err := e.Evaluate(key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("EVE: tapped the secret with error rate %.4f, then guessed it from %d parities with error rate %.4f, "+
+		"knowing %.1f bits\n", k.TapErrorRate, k.Equations, k.SecretErrorRate, k.SecretInformation)
+	fmt.Printf("EVE: guessed the key with error rate %.4f, knowing %.1f of %d bits\n", k.KeyErrorRate,
+		k.KeyInformation, key.Length)
+	return nil
+}
+
+// Reports the sifting of quantum key distribution, which shows an eavesdropper even if the session fails
+func reportSifting(stats privacyamplification.Stats) {
+	if stats.Photons > 0 {
+		fmt.Printf("SIFTED: %d bits from %d photons, finding %d errors in %d bits sampled\n", stats.Sifted,
+			stats.Photons, stats.SampleErrors, stats.Sampled)
+	}
+}
+
+func report(stats privacyamplification.Stats, secret *bitstring.BitString) {
+	fmt.Printf("DONE: agreed a %d bit key from %d bits, correcting %d errors in %d rounds and leaking %d bits\n",
+		stats.KeyLength, *length, stats.Corrected, stats.Rounds, stats.BitsLeaked)
+	if *mode != "local" {
+		fmt.Printf("KEY: %x\n", secret.Bytes())
+	}
+}
+
+// Runs Alice and Bob in this process, connected by a perfect public link and a lossy private link
+func runLocal(config privacyamplification.Config) error {
+	publicA, publicB := privacyamplification.NewPerfectLink()
+	privateA, privateB := privacyamplification.NewPerfectLink()
+	model, err := noiseModel()
+	if err != nil {
+		return err
+	}
+	e, tappedPublic, tappedPrivate := tap(config, publicA, privacyamplification.NewLossyChannel(privateA, model))
+	configA, configB := config, config
+	if *auth {
+		preshared := random.NewGeneratorFromConfig("prng").GetBits(192)
+		configA.Pool = privacyamplification.NewKeyPool(preshared)
+		configB.Pool = privacyamplification.NewKeyPool(preshared)
+	}
+	alice := privacyamplification.NewAlice(tappedPublic, tappedPrivate, configA)
+	bob := privacyamplification.NewBob(publicB, privateB, configB)
+	closeLater(publicA, privateA)
+
+	// Run both parties, waiting for each to finish
+	type result struct {
+		secret *bitstring.BitString
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		secret, err := alice.Run()
+		done <- result{secret, err}
+	}()
+	secret, err := bob.Run()
+	a := <-done
+	reportSifting(bob.Stats())
+	if err == nil {
+		err = a.err
+	}
+	if err != nil {
+		return err
+	}
+	if !a.secret.Equals(secret) {
+		return fmt.Errorf("secrets differ")
+	}
+	report(bob.Stats(), secret)
+	return reportEve(e, secret)
+}
+
+// Runs Alice, connecting to Bob and corrupting the bits she sends over the private channel
+func runAlice(config privacyamplification.Config) error {
+	publicCh, err := privacyamplification.Dial(*network, *public, *timeout)
+	if err != nil {
+		return err
+	}
+	defer publicCh.Close()
+	privateCh, err := privacyamplification.Dial(*network, *private, *timeout)
+	if err != nil {
+		return err
+	}
+	defer privateCh.Close()
+	closeLater(publicCh, privateCh)
+
+	model, err := noiseModel()
+	if err != nil {
+		return err
+	}
+	e, tappedPublic, tappedPrivate := tap(config, publicCh, privacyamplification.NewLossyChannel(privateCh, model))
+	alice := privacyamplification.NewAlice(tappedPublic, tappedPrivate, config)
+	secret, err := alice.Run()
+	reportSifting(alice.Stats())
+	if err != nil {
+		return err
+	}
+	report(alice.Stats(), secret)
+	return reportEve(e, secret)
+}
+
+// Runs Bob, waiting for Alice to connect to both channels
+func runBob(config privacyamplification.Config) error {
+	// Listen on both addresses before accepting either, so that Alice can connect to them in turn
+	var listeners [2]*privacyamplification.Listener
+	for i, address := range []string{*public, *private} {
+		if *network == "unix" {
+			os.Remove(address) // Left behind by an earlier run that was killed
+		}
+		l, err := privacyamplification.Listen(*network, address, *timeout)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		closeLater(l)
+		listeners[i] = l
+	}
+	publicCh, err := listeners[0].Accept()
+	if err != nil {
+		return err
+	}
+	defer publicCh.Close()
+	privateCh, err := listeners[1].Accept()
+	if err != nil {
+		return err
+	}
+	defer privateCh.Close()
+	closeLater(publicCh, privateCh)
+
+	bob := privacyamplification.NewBob(publicCh, privateCh, config)
+	secret, err := bob.Run()
+	reportSifting(bob.Stats())
+	if err != nil {
+		return err
+	}
+	report(bob.Stats(), secret)
+	return nil
+}
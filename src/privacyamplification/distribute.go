@@ -0,0 +1,35 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+)
+
+// Gives Alice a secret and Bob a noisy copy of it, before reconciliation corrects Bob's copy
+type Distributor interface {
+	// Alice's side, choosing an [n] bit secret with [rng]. Returns the secret, and the error rate of Bob's copy if it
+	// was estimated, or zero to assume the configured rate
+	Send(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString, float64,
+		error)
+	// Bob's side, returning his copy of the [n] bit secret, and the error rate estimated as for Send
+	Receive(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString, float64,
+		error)
+}
+
+// Alice sends the secret over the private channel as it is
+type Direct struct{}
+
+func (Direct) Send(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	secret := rng.GetBits(n)
+	if err := private.Send(secret); err != nil {
+		return nil, 0, err
+	}
+	return secret, 0, nil
+}
+
+func (Direct) Receive(conn *Conn, private Channel, rng *random.Generator, n int, stats *Stats) (*bitstring.BitString,
+	float64, error) {
+	secret, err := private.Receive()
+	return secret, 0, err
+}
@@ -0,0 +1,279 @@
+/* Eavesdropping on a session, to check that privacy amplification leaves Eve knowing next to nothing of the key.
+ *
+ * Eve taps the private channel, receiving her own noisy copy of the secret, and records every message on the public
+ * channel. Each parity Alice reveals, and the hash verifying the secret, is a linear equation over GF(2) on the secret,
+ * which Eve finds by replaying Bob's recorded requests to the reconciler with each unit vector in place of the secret.
+ * She then decodes her copy to the most likely secret satisfying the equations by belief propagation, as LDPC
+ * reconciliation does, and hashes her guess with the public matrix just as Alice and Bob do
+ */
+
+package privacyamplification
+
+import (
+	"errors"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"sync"
+)
+
+// Returned when Eve has not recorded a session that reached privacy amplification
+var ErrNoTranscript = errors.New("privacyamplification: no complete session recorded")
+
+// An eavesdropper on one session
+type Eve struct {
+	config Config  // Public parameters of the session
+	qber   float64 // Error rate of Eve's tap on the private channel
+
+	mu        sync.Mutex
+	tapped    *bitstring.BitString // Eve's copy of the secret
+	secret    *bitstring.BitString // The secret Alice sent, only used to score the attack
+	fromAlice []Message
+	fromBob   []Message
+}
+
+// Creates an eavesdropper on a session with the public parameters in [config], whose tap on the private channel has
+// error rate [qber]
+func NewEve(config Config, qber float64) *Eve {
+	return &Eve{config: config.withDefaults(), qber: qber}
+}
+
+// Taps Alice's end of the private channel [ch], giving Eve a copy of each message sent corrupted by [noise],
+// independently of the noise on the way to Bob
+func (e *Eve) TapPrivate(ch Channel, noise Noise) Channel {
+	return &privateTap{ch, noise, e}
+}
+
+// Taps Alice's end of the public channel [ch], recording the messages in each direction
+func (e *Eve) TapPublic(ch Channel) Channel {
+	return &publicTap{ch, e}
+}
+
+type privateTap struct {
+	Channel
+	noise Noise
+	eve   *Eve
+}
+
+func (t *privateTap) Send(bs *bitstring.BitString) error {
+	t.eve.mu.Lock()
+	t.eve.secret, t.eve.tapped = bs.Copy(), t.noise.Corrupt(bs)
+	t.eve.mu.Unlock()
+	return t.Channel.Send(bs)
+}
+
+type publicTap struct {
+	Channel
+	eve *Eve
+}
+
+// Records [bs] if it is the next message in its direction, skipping the authentication tags that follow the session
+func (e *Eve) record(messages *[]Message, bs *bitstring.BitString) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if m, err := DecodeMessage(bs); err == nil && m.Sequence == len(*messages) {
+		*messages = append(*messages, m)
+	}
+}
+
+func (t *publicTap) Send(bs *bitstring.BitString) error {
+	if err := t.Channel.Send(bs); err != nil {
+		return err
+	}
+	t.eve.record(&t.eve.fromAlice, bs)
+	return nil
+}
+
+func (t *publicTap) Receive() (*bitstring.BitString, error) {
+	bs, err := t.Channel.Receive()
+	if err == nil {
+		t.eve.record(&t.eve.fromBob, bs)
+	}
+	return bs, err
+}
+
+// Payloads of the messages of type [t] in [messages]
+func payloads(messages []Message, t MessageType) []*bitstring.BitString {
+	var found []*bitstring.BitString
+	for _, m := range messages {
+		if m.Type == t {
+			found = append(found, m.Payload)
+		}
+	}
+	return found
+}
+
+// Channel replaying Bob's recorded requests to Alice's side of a reconciler, collecting her replies
+type replay struct {
+	requests []*bitstring.BitString
+	received int // Requests replayed so far
+	replies  []*bitstring.BitString
+}
+
+func (r *replay) Send(bs *bitstring.BitString) error {
+	m, err := DecodeMessage(bs)
+	if err != nil {
+		return err
+	}
+	r.replies = append(r.replies, m.Payload)
+	return nil
+}
+
+func (r *replay) Receive() (*bitstring.BitString, error) {
+	if r.received == len(r.requests) {
+		return nil, ErrClosed
+	}
+	m := Message{ParityRequest, r.received, r.requests[r.received]}
+	r.received++
+	return m.Encode(), nil
+}
+
+func (r *replay) Close() error {
+	return nil
+}
+
+// Fetches the replies the reconciler gives to [requests] if the secret is [key], with reconciliation [seed], taking
+// its permutations and matrices from [codes]
+func (e *Eve) reveal(key *bitstring.BitString, requests []*bitstring.BitString, seed int,
+	codes *codeCache) ([]bool, error) {
+	r := &replay{requests: requests}
+	conn := NewConn(r, true)
+	conn.codes = codes
+	if err := e.config.Reconciler.Reveal(conn, key, seed, e.config.QBER, &Stats{}); err != nil {
+		return nil, err
+	}
+	var bits []bool
+	for _, reply := range r.replies {
+		bits = append(bits, reply.Data...)
+	}
+	return bits, nil
+}
+
+// Finds the linear equations on the [n] bit secret revealed on the public channel, as the matrix of parity checks and
+// the parities Alice revealed
+func (e *Eve) equations(n int) (*parityCheck, []bool, error) {
+	seeds := payloads(e.fromAlice, Seed)
+	checks := payloads(e.fromAlice, HashCheck)
+	if len(seeds) != 2 || len(checks) != 1 {
+		return nil, nil, ErrNoTranscript
+	}
+	seed, check := seeds[0].Int(), checks[0]
+	if check.Length != n+2*verifyBits-1 {
+		return nil, nil, ErrMalformed
+	}
+	requests := payloads(e.fromBob, ParityRequest)
+	var parities []bool
+	for _, reply := range payloads(e.fromAlice, ParityReply) {
+		parities = append(parities, reply.Data...)
+	}
+
+	// Each reply bit is a linear function of the secret, so the replies with a unit vector as the secret give the
+	// coefficients of that bit of the secret in every equation
+	h := &parityCheck{make([][]int, len(parities)), make([][]int, n)}
+	codes := newCodeCache()
+	for v := 0; v < n; v++ {
+		unit := bitstring.BitStringOfLength(n)
+		unit.Data[v] = true
+		replies, err := e.reveal(unit, requests, seed, codes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(replies) != len(parities) {
+			return nil, nil, ErrMalformed
+		}
+		for c, b := range replies {
+			if b {
+				h.checks[c] = append(h.checks[c], v)
+				h.bits[v] = append(h.bits[v], c)
+			}
+		}
+	}
+
+	// Row i of the Toeplitz hash has the diagonals of the matrix from i + n - 1 down
+	a, hash := check.Substring(0, n+verifyBits-1), check.Substring(n+verifyBits-1, verifyBits)
+	for i := 0; i < verifyBits; i++ {
+		c := len(h.checks)
+		h.checks = append(h.checks, nil)
+		for v := 0; v < n; v++ {
+			if a.Data[i-v+n-1] {
+				h.checks[c] = append(h.checks[c], v)
+				h.bits[v] = append(h.bits[v], c)
+			}
+		}
+	}
+	return h, append(parities, hash.Data...), nil
+}
+
+// Eve's guess at the secret and the key amplified from it, using everything she recorded
+func (e *Eve) Attack() (secret, key *bitstring.BitString, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	secret, key, _, err = e.attack()
+	return secret, key, err
+}
+
+// Guesses the secret and key, also returning the number of equations used
+func (e *Eve) attack() (secret, key *bitstring.BitString, equations int, err error) {
+	if e.tapped == nil {
+		return nil, nil, 0, ErrNoTranscript
+	}
+	n := e.tapped.Length
+	h, parities, err := e.equations(n)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	qber := math.Max(e.qber, 1.0/float64(n)) // A tap without errors still needs a finite prior
+	guess, _ := h.decode(e.tapped.Data, parities, qber, defaultLDPCIterations)
+	secret = &bitstring.BitString{Length: n, Data: guess}
+
+	matrix := payloads(e.fromAlice, Seed)[1]
+	length := matrix.Length - n + 1
+	if length <= 0 {
+		return nil, nil, 0, ErrMalformed
+	}
+	return secret, Amplify(secret, matrix, length), len(parities), nil
+}
+
+// How much Eve knows of the secret and the key agreed from it
+type Knowledge struct {
+	Equations         int     // Parities of the secret revealed on the public channel, with the verification hash
+	TapErrorRate      float64 // Error rate of Eve's copy of the secret from the private channel
+	SecretErrorRate   float64 // Error rate of her guess at the secret, once corrected with the parities
+	SecretInformation float64 // Bits of the secret she knows, estimated from her error rate
+	KeyErrorRate      float64 // Error rate of her guess at the key
+	KeyInformation    float64 // Bits of the key she knows, estimated from her error rate
+}
+
+// Error rate of [guess] at [actual]
+func errorRate(guess, actual *bitstring.BitString) float64 {
+	return float64(differences(guess, actual)) / float64(actual.Length)
+}
+
+// Bits known of [n] bits guessed with error rate [p], the mutual information of a binary symmetric channel
+func information(n int, p float64) float64 {
+	return float64(n) * (1 - BinaryEntropy(p))
+}
+
+// Attacks the session and scores Eve's guess against the agreed [key]. If the session was authenticated, the key is
+// the end of the amplified secret, the start having gone to the authentication pool
+func (e *Eve) Evaluate(key *bitstring.BitString) (Knowledge, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	secret, guess, equations, err := e.attack()
+	if err != nil {
+		return Knowledge{}, err
+	}
+	if guess.Length < key.Length {
+		return Knowledge{}, ErrMalformed
+	}
+	guess = guess.Substring(guess.Length-key.Length, key.Length)
+
+	k := Knowledge{
+		Equations:       equations,
+		TapErrorRate:    errorRate(e.tapped, e.secret),
+		SecretErrorRate: errorRate(secret, e.secret),
+		KeyErrorRate:    errorRate(guess, key),
+	}
+	k.SecretInformation = information(secret.Length, k.SecretErrorRate)
+	k.KeyInformation = information(key.Length, k.KeyErrorRate)
+	return k, nil
+}
@@ -0,0 +1,95 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"testing"
+)
+
+// Runs a session with a [secretLength] bit secret over a private channel with error rate [p], tapped by Eve with error
+// rate [q], returning her and Bob's stats and key
+func eavesdrop(t *testing.T, r Reconciler, secretLength int, p, q float64) (*Eve, Stats, *bitstring.BitString) {
+	config := Config{SecretLength: secretLength, Reconciler: r}
+	eve := NewEve(config, q)
+	publicA, publicB := NewPerfectLink()
+	privateA, privateB := seededLossyLink(p, 1)
+	configA, configB := config, config
+	configA.Generator, configB.Generator = seeded(2), seeded(3)
+	alice := NewAlice(eve.TapPublic(publicA), eve.TapPrivate(privateA, NewBinarySymmetric(q, seeded(4))), configA)
+	bob := NewBob(publicB, privateB, configB)
+	_, key, errA, errB := runSession(alice, bob)
+	if errA != nil || errB != nil {
+		t.Fatalf("Session with %T failed with %v, %v", r, errA, errB)
+	}
+	return eve, bob.Stats(), key
+}
+
+func TestEveEquations(t *testing.T) {
+	for _, r := range []Reconciler{Cascade{}, Winnow{}, LDPC{}} {
+		eve, stats, _ := eavesdrop(t, r, 512, defaultBitCorruptionRate, defaultBitCorruptionRate)
+		h, parities, err := eve.equations(512)
+		if err != nil {
+			t.Fatalf("Eve.equations() with %T failed with %v", r, err)
+		}
+		if len(parities) != stats.BitsLeaked {
+			t.Errorf("Eve found %d equations with %T, want %d", len(parities), r, stats.BitsLeaked)
+		}
+		// The secret Alice sent satisfies every equation
+		if !equalBits(h.syndrome(eve.secret.Data), parities) {
+			t.Errorf("Eve found equations with %T that the secret does not satisfy", r)
+		}
+	}
+}
+
+func TestEve(t *testing.T) {
+	tests := []struct {
+		r       Reconciler
+		q       float64
+		decodes bool // Whether Eve learns the whole key
+	}{
+		{Cascade{}, defaultBitCorruptionRate, false},
+		{Winnow{}, defaultBitCorruptionRate, false},
+		{Cascade{}, 0.1, false},
+		{Winnow{}, 0.1, false},
+		{LDPC{}, 0.1, false},
+		// One-way syndromes let anyone with a channel as good as Bob's decode the secret as he does
+		{LDPC{}, defaultBitCorruptionRate, true},
+	}
+	for _, test := range tests {
+		eve, _, key := eavesdrop(t, test.r, 1024, defaultBitCorruptionRate, test.q)
+		k, err := eve.Evaluate(key)
+		if err != nil {
+			t.Fatalf("Eve.Evaluate() with %T failed with %v", test.r, err)
+		}
+		if math.Abs(k.TapErrorRate-test.q) > 0.02 || k.Equations == 0 {
+			t.Errorf("Eve tapped with %T at error rate %g gave %+v", test.r, test.q, k)
+		}
+		if test.decodes {
+			if k.SecretErrorRate != 0 || k.KeyErrorRate != 0 {
+				t.Errorf("Eve tapped with %T at error rate %g failed to decode, giving %+v", test.r, test.q, k)
+			}
+			continue
+		}
+		// Amplification leaves Eve guessing at the key
+		if math.Abs(k.KeyErrorRate-0.5) > 0.1 || k.KeyInformation > 0.05*float64(key.Length) {
+			t.Errorf("Eve tapped with %T at error rate %g knows %.1f of %d bits of the key, with error rate %g",
+				test.r, test.q, k.KeyInformation, key.Length, k.KeyErrorRate)
+		}
+	}
+}
+
+func TestEveNoiseless(t *testing.T) {
+	// A tap without noise breaks the assumption behind the estimate of Eve's information, which evaluation shows
+	eve, _, key := eavesdrop(t, nil, 512, defaultBitCorruptionRate, 0)
+	k, err := eve.Evaluate(key)
+	if err != nil {
+		t.Fatalf("Eve.Evaluate() failed with %v", err)
+	}
+	if k.SecretErrorRate != 0 || k.KeyErrorRate != 0 || k.KeyInformation != float64(key.Length) {
+		t.Errorf("Eve with a perfect tap gave %+v", k)
+	}
+
+	if _, err := NewEve(Config{}, 0).Evaluate(key); err != ErrNoTranscript {
+		t.Errorf("Eve.Evaluate() without a session gave %v, want ErrNoTranscript", err)
+	}
+}
@@ -0,0 +1,266 @@
+/* One-way information reconciliation with low density parity check codes, described in
+ * D. Elkouss, A. Leverrier, R. Alleaume and J. J. Boutros, Efficient reconciliation protocol for discrete-variable
+ * quantum key distribution, ISIT 2009
+ *
+ * The key is split into frames, and Alice reveals the syndrome of each frame under a sparse parity check matrix in a
+ * single message. Bob decodes his copy of each frame to the nearest word with Alice's syndrome by belief propagation,
+ * which needs no further discussion, but fails outright if the code rate is too high for the errors in a frame
+ */
+
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"math"
+)
+
+const (
+	defaultLDPCFrameSize  = 4096
+	defaultLDPCIterations = 100
+	defaultLDPCEfficiency = 2.0 // Efficiency f the default code rate aims for, leaking f h(qber) bits per key bit
+	ldpcColumnWeight      = 3   // Checks each bit of a frame takes part in
+	ldpcMaxLLR            = 30  // Bound on log likelihood ratios, keeping belief propagation finite
+)
+
+// One-way LDPC reconciliation, which takes a single round
+type LDPC struct {
+	Rate       float64 // Code rate, revealing 1 - Rate syndrome bits per key bit. Zero chooses a rate from the error rate
+	FrameSize  int     // Bits of the key in each frame, zero is replaced by a default
+	Iterations int     // Rounds of belief propagation before decoding a frame fails, zero is replaced by a default
+}
+
+// Code rate for a key with error rate [qber]
+func (l LDPC) rate(qber float64) float64 {
+	if l.Rate > 0 {
+		return l.Rate
+	}
+	return math.Max(0, 1-defaultLDPCEfficiency*BinaryEntropy(qber))
+}
+
+func (l LDPC) frameSize() int {
+	if l.FrameSize <= 0 {
+		return defaultLDPCFrameSize
+	}
+	return l.FrameSize
+}
+
+func (l LDPC) iterations() int {
+	if l.Iterations <= 0 {
+		return defaultLDPCIterations
+	}
+	return l.Iterations
+}
+
+// Sparse parity check matrix, as the bits in each check and the checks on each bit
+type parityCheck struct {
+	checks [][]int
+	bits   [][]int
+}
+
+// Parity check matrix for a reconciliation over [c], taken from its cache if it has one
+func (c *Conn) parityCheck(n, m, seed int) *parityCheck {
+	if c.codes == nil {
+		return newParityCheck(n, m, seed)
+	}
+	key := [3]int{n, m, seed}
+	h, ok := c.codes.checks[key]
+	if !ok {
+		h = newParityCheck(n, m, seed)
+		c.codes.checks[key] = h
+	}
+	return h
+}
+
+// Creates a parity check matrix of [m] checks over [n] bits, each bit taking part in up to ldpcColumnWeight checks
+// spread evenly over the checks, at random from a prng seeded with [seed]
+func newParityCheck(n, m, seed int) *parityCheck {
+	h := &parityCheck{make([][]int, m), make([][]int, n)}
+	if m == 0 {
+		return h
+	}
+
+	// Deal out sockets on the checks at random, dropping repeated edges
+	sockets := make([]int, n*ldpcColumnWeight)
+	for i := range sockets {
+		sockets[i] = i % m
+	}
+	rng := random.NewGeneratorFromExtractable(random.NewPseudoRandomExtractor(seed))
+	for i := len(sockets) - 1; i > 0; i-- {
+		j := rng.NextIntBetween(0, i+1)
+		sockets[i], sockets[j] = sockets[j], sockets[i]
+	}
+	for v := range h.bits {
+	edges:
+		for _, c := range sockets[v*ldpcColumnWeight : (v+1)*ldpcColumnWeight] {
+			for _, seen := range h.bits[v] {
+				if seen == c {
+					continue edges
+				}
+			}
+			h.bits[v] = append(h.bits[v], c)
+			h.checks[c] = append(h.checks[c], v)
+		}
+	}
+	return h
+}
+
+// Syndrome of [word] under the matrix
+func (h *parityCheck) syndrome(word []bool) []bool {
+	syndrome := make([]bool, len(h.checks))
+	for c, bits := range h.checks {
+		for _, v := range bits {
+			syndrome[c] = syndrome[c] != word[v]
+		}
+	}
+	return syndrome
+}
+
+// Decodes [word], received over a channel with error rate [qber], to the most likely word with [syndrome] by
+// belief propagation. Returns the decoded word, and whether its syndrome matched within [iterations]
+func (h *parityCheck) decode(word, syndrome []bool, qber float64, iterations int) ([]bool, bool) {
+	// Log likelihood ratios of each bit being zero, from the channel and passed along each edge
+	prior := math.Log((1 - qber) / qber)
+	channel := make([]float64, len(word))
+	for v, b := range word {
+		channel[v] = prior
+		if b {
+			channel[v] = -prior
+		}
+	}
+	toCheck := make([][]float64, len(h.checks))
+	toBit := make([][]float64, len(h.checks))
+	for c, bits := range h.checks {
+		toCheck[c] = make([]float64, len(bits))
+		toBit[c] = make([]float64, len(bits))
+		for e, v := range bits {
+			toCheck[c][e] = channel[v]
+		}
+	}
+
+	decoded := make([]bool, len(word))
+	copy(decoded, word)
+	for i := 0; i < iterations; i++ {
+		if equalBits(h.syndrome(decoded), syndrome) {
+			return decoded, true
+		}
+
+		// Each check tells each bit what the others and the syndrome imply, leaving that bit's own message out
+		for c := range h.checks {
+			messages := toCheck[c]
+			forward := make([]float64, len(messages)+1)
+			forward[0] = 1
+			for e, m := range messages {
+				forward[e+1] = forward[e] * math.Tanh(m/2)
+			}
+			backward := 1.0
+			if syndrome[c] {
+				backward = -1
+			}
+			for e := len(messages) - 1; e >= 0; e-- {
+				toBit[c][e] = boundLLR(2 * math.Atanh(forward[e]*backward))
+				backward *= math.Tanh(messages[e] / 2)
+			}
+		}
+
+		// Each bit combines the channel with its checks, and tells each check what the others said
+		beliefs := make([]float64, len(word))
+		copy(beliefs, channel)
+		for c, bits := range h.checks {
+			for e, v := range bits {
+				beliefs[v] += toBit[c][e]
+			}
+		}
+		for c, bits := range h.checks {
+			for e, v := range bits {
+				toCheck[c][e] = boundLLR(beliefs[v] - toBit[c][e])
+			}
+		}
+		for v, belief := range beliefs {
+			decoded[v] = belief < 0
+		}
+	}
+	return decoded, equalBits(h.syndrome(decoded), syndrome)
+}
+
+func boundLLR(llr float64) float64 {
+	return math.Max(-ldpcMaxLLR, math.Min(ldpcMaxLLR, llr))
+}
+
+func equalBits(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Parity check matrices for each frame of a key of length [n] reconciled over [conn], full frames sharing one matrix
+func (l LDPC) codes(conn *Conn, n, seed int, qber float64) []*parityCheck {
+	rate, size := l.rate(qber), l.frameSize()
+	var codes []*parityCheck
+	var full *parityCheck
+	for lo := 0; lo < n; lo += size {
+		length := int(math.Min(float64(size), float64(n-lo)))
+		checks := int(math.Ceil(float64(length) * (1 - rate)))
+		if length < size {
+			codes = append(codes, conn.parityCheck(length, checks, seed+1))
+			break
+		}
+		if full == nil {
+			full = conn.parityCheck(length, checks, seed)
+		}
+		codes = append(codes, full)
+	}
+	return codes
+}
+
+// Alice's side of LDPC reconciliation, revealing the syndrome of every frame of her [key] in a single message
+func (l LDPC) Reveal(conn *Conn, key *bitstring.BitString, seed int, qber float64, stats *Stats) error {
+	syndromes := bitstring.NewBitString()
+	size := l.frameSize()
+	for f, code := range l.codes(conn, key.Length, seed, qber) {
+		frame := key.Data[f*size : f*size+len(code.bits)]
+		syndromes.Data = append(syndromes.Data, code.syndrome(frame)...)
+	}
+	syndromes.Length = len(syndromes.Data)
+	if err := conn.Send(ParityReply, syndromes); err != nil {
+		return err
+	}
+	stats.reveal(syndromes.Length)
+	return nil
+}
+
+// Bob's side of LDPC reconciliation, decoding each frame of [key] with Alice's syndromes. A frame that fails to
+// decode is left as received, for verification of the key to catch
+func (l LDPC) Correct(conn *Conn, key *bitstring.BitString, seed int, qber float64,
+	stats *Stats) (*bitstring.BitString, error) {
+	syndromes, err := conn.Receive(ParityReply)
+	if err != nil {
+		return nil, err
+	}
+	codes := l.codes(conn, key.Length, seed, qber)
+	total := 0
+	for _, code := range codes {
+		total += len(code.checks)
+	}
+	if syndromes.Length != total {
+		return nil, ErrMalformed
+	}
+	stats.reveal(syndromes.Length)
+
+	corrected := key.Copy()
+	size, start := l.frameSize(), 0
+	qber = math.Max(qber, 1/float64(key.Length+1))
+	for f, code := range codes {
+		frame := corrected.Data[f*size : f*size+len(code.bits)]
+		if decoded, ok := code.decode(frame, syndromes.Data[start:start+len(code.checks)], qber,
+			l.iterations()); ok {
+			copy(frame, decoded)
+		}
+		start += len(code.checks)
+	}
+	stats.Corrected += differences(corrected, key)
+	return corrected, nil
+}
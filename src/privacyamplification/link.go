@@ -1,61 +1,103 @@
-package main
+package privacyamplification
 
 import (
+	"errors"
 	"github.com/adamhosier/random/src/bitstring"
 	"github.com/adamhosier/random/src/random"
+	"sync"
 )
 
 const (
 	defaultBitCorruptionRate = 1.0 / 32.0 // Rate at which bits are flipped when sending over a lossy link [0..1]
 )
 
-// Perfect p2p link, no messages are lost
-type PerfectLink struct {
-	ch chan *bitstring.BitString
+// Returned by a channel once either end has been closed
+var ErrClosed = errors.New("privacyamplification: channel closed")
+
+// One end of a link between Alice and Bob, used both for the public channel and the private channel
+type Channel interface {
+	Send(bs *bitstring.BitString) error
+	Receive() (*bitstring.BitString, error)
+	Close() error // Closes the link, so that blocked and later calls at either end fail with ErrClosed
 }
 
-func NewPerfectLink() *PerfectLink {
-	return &PerfectLink{make(chan *bitstring.BitString)}
+// One end of a perfect p2p link, no messages are lost
+type PerfectLink struct {
+	in     <-chan *bitstring.BitString
+	out    chan<- *bitstring.BitString
+	closed chan struct{} // Closed once either end is closed
+	once   *sync.Once
 }
 
-func (pl *PerfectLink) Send(bs *bitstring.BitString) {
-	pl.ch <- bs
+// Creates the two ends of a perfect link
+func NewPerfectLink() (*PerfectLink, *PerfectLink) {
+	ab := make(chan *bitstring.BitString)
+	ba := make(chan *bitstring.BitString)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+	return &PerfectLink{ba, ab, closed, once}, &PerfectLink{ab, ba, closed, once}
 }
 
-func (pl *PerfectLink) Send0() {
-	pl.Send(bitstring.BitStringFromInt(1, 0))
+// Sends [bs] to the other end, blocking until it is received
+func (pl *PerfectLink) Send(bs *bitstring.BitString) error {
+	select {
+	case pl.out <- bs:
+		return nil
+	case <-pl.closed:
+		return ErrClosed
+	}
 }
 
-func (pl *PerfectLink) Send1() {
-	pl.Send(bitstring.BitStringFromInt(1, 1))
+func (pl *PerfectLink) Receive() (*bitstring.BitString, error) {
+	select {
+	case bs := <-pl.in:
+		return bs, nil
+	case <-pl.closed:
+		return nil, ErrClosed
+	}
 }
 
-func (pl *PerfectLink) Receive() *bitstring.BitString {
-	return <-pl.ch
+func (pl *PerfectLink) Close() error {
+	pl.once.Do(func() { close(pl.closed) })
+	return nil
 }
 
-// Simulated lossy link, messges sent over these have a probability [p] of being lost
+// One end of a simulated lossy link, corrupting each message sent over it with a noise model
 type LossyLink struct {
-	ch  chan *bitstring.BitString
-	p   float64
-	rng *random.Generator
+	Channel
+	noise Noise
 }
 
-func NewLossyLink() *LossyLink {
-	return &LossyLink{make(chan *bitstring.BitString), defaultBitCorruptionRate, random.NewGeneratorFromConfig("prng")}
+// Creates the two ends of a lossy link, flipping bits at the default rate
+func NewLossyLink() (*LossyLink, *LossyLink) {
+	a, b := NewPerfectLink()
+	return NewLossyChannel(a, NewBinarySymmetric(defaultBitCorruptionRate, random.NewGeneratorFromConfig("prng"))),
+		NewLossyChannel(b, NewBinarySymmetric(defaultBitCorruptionRate, random.NewGeneratorFromConfig("prng")))
 }
 
-func (ll *LossyLink) Send(bs *bitstring.BitString) {
-	// Simulate corruption of message
-	cp := bs.Copy()
-	for i := 0; i < bs.Length; i++ {
-		if ll.rng.NextNormalizedFloat() < ll.p {
-			cp.Invert(i)
-		}
-	}
-	ll.ch <- cp
+// Makes [ch] lossy, corrupting each message sent over it with [noise], which must not be shared with another link
+func NewLossyChannel(ch Channel, noise Noise) *LossyLink {
+	return &LossyLink{ch, noise}
+}
+
+func (ll *LossyLink) Send(bs *bitstring.BitString) error {
+	return ll.Channel.Send(ll.noise.Corrupt(bs))
+}
+
+// One end of a link controlled by an active adversary, who may rewrite each message sent from this end
+type TamperingLink struct {
+	Channel
+	tamper func(i int, bs *bitstring.BitString) *bitstring.BitString
+	sent   int
+}
+
+// Wraps [ch] so that the [i]th message sent is replaced by tamper(i, message), which is given a copy to modify
+func NewTamperingLink(ch Channel, tamper func(i int, bs *bitstring.BitString) *bitstring.BitString) *TamperingLink {
+	return &TamperingLink{ch, tamper, 0}
 }
 
-func (ll *LossyLink) Receive() *bitstring.BitString {
-	return <-ll.ch
+func (tl *TamperingLink) Send(bs *bitstring.BitString) error {
+	tampered := tl.tamper(tl.sent, bs.Copy())
+	tl.sent++
+	return tl.Channel.Send(tampered)
 }
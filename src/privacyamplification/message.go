@@ -0,0 +1,258 @@
+package privacyamplification
+
+import (
+	"errors"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"time"
+)
+
+const (
+	protocolVersion    = 2 // Latest version of the message protocol
+	minProtocolVersion = 1 // Earliest version still spoken
+	siftingVersion     = 2 // Earliest version with the Bases and Sample messages of quantum key distribution
+	versionBits        = 8
+	typeBits           = 4
+	sequenceBits       = 32
+	reasonBits         = 8
+	abortTimeout       = 100 * time.Millisecond // Time given to the other party to receive an Abort before closing
+)
+
+// Type of a message on the public channel
+type MessageType int
+
+const (
+	Hello         MessageType = iota // Versions spoken by the initiator, or the version chosen by the responder
+	Seed                             // Public randomness chosen by Alice
+	ParityRequest                    // Bob's request for information about Alice's key
+	ParityReply                      // Parities or syndromes of Alice's key
+	HashCheck                        // Hash of Alice's key, with the seed of the hash
+	Status                           // Bob's agreement with the hash, and the errors he corrected
+	Abort                            // The session has failed, with the reason
+	Bases                            // Bob's measurement bases, or which of them match Alice's, when sifting
+	Sample                           // Bits disclosed to estimate the error rate of the sifted key
+)
+
+var messageTypeNames = []string{"Hello", "Seed", "ParityRequest", "ParityReply", "HashCheck", "Status", "Abort",
+	"Bases", "Sample"}
+
+func (t MessageType) String() string {
+	if t < 0 || int(t) >= len(messageTypeNames) {
+		return fmt.Sprintf("MessageType(%d)", int(t))
+	}
+	return messageTypeNames[t]
+}
+
+// Errors sent in Abort messages, so that the other party fails with the same error
+var (
+	ErrMalformed = errors.New("privacyamplification: malformed message")
+	ErrVersion   = errors.New("privacyamplification: no protocol version in common")
+)
+
+// Reasons carried by Abort messages
+const (
+	reasonMalformed = iota
+	reasonNoAgreement
+	reasonVersion
+	reasonAuthentication
+)
+
+// Error each reason stands for
+var abortReasons = []error{ErrMalformed, ErrNoAgreement, ErrVersion, &AuthenticationError{}}
+
+// Reason to give the other end for failing with [err], if it is one the other end would not otherwise learn of
+func abortReason(err error) (int, bool) {
+	switch err.(type) {
+	case *UnexpectedMessageError:
+		return reasonMalformed, true
+	case *AuthenticationError:
+		return reasonAuthentication, true
+	}
+	switch err {
+	case ErrMalformed:
+		return reasonMalformed, true
+	case ErrNoAgreement:
+		return reasonNoAgreement, true
+	case ErrVersion:
+		return reasonVersion, true
+	}
+	return 0, false
+}
+
+// Returned when the other party aborts the session, wrapping the reason it gave
+type AbortError struct {
+	Reason error
+}
+
+func (e *AbortError) Error() string {
+	return "privacyamplification: aborted by the other party: " + e.Reason.Error()
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Reason
+}
+
+// Returned when a message arrives out of turn
+type UnexpectedMessageError struct {
+	Got      MessageType
+	Want     MessageType
+	Sequence int // Sequence number of the message
+	Expected int // Sequence number expected
+}
+
+func (e *UnexpectedMessageError) Error() string {
+	if e.Sequence != e.Expected {
+		return fmt.Sprintf("privacyamplification: received message %d, want %d", e.Sequence, e.Expected)
+	}
+	return fmt.Sprintf("privacyamplification: received %v message %d, want %v", e.Got, e.Sequence, e.Want)
+}
+
+// Message on the public channel, numbered in sequence in each direction
+type Message struct {
+	Type     MessageType
+	Sequence int
+	Payload  *bitstring.BitString
+}
+
+// Encodes the message as its type and sequence number, followed by the payload
+func (m Message) Encode() *bitstring.BitString {
+	bs := bitstring.BitStringFromInt(typeBits, int(m.Type))
+	bs = bs.Extend(bitstring.BitStringFromInt(sequenceBits, m.Sequence))
+	return bs.Extend(m.Payload)
+}
+
+// Decodes a message encoded by Encode
+func DecodeMessage(bs *bitstring.BitString) (Message, error) {
+	header := typeBits + sequenceBits
+	if bs.Length < header {
+		return Message{}, ErrMalformed
+	}
+	m := Message{MessageType(bs.Substring(0, typeBits).Int()), bs.Substring(typeBits, sequenceBits).Int(),
+		bs.Substring(header, bs.Length-header)}
+	if int(m.Type) >= len(messageTypeNames) {
+		return Message{}, ErrMalformed
+	}
+	return m, nil
+}
+
+// A connection exchanging typed messages over a Channel. One end must be the [initiator] of version negotiation
+type Conn struct {
+	ch        Channel
+	initiator bool
+	version   int
+	sent      int // Sequence number of the next message sent
+	received  int // Sequence number of the next message expected
+
+	codes *codeCache // Permutations and matrices shared by replays of a reconciliation, nil to compute them afresh
+}
+
+// Creates a connection over [ch], speaking the latest version until negotiated otherwise
+func NewConn(ch Channel, initiator bool) *Conn {
+	return &Conn{ch: ch, initiator: initiator, version: protocolVersion}
+}
+
+// Version of the protocol spoken
+func (c *Conn) Version() int {
+	return c.version
+}
+
+// Agrees the protocol version with the other end. The initiator offers the versions it speaks, and the other end
+// chooses the latest it also speaks, aborting with ErrVersion if there is none
+func (c *Conn) Negotiate() error {
+	if c.initiator {
+		offer := bitstring.BitStringFromInt(versionBits, minProtocolVersion).Extend(
+			bitstring.BitStringFromInt(versionBits, protocolVersion))
+		if err := c.Send(Hello, offer); err != nil {
+			return err
+		}
+		reply, err := c.Receive(Hello)
+		if err != nil {
+			return err
+		}
+		if reply.Length != versionBits {
+			return ErrMalformed
+		}
+		version := reply.Int()
+		if version < minProtocolVersion || version > protocolVersion {
+			return ErrVersion
+		}
+		c.version = version
+		return nil
+	}
+
+	offer, err := c.Receive(Hello)
+	if err != nil {
+		return err
+	}
+	if offer.Length != 2*versionBits {
+		return ErrMalformed
+	}
+	low, high := offer.Substring(0, versionBits).Int(), offer.Substring(versionBits, versionBits).Int()
+	if high < minProtocolVersion || low > protocolVersion {
+		return ErrVersion
+	}
+	if high < c.version {
+		c.version = high
+	}
+	return c.Send(Hello, bitstring.BitStringFromInt(versionBits, c.version))
+}
+
+// Sends a message of type [t] carrying [payload]
+func (c *Conn) Send(t MessageType, payload *bitstring.BitString) error {
+	if err := c.ch.Send(Message{t, c.sent, payload}.Encode()); err != nil {
+		return err
+	}
+	c.sent++
+	return nil
+}
+
+// Receives the next message, which must be of type [want], returning its payload. An Abort from the other end is
+// returned as an AbortError, and any other message out of turn as an UnexpectedMessageError
+func (c *Conn) Receive(want MessageType) (*bitstring.BitString, error) {
+	bs, err := c.ch.Receive()
+	if err != nil {
+		return nil, err
+	}
+	m, err := DecodeMessage(bs)
+	if err != nil {
+		return nil, err
+	}
+	if m.Sequence != c.received {
+		return nil, &UnexpectedMessageError{m.Type, want, m.Sequence, c.received}
+	}
+	c.received++
+	if m.Type == Abort && want != Abort {
+		reason := m.Payload.Int()
+		if m.Payload.Length != reasonBits || reason >= len(abortReasons) {
+			return nil, &AbortError{ErrMalformed}
+		}
+		return nil, &AbortError{abortReasons[reason]}
+	}
+	if m.Type != want {
+		return nil, &UnexpectedMessageError{m.Type, want, m.Sequence, c.received - 1}
+	}
+	return m.Payload, nil
+}
+
+// Closes the underlying channel
+func (c *Conn) Close() error {
+	return c.ch.Close()
+}
+
+// Tells the other end the session failed with [err], if it is one the other end would not otherwise learn of, giving
+// it a short time to receive the Abort
+func (c *Conn) Abort(err error) {
+	reason, ok := abortReason(err)
+	if !ok {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Send(Abort, bitstring.BitStringFromInt(reasonBits, reason))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(abortTimeout):
+	}
+}
@@ -0,0 +1,123 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"testing"
+)
+
+func TestMessageEncoding(t *testing.T) {
+	for _, m := range []Message{
+		{Hello, 0, bitstring.BitStringFromInt(16, 0x0101)},
+		{ParityReply, 12345, seeded(1).GetBits(100)},
+		{Abort, 7, bitstring.NewBitString()},
+	} {
+		got, err := DecodeMessage(m.Encode())
+		if err != nil || got.Type != m.Type || got.Sequence != m.Sequence || !got.Payload.Equals(m.Payload) {
+			t.Errorf("DecodeMessage(%v.Encode()) == %v, %v", m, got, err)
+		}
+	}
+	if _, err := DecodeMessage(bitstring.BitStringFromInt(8, 0)); err != ErrMalformed {
+		t.Errorf("DecodeMessage() of a short message failed with %v, want ErrMalformed", err)
+	}
+	if _, err := DecodeMessage(bitstring.BitStringFromInt(typeBits+sequenceBits, 15<<sequenceBits)); err != ErrMalformed {
+		t.Errorf("DecodeMessage() of an unknown type failed with %v, want ErrMalformed", err)
+	}
+}
+
+// Runs [a] and [b] on each end of a perfect link, returning their errors
+func converse(a, b func(*Conn) error) (errA, errB error) {
+	endA, endB := NewPerfectLink()
+	connA, connB := NewConn(endA, true), NewConn(endB, false)
+	done := make(chan struct{})
+	go func() {
+		if errA = a(connA); errA != nil {
+			connA.Abort(errA)
+			connA.Close()
+		}
+		close(done)
+	}()
+	if errB = b(connB); errB != nil {
+		connB.Abort(errB)
+		connB.Close()
+	}
+	<-done
+	return
+}
+
+func TestConn(t *testing.T) {
+	payload := bitstring.BitStringFromInt(8, 0xA5)
+
+	// Messages arrive in turn once a version is agreed
+	errA, errB := converse(func(c *Conn) error {
+		if err := c.Negotiate(); err != nil {
+			return err
+		}
+		return c.Send(Seed, payload)
+	}, func(c *Conn) error {
+		if err := c.Negotiate(); err != nil {
+			return err
+		}
+		got, err := c.Receive(Seed)
+		if err == nil && (!got.Equals(payload) || c.Version() != protocolVersion) {
+			t.Errorf("Conn.Receive() == %v with version %d, want %v", got, c.Version(), payload)
+		}
+		return err
+	})
+	if errA != nil || errB != nil {
+		t.Errorf("Conversation failed with %v, %v", errA, errB)
+	}
+
+	// A message out of turn fails the receiver, which tells the sender rather than leaving it waiting
+	errA, errB = converse(func(c *Conn) error {
+		if err := c.Send(Status, payload); err != nil {
+			return err
+		}
+		_, err := c.Receive(ParityRequest)
+		return err
+	}, func(c *Conn) error {
+		_, err := c.Receive(Seed)
+		return err
+	})
+	if err, ok := errB.(*UnexpectedMessageError); !ok || err.Got != Status || err.Want != Seed {
+		t.Errorf("Conn.Receive() of the wrong type failed with %v, want an UnexpectedMessageError", errB)
+	}
+	if err, ok := errA.(*AbortError); !ok || err.Reason != ErrMalformed {
+		t.Errorf("Sender of the wrong type failed with %v, want an AbortError", errA)
+	}
+
+	// Messages must arrive in sequence
+	endA, endB := NewPerfectLink()
+	go endA.Send(Message{Seed, 3, payload}.Encode())
+	if _, err := NewConn(endB, false).Receive(Seed); err == nil {
+		t.Errorf("Conn.Receive() accepted a message out of sequence")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	// An initiator offering only later versions is refused
+	endA, endB := NewPerfectLink()
+	go func() {
+		c := NewConn(endA, true)
+		c.Send(Hello, bitstring.BitStringFromInt(versionBits, protocolVersion+1).Extend(
+			bitstring.BitStringFromInt(versionBits, protocolVersion+2)))
+		c.Receive(Hello)
+	}()
+	conn := NewConn(endB, false)
+	if err := conn.Negotiate(); err != ErrVersion {
+		t.Errorf("Conn.Negotiate() with no common version failed with %v, want ErrVersion", err)
+	}
+	conn.Abort(ErrVersion)
+
+	// The responder picks the latest version both speak
+	endA, endB = NewPerfectLink()
+	go func() {
+		c := NewConn(endA, true)
+		c.Send(Hello, bitstring.BitStringFromInt(versionBits, 0).Extend(
+			bitstring.BitStringFromInt(versionBits, protocolVersion+5)))
+		c.Receive(Hello)
+	}()
+	conn = NewConn(endB, false)
+	if err := conn.Negotiate(); err != nil || conn.Version() != protocolVersion {
+		t.Errorf("Conn.Negotiate() == %v with version %d, want version %d", err, conn.Version(), protocolVersion)
+	}
+}
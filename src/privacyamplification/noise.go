@@ -0,0 +1,228 @@
+/* Models of the noise on the private channel. Each bit of a message passes through the model in turn, so models with
+ * memory, such as bursts, carry on from one message into the next. Every model draws from its own generator, so that a
+ * seeded generator replays the same noise, and must only be used by one end of one link
+ */
+
+package privacyamplification
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"io"
+	"unicode"
+)
+
+// Corrupts the messages sent over a lossy link
+type Noise interface {
+	// Fetches the message received when [bs] is sent, leaving [bs] unchanged
+	Corrupt(bs *bitstring.BitString) *bitstring.BitString
+}
+
+// Noise corrupting messages with each of [models] in turn
+func Chain(models ...Noise) Noise {
+	return chain(models)
+}
+
+type chain []Noise
+
+func (c chain) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	received := bs.Copy()
+	for _, model := range c {
+		received = model.Corrupt(received)
+	}
+	return received
+}
+
+func checkRate(model string, p float64) {
+	if p < 0 || p > 1 {
+		panic(fmt.Sprintf("%s: probability %g outside [0, 1]", model, p))
+	}
+}
+
+// Binary symmetric channel, flipping each bit independently
+type BinarySymmetric struct {
+	p   float64
+	rng *random.Generator
+}
+
+// Flips each bit with probability [p] chosen by [rng]
+func NewBinarySymmetric(p float64, rng *random.Generator) *BinarySymmetric {
+	checkRate("BinarySymmetric", p)
+	return &BinarySymmetric{p, rng}
+}
+
+func (n *BinarySymmetric) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	cp := bs.Copy()
+	for i := 0; i < bs.Length; i++ {
+		if n.rng.NextNormalizedFloat() < n.p {
+			cp.Invert(i)
+		}
+	}
+	return cp
+}
+
+// Gilbert-Elliott channel, a binary symmetric channel whose error rate depends on a hidden good or bad state. The state
+// changes between bits as a Markov chain, so that errors arrive in bursts while the channel is bad
+type GilbertElliott struct {
+	toBad, toGood   float64 // Probabilities of leaving the good and bad states after each bit
+	errGood, errBad float64 // Error rates in each state
+	bad             bool
+	rng             *random.Generator
+}
+
+// Creates a channel starting in the good state, moving to the bad state with probability [toBad] and back with
+// probability [toGood] after each bit, and flipping bits with probability [errGood] or [errBad] in each state, all
+// chosen by [rng]
+func NewGilbertElliott(toBad, toGood, errGood, errBad float64, rng *random.Generator) *GilbertElliott {
+	for _, p := range []float64{toBad, toGood, errGood, errBad} {
+		checkRate("GilbertElliott", p)
+	}
+	if toBad+toGood == 0 {
+		panic("GilbertElliott: the state must be able to change")
+	}
+	return &GilbertElliott{toBad, toGood, errGood, errBad, false, rng}
+}
+
+// Long run error rate of the channel, weighting the rate in each state by the time spent in it
+func (n *GilbertElliott) ErrorRate() float64 {
+	bad := n.toBad / (n.toBad + n.toGood)
+	return (1-bad)*n.errGood + bad*n.errBad
+}
+
+// Mean length of a burst, the number of bits sent in the bad state before returning to the good state
+func (n *GilbertElliott) BurstLength() float64 {
+	return 1 / n.toGood
+}
+
+func (n *GilbertElliott) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	cp := bs.Copy()
+	for i := 0; i < bs.Length; i++ {
+		p := n.errGood
+		if n.bad {
+			p = n.errBad
+		}
+		if n.rng.NextNormalizedFloat() < p {
+			cp.Invert(i)
+		}
+		if n.bad {
+			n.bad = n.rng.NextNormalizedFloat() >= n.toGood
+		} else {
+			n.bad = n.rng.NextNormalizedFloat() < n.toBad
+		}
+	}
+	return cp
+}
+
+// Erasure channel that drops bits without a trace, so the receiver gets a shorter message
+type Erasure struct {
+	p   float64
+	rng *random.Generator
+}
+
+// Drops each bit with probability [p] chosen by [rng]
+func NewErasure(p float64, rng *random.Generator) *Erasure {
+	checkRate("Erasure", p)
+	return &Erasure{p, rng}
+}
+
+func (n *Erasure) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	received := bitstring.NewBitString()
+	for _, b := range bs.Data {
+		if n.rng.NextNormalizedFloat() >= n.p {
+			received.Add(b)
+		}
+	}
+	return received
+}
+
+// Channel that loses synchronisation, inserting random bits and deleting bits so the received message is shifted
+type InsertionDeletion struct {
+	insertion, deletion float64
+	rng                 *random.Generator
+}
+
+// Inserts a random bit before each bit with probability [insertion], and deletes each bit with probability
+// [deletion], all chosen by [rng]
+func NewInsertionDeletion(insertion, deletion float64, rng *random.Generator) *InsertionDeletion {
+	checkRate("InsertionDeletion", insertion)
+	checkRate("InsertionDeletion", deletion)
+	return &InsertionDeletion{insertion, deletion, rng}
+}
+
+func (n *InsertionDeletion) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	received := bitstring.NewBitString()
+	for _, b := range bs.Data {
+		if n.rng.NextNormalizedFloat() < n.insertion {
+			received.Add(n.rng.NextBool())
+		}
+		if n.rng.NextNormalizedFloat() >= n.deletion {
+			received.Add(b)
+		}
+	}
+	return received
+}
+
+// Channel replaying a recorded error pattern, flipping each bit where the pattern is set. Messages continue through the
+// pattern from where the last ended, starting again from the beginning once it runs out
+type Trace struct {
+	pattern *bitstring.BitString
+	pos     int
+}
+
+// Replays the errors in [pattern]. Panics if the pattern is empty
+func NewTrace(pattern *bitstring.BitString) *Trace {
+	if pattern.Length == 0 {
+		panic("Trace: empty error pattern")
+	}
+	return &Trace{pattern, 0}
+}
+
+// Reads an error pattern written as zeros and ones from [r], ignoring white space, for replay by a Trace
+func ReadTrace(r io.Reader) (*Trace, error) {
+	pattern := bitstring.NewBitString()
+	in := bufio.NewReader(r)
+	for {
+		c, _, err := in.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c == '0' || c == '1':
+			pattern.Add(c == '1')
+		case !unicode.IsSpace(c):
+			return nil, fmt.Errorf("privacyamplification: invalid character %q in trace", c)
+		}
+	}
+	if pattern.Length == 0 {
+		return nil, fmt.Errorf("privacyamplification: empty trace")
+	}
+	return NewTrace(pattern), nil
+}
+
+func (n *Trace) Corrupt(bs *bitstring.BitString) *bitstring.BitString {
+	cp := bs.Copy()
+	for i := 0; i < bs.Length; i++ {
+		if n.pattern.Data[n.pos] {
+			cp.Invert(i)
+		}
+		n.pos = (n.pos + 1) % n.pattern.Length
+	}
+	return cp
+}
+
+// Error pattern of a message [received] as [sent], for replay by a Trace. Panics if their lengths differ
+func ErrorPattern(sent, received *bitstring.BitString) *bitstring.BitString {
+	if sent.Length != received.Length {
+		panic("ErrorPattern: messages differ in length")
+	}
+	pattern := bitstring.BitStringOfLength(sent.Length)
+	for i := range pattern.Data {
+		pattern.Data[i] = sent.Data[i] != received.Data[i]
+	}
+	return pattern
+}
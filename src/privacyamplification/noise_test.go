@@ -0,0 +1,154 @@
+package privacyamplification
+
+import (
+	"errors"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Errors [noise] makes in [n] zeros, sent as one message
+func errorPattern(noise Noise, n int) *bitstring.BitString {
+	return noise.Corrupt(bitstring.BitStringOfLength(n))
+}
+
+func TestBinarySymmetric(t *testing.T) {
+	const n = 100000
+	pattern := errorPattern(NewBinarySymmetric(0.1, seeded(1)), n)
+	if rate := pattern.Proportion(); math.Abs(rate-0.1) > 0.005 {
+		t.Errorf("BinarySymmetric(0.1) flipped %g of bits", rate)
+	}
+	if !errorPattern(NewBinarySymmetric(0.1, seeded(1)), n).Equals(pattern) {
+		t.Errorf("BinarySymmetric with the same seed made different errors")
+	}
+}
+
+func TestGilbertElliott(t *testing.T) {
+	const n = 200000
+	noise := NewGilbertElliott(0.01, 0.1, 0.001, 0.3, seeded(1))
+	if rate := noise.ErrorRate(); math.Abs(rate-(10*0.001+0.3)/11) > 1e-12 {
+		t.Errorf("GilbertElliott.ErrorRate() == %g", rate)
+	}
+	if noise.BurstLength() != 10 {
+		t.Errorf("GilbertElliott.BurstLength() == %g, want 10", noise.BurstLength())
+	}
+
+	// Errors follow one another far more often than they would if independent
+	pattern := errorPattern(noise, n)
+	rate := pattern.Proportion()
+	if math.Abs(rate-noise.ErrorRate()) > 0.005 {
+		t.Errorf("GilbertElliott flipped %g of bits, want %g", rate, noise.ErrorRate())
+	}
+	var errs, pairs int
+	for i := 1; i < n; i++ {
+		if pattern.Data[i-1] {
+			errs++
+			if pattern.Data[i] {
+				pairs++
+			}
+		}
+	}
+	if following := float64(pairs) / float64(errs); following < 5*rate {
+		t.Errorf("GilbertElliott followed %g of errors with another, at an error rate of %g", following, rate)
+	}
+}
+
+func TestErasure(t *testing.T) {
+	const n = 100000
+	sent := seeded(1).GetBits(n)
+	received := NewErasure(0.2, seeded(2)).Corrupt(sent)
+	if kept := float64(received.Length) / n; math.Abs(kept-0.8) > 0.005 {
+		t.Errorf("Erasure(0.2) kept %g of bits", kept)
+	}
+	// The bits received are those sent, in order
+	i := 0
+	for _, b := range sent.Data {
+		if i < received.Length && received.Data[i] == b {
+			i++
+		}
+	}
+	if i != received.Length {
+		t.Errorf("Erasure received bits that were not sent")
+	}
+}
+
+func TestInsertionDeletion(t *testing.T) {
+	const n = 100000
+	tests := []struct {
+		insertion, deletion, length float64
+	}{
+		{0.1, 0, 1.1},
+		{0, 0.1, 0.9},
+		{0.05, 0.05, 1},
+	}
+	for _, test := range tests {
+		received := NewInsertionDeletion(test.insertion, test.deletion, seeded(1)).Corrupt(seeded(2).GetBits(n))
+		if length := float64(received.Length) / n; math.Abs(length-test.length) > 0.005 {
+			t.Errorf("InsertionDeletion(%g, %g) changed the length by %g, want %g", test.insertion, test.deletion,
+				length, test.length)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	pattern, _ := bitstring.BitStringFromString("0110")
+	noise := NewTrace(pattern)
+	// Messages continue through the pattern, wrapping around at its end
+	for _, want := range []string{"011001", "100110", "0"} {
+		if got := errorPattern(noise, len(want)); got.String() != want {
+			t.Errorf("Trace made errors %v, want %v", got, want)
+		}
+	}
+
+	noise, err := ReadTrace(strings.NewReader("01\n 10\n"))
+	if err != nil || !errorPattern(noise, 4).Equals(pattern) {
+		t.Errorf("ReadTrace() failed with %v", err)
+	}
+	for _, bad := range []string{"0120", " \n"} {
+		if _, err := ReadTrace(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadTrace(%q) succeeded", bad)
+		}
+	}
+
+	// A recorded pattern replays the errors of the channel that made it
+	sent := seeded(1).GetBits(1000)
+	received := NewGilbertElliott(0.01, 0.1, 0, 0.3, seeded(2)).Corrupt(sent)
+	if !NewTrace(ErrorPattern(sent, received)).Corrupt(sent).Equals(received) {
+		t.Errorf("Trace of ErrorPattern() did not replay the errors")
+	}
+}
+
+func TestSessionNoise(t *testing.T) {
+	tests := []struct {
+		noise func(seed int) Noise
+		err   error
+	}{
+		{func(seed int) Noise { return NewGilbertElliott(0.005, 0.1, 0, 0.3, seeded(seed)) }, nil},
+		{func(seed int) Noise { return NewErasure(0.01, seeded(seed)) }, ErrMalformed},
+		{func(seed int) Noise { return NewInsertionDeletion(0.01, 0, seeded(seed)) }, ErrMalformed},
+	}
+	for _, test := range tests {
+		// Sessions with seeded noise run identically, so a failure can be reproduced
+		var stats []Stats
+		for run := 0; run < 2; run++ {
+			publicA, publicB := NewPerfectLink()
+			a, privateB := NewPerfectLink()
+			privateA := NewLossyChannel(a, test.noise(1))
+			alice := NewAlice(publicA, privateA, Config{Generator: seeded(2)})
+			bob := NewBob(publicB, privateB, Config{Generator: seeded(3)})
+			secretA, secretB, errA, errB := runSession(alice, bob)
+			noise := test.noise(1)
+			if !errors.Is(errA, test.err) || !errors.Is(errB, test.err) {
+				t.Fatalf("Session with %T failed with %v, %v, want %v", noise, errA, errB, test.err)
+			}
+			if test.err == nil && !secretA.Equals(secretB) {
+				t.Errorf("Session with %T agreed different secrets", noise)
+			}
+			stats = append(stats, bob.Stats())
+		}
+		if stats[0] != stats[1] {
+			t.Errorf("Sessions with the same noise gave stats %+v and %+v", stats[0], stats[1])
+		}
+	}
+}
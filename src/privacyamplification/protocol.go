@@ -0,0 +1,333 @@
+/* Key agreement between Alice and Bob, who share a private channel that corrupts some bits and an authentic public
+ * channel. Alice sends a random secret over the private channel, Bob corrects his copy by reconciliation over the
+ * public channel, and a short hash of the secret verifies the correction. Privacy amplification then compresses the
+ * secret to a key about which Eve knows next to nothing. Given a pool of pre-shared key, the messages on the public
+ * channel are authenticated before the key is accepted
+ */
+
+package privacyamplification
+
+import (
+	"errors"
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"log"
+	"math"
+)
+
+const (
+	defaultSecretLength = 512
+	statusBits          = 32 // Length of Bob's count of the errors he corrected
+)
+
+// Returned when the secrets could not be reconciled
+var ErrNoAgreement = errors.New("privacyamplification: no secret agreed")
+
+// Configuration of a session, zero values are replaced by defaults
+type Config struct {
+	SecretLength int               // Length of the secret Alice sends
+	QBER         float64           // Estimated error rate of the private channel, unless the distributor estimates it
+	Distributor  Distributor       // Gives Alice the secret and Bob his copy over the private channel, Direct if nil
+	Reconciler   Reconciler        // Corrects Bob's copy of the secret, Cascade if nil
+	Epsilon      float64           // Distance of the key from uniform given Eve's information
+	Pool         *KeyPool          // Authenticates the public channel, replenished from the agreed key, unless nil
+	Generator    *random.Generator // Source of the secret and the public seeds of each phase
+	Logger       *log.Logger       // Logs the progress of the session, or nothing if nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.SecretLength <= 0 {
+		c.SecretLength = defaultSecretLength
+	}
+	if c.QBER <= 0 {
+		c.QBER = defaultBitCorruptionRate
+	}
+	if c.Distributor == nil {
+		c.Distributor = Direct{}
+	}
+	if c.Reconciler == nil {
+		c.Reconciler = Cascade{}
+	}
+	if c.Epsilon <= 0 {
+		c.Epsilon = random.DefaultEntropyErr
+	}
+	if c.Generator == nil {
+		c.Generator = random.NewGeneratorFromConfig("innerprod")
+	}
+	return c
+}
+
+// Statistics of a session
+type Stats struct {
+	Photons      int // Photons sent in quantum key distribution
+	Sifted       int // Bits kept once bases were compared
+	Sampled      int // Sifted bits disclosed to estimate the error rate
+	SampleErrors int // Errors found in the sample
+
+	Rounds     int // Messages from Alice during reconciliation, each a round of interaction
+	Parities   int // Parity bits revealed on the public channel, which privacy amplification must subtract
+	BitsLeaked int // Bits revealed about the secret on the public channel, as parities and the verification hash
+	Corrected  int // Errors corrected in Bob's copy of the secret, always zero for Alice
+
+	ErrorRate      float64 // Error rate of the private channel assumed, the larger of the estimate and that corrected
+	EveInformation float64 // Bits of the secret Eve may know, removed by privacy amplification
+	Replenished    int     // Bits of the agreed key added to the authentication pool
+	KeyLength      int     // Length of the agreed key
+}
+
+// A session logging with [prefix] and counting [stats]
+type session struct {
+	conn    *Conn // Typed messages over the public channel
+	private Channel
+	config  Config
+	prefix  string
+	stats   Stats
+	auth    *AuthenticatedChannel // The public channel, if it is authenticated
+}
+
+func newSession(public, private Channel, config Config, prefix string, initiator bool) session {
+	s := session{private: private, config: config.withDefaults(), prefix: prefix}
+	if s.config.Pool != nil {
+		s.auth = NewAuthenticatedChannel(public, s.config.Pool, initiator)
+		public = s.auth
+	}
+	s.conn = NewConn(public, initiator)
+	return s
+}
+
+func (s *session) logf(format string, args ...interface{}) {
+	if s.config.Logger != nil {
+		s.config.Logger.Printf(s.prefix+format, args...)
+	}
+}
+
+// Statistics of the session so far
+func (s *session) Stats() Stats {
+	return s.stats
+}
+
+// Chooses the length of the key extracted from an [n] bit secret in which Bob corrected [corrected] errors
+func (s *session) keyLength(n, corrected int) (int, error) {
+	s.stats.ErrorRate = math.Max(s.config.QBER, float64(corrected)/float64(n))
+	s.stats.EveInformation = EveInformation(n, s.stats.ErrorRate, s.stats.BitsLeaked)
+	length := SecretKeyLength(n, s.stats.EveInformation, s.config.Epsilon)
+	s.logf("Eve may know %.1f of %d bits, leaving a %d bit key\n", s.stats.EveInformation, n, length)
+	if length == 0 {
+		return 0, ErrNoSecrecy
+	}
+	return length, nil
+}
+
+// Shares the secret with the distributor, drawing on [rng], and adopts the error rate it estimates
+func (s *session) distribute(rng *random.Generator) (*bitstring.BitString, error) {
+	share := s.config.Distributor.Receive
+	if s.conn.initiator {
+		share = s.config.Distributor.Send
+	}
+	secret, qber, err := share(s.conn, s.private, rng, s.config.SecretLength, &s.stats)
+	if err != nil {
+		return nil, err
+	}
+	if qber > 0 {
+		s.logf("Estimated the error rate as %.4f from %d bits\n", qber, s.stats.Sampled)
+		s.config.QBER = qber
+	}
+	return secret, nil
+}
+
+// Verifies the messages on the public channel, and replaces the pool bits this spent with the start of the [key],
+// returning the rest
+func (s *session) authenticate(key *bitstring.BitString) (*bitstring.BitString, error) {
+	if s.auth == nil {
+		return key, nil
+	}
+	if err := s.auth.Verify(); err != nil {
+		return nil, err
+	}
+	s.logf("Public channel authenticated\n")
+	spent := 2 * tagBits
+	if key.Length <= spent {
+		return nil, ErrNoSecrecy
+	}
+	s.config.Pool.Replenish(key.Substring(0, spent))
+	s.stats.Replenished = spent
+	return key.Substring(spent, key.Length-spent), nil
+}
+
+// Tells the other party of a failure, then closes both channels so that it fails too rather than waiting
+func (s *session) abort(err error) error {
+	s.conn.Abort(err)
+	s.conn.Close()
+	s.private.Close()
+	return err
+}
+
+// Alice's side of a session, who chooses the secret
+type Alice struct {
+	session
+}
+
+func NewAlice(public, private Channel, config Config) *Alice {
+	return &Alice{newSession(public, private, config, "Alice: ", true)}
+}
+
+// Runs the session, returning the agreed secret
+func (s *Alice) Run() (*bitstring.BitString, error) {
+	secret, err := s.run()
+	if err != nil {
+		return nil, s.abort(err)
+	}
+	s.stats.KeyLength = secret.Length
+	return secret, nil
+}
+
+func (s *Alice) run() (*bitstring.BitString, error) {
+	if err := s.conn.Negotiate(); err != nil {
+		return nil, err
+	}
+
+	// Randomly generate secret, and share it over the private, lossy channel
+	rng := s.config.Generator
+	secret, err := s.distribute(rng)
+	if err != nil {
+		return nil, err
+	}
+	s.logf("Sent the secret 0x%X over the private channel\n", secret.Bytes())
+
+	// Choose the seed of reconciliation, and reveal what Bob needs to correct his copy
+	seed := rng.GetBits(reconcileSeedBits)
+	if err := s.conn.Send(Seed, seed); err != nil {
+		return nil, err
+	}
+	if err := s.config.Reconciler.Reveal(s.conn, secret, seed.Int(), s.config.QBER, &s.stats); err != nil {
+		return nil, err
+	}
+	s.logf("Revealed %d parities in %d rounds\n", s.stats.Parities, s.stats.Rounds)
+
+	// Hash the secret with a random Toeplitz matrix, so that Bob can verify his correction
+	a := rng.GetBits(secret.Length + verifyBits - 1)
+	hash := random.ToeplitzHash(a, secret, verifyBits)
+	s.logf("Sending the hash 0x%X over the public channel\n", hash.Bytes())
+	if err := s.conn.Send(HashCheck, a.Extend(hash)); err != nil {
+		return nil, err
+	}
+	s.stats.BitsLeaked += hash.Length
+
+	// Bob replies with the errors he corrected once he agrees, or aborts
+	status, err := s.conn.Receive(Status)
+	if err != nil {
+		return nil, err
+	}
+	if status.Length != statusBits {
+		return nil, ErrMalformed
+	}
+	s.logf("Secret has been agreed to be 0x%X\n", secret.Bytes())
+
+	// Compress the secret by as much as Eve may know, with a hash chosen at random and sent to Bob
+	length, err := s.keyLength(secret.Length, status.Int())
+	if err != nil {
+		return nil, err
+	}
+	matrix := rng.GetBits(secret.Length + length - 1)
+	if err := s.conn.Send(Seed, matrix); err != nil {
+		return nil, err
+	}
+	key, err := s.authenticate(Amplify(secret, matrix, length))
+	if err != nil {
+		return nil, err
+	}
+	s.logf("Key has been amplified to 0x%X\n", key.Bytes())
+	return key, nil
+}
+
+// Bob's side of a session, who receives the secret
+type Bob struct {
+	session
+}
+
+func NewBob(public, private Channel, config Config) *Bob {
+	return &Bob{newSession(public, private, config, "Bob: ", false)}
+}
+
+// Runs the session, returning the agreed secret
+func (s *Bob) Run() (*bitstring.BitString, error) {
+	secret, err := s.run()
+	if err != nil {
+		return nil, s.abort(err)
+	}
+	s.stats.KeyLength = secret.Length
+	return secret, nil
+}
+
+func (s *Bob) run() (*bitstring.BitString, error) {
+	if err := s.conn.Negotiate(); err != nil {
+		return nil, err
+	}
+
+	// Wait for secret to be sent from Alice
+	secret, err := s.distribute(s.config.Generator)
+	if err != nil {
+		return nil, err
+	}
+	s.logf("Received the secret  0x%X\n", secret.Bytes())
+
+	// Correct the secret, using the seed Alice chose
+	seed, err := s.conn.Receive(Seed)
+	if err != nil {
+		return nil, err
+	}
+	if seed.Length != reconcileSeedBits {
+		return nil, ErrMalformed
+	}
+	if secret.Length != s.config.SecretLength {
+		// Bits were lost or gained on the way, which reconciliation cannot correct
+		return nil, ErrMalformed
+	}
+	if secret, err = s.config.Reconciler.Correct(s.conn, secret, seed.Int(), s.config.QBER,
+		&s.stats); err != nil {
+		return nil, err
+	}
+	s.logf("Corrected %d errors with %d parities, giving 0x%X\n", s.stats.Corrected, s.stats.Parities,
+		secret.Bytes())
+
+	// Receive the hash information
+	check, err := s.conn.Receive(HashCheck)
+	if err != nil {
+		return nil, err
+	}
+	if check.Length != secret.Length+2*verifyBits-1 {
+		return nil, ErrMalformed
+	}
+	a, hashA := check.Substring(0, secret.Length+verifyBits-1), check.Substring(secret.Length+verifyBits-1, verifyBits)
+	s.stats.BitsLeaked += hashA.Length
+	hashB := random.ToeplitzHash(a, secret, verifyBits)
+	s.logf("Calculated hash as 0x%X\n", hashB.Bytes())
+
+	// Compare the received hash to our own, aborting if any errors remain
+	if !hashA.Equals(hashB) {
+		return nil, ErrNoAgreement
+	}
+	s.logf("Secret has been agreed to be   0x%X\n", secret.Bytes())
+
+	// Tell Alice how many errors were corrected, and compress the secret with the hash she chooses
+	if err := s.conn.Send(Status, bitstring.BitStringFromInt(statusBits, s.stats.Corrected)); err != nil {
+		return nil, err
+	}
+	length, err := s.keyLength(secret.Length, s.stats.Corrected)
+	if err != nil {
+		return nil, err
+	}
+	matrix, err := s.conn.Receive(Seed)
+	if err != nil {
+		return nil, err
+	}
+	if matrix.Length != secret.Length+length-1 {
+		return nil, ErrMalformed
+	}
+	key, err := s.authenticate(Amplify(secret, matrix, length))
+	if err != nil {
+		return nil, err
+	}
+	s.logf("Key has been amplified to   0x%X\n", key.Bytes())
+	return key, nil
+}
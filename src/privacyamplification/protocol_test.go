@@ -0,0 +1,164 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"testing"
+)
+
+// Deterministic generator for tests
+func seeded(seed int) *random.Generator {
+	return random.NewGeneratorFromExtractable(random.NewPseudoRandomExtractor(seed))
+}
+
+// Lossy link flipping bits at rate [p] with a seeded generator
+func seededLossyLink(p float64, seed int) (*LossyLink, *LossyLink) {
+	a, b := NewPerfectLink()
+	return NewLossyChannel(a, NewBinarySymmetric(p, seeded(seed))),
+		NewLossyChannel(b, NewBinarySymmetric(p, seeded(seed+1)))
+}
+
+// Runs Alice and Bob over the given links until both finish
+func runSession(alice *Alice, bob *Bob) (secretA, secretB *bitstring.BitString, errA, errB error) {
+	done := make(chan struct{})
+	go func() {
+		secretA, errA = alice.Run()
+		close(done)
+	}()
+	secretB, errB = bob.Run()
+	<-done
+	return
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		r Reconciler
+		p float64
+	}{
+		{nil, 0},
+		{nil, 1.0 / 512},
+		{nil, defaultBitCorruptionRate},
+		{Winnow{}, defaultBitCorruptionRate},
+		{LDPC{}, defaultBitCorruptionRate},
+	}
+	for _, test := range tests {
+		p := test.p
+		publicA, publicB := NewPerfectLink()
+		privateA, privateB := seededLossyLink(p, 1)
+		alice := NewAlice(publicA, privateA, Config{Generator: seeded(2), Reconciler: test.r})
+		bob := NewBob(publicB, privateB, Config{Generator: seeded(3), Reconciler: test.r})
+		secretA, secretB, errA, errB := runSession(alice, bob)
+		if errA != nil || errB != nil {
+			t.Fatalf("Session with %T and error rate %g failed with %v, %v", test.r, p, errA, errB)
+		}
+		if !secretA.Equals(secretB) {
+			t.Errorf("Session with %T and error rate %g agreed different secrets", test.r, p)
+		}
+		// Both parties count the same leak, but only Bob knows how many errors he corrected
+		stats := bob.Stats()
+		if stats.Corrected = 0; stats != alice.Stats() || stats.KeyLength != secretA.Length ||
+			stats.BitsLeaked != stats.Parities+verifyBits || stats.ErrorRate != defaultBitCorruptionRate {
+			t.Errorf("Session with %T and error rate %g gave stats %+v and %+v", test.r, p, alice.Stats(), bob.Stats())
+		}
+		if p == 0 && bob.Stats().Corrected != 0 {
+			t.Errorf("Session over a perfect link gave stats %+v, want no corrections", bob.Stats())
+		}
+		if p == defaultBitCorruptionRate && (stats.Rounds == 0 || bob.Stats().Corrected == 0) {
+			t.Errorf("Session over a lossy link gave stats %+v, want error correction", bob.Stats())
+		}
+	}
+}
+
+func TestSessionFailure(t *testing.T) {
+	// Corrupting every other bit cannot be corrected in a single pass
+	publicA, publicB := NewPerfectLink()
+	privateA, privateB := seededLossyLink(0.5, 1)
+	alice := NewAlice(publicA, privateA, Config{Generator: seeded(2), Reconciler: Cascade{Passes: 1}})
+	bob := NewBob(publicB, privateB, Config{Generator: seeded(3), Reconciler: Cascade{Passes: 1}})
+	// Bob finds the hashes differ, and tells Alice
+	_, _, errA, errB := runSession(alice, bob)
+	if abort, ok := errA.(*AbortError); !ok || abort.Reason != ErrNoAgreement || errB != ErrNoAgreement {
+		t.Errorf("Session failed with %v, %v, want ErrNoAgreement", errA, errB)
+	}
+
+	// Nothing is left once Eve may know the whole secret
+	publicA, publicB = NewPerfectLink()
+	privateA, privateB = seededLossyLink(0, 1)
+	alice = NewAlice(publicA, privateA, Config{Generator: seeded(2), QBER: 0.25})
+	bob = NewBob(publicB, privateB, Config{Generator: seeded(3), QBER: 0.25})
+	if _, _, errA, errB := runSession(alice, bob); errA != ErrNoSecrecy || errB != ErrNoSecrecy {
+		t.Errorf("Session failed with %v, %v, want ErrNoSecrecy", errA, errB)
+	}
+
+	// A closed channel fails the session rather than blocking
+	publicA, publicB = NewPerfectLink()
+	privateA, privateB = seededLossyLink(0, 1)
+	publicB.Close()
+	privateB.Close()
+	if _, err := NewAlice(publicA, privateA, Config{Generator: seeded(2)}).Run(); err != ErrClosed {
+		t.Errorf("Alice.Run() over a closed channel failed with %v, want ErrClosed", err)
+	}
+}
+
+func TestSessionAuthenticated(t *testing.T) {
+	preshared := seeded(4).GetBits(tagBits + 2*tagBits)
+	poolA, poolB := NewKeyPool(preshared), NewKeyPool(preshared)
+	const length = 2048 // Long enough for the key to replenish the pool
+
+	// Each session spends pad bits from the pool and replaces them from the key it agrees
+	for i := 0; i < 2; i++ {
+		publicA, publicB := NewPerfectLink()
+		privateA, privateB := seededLossyLink(defaultBitCorruptionRate, i)
+		alice := NewAlice(publicA, privateA, Config{SecretLength: length, Generator: seeded(2), Pool: poolA})
+		bob := NewBob(publicB, privateB, Config{SecretLength: length, Generator: seeded(3), Pool: poolB})
+		secretA, secretB, errA, errB := runSession(alice, bob)
+		if errA != nil || errB != nil {
+			t.Fatalf("Authenticated session %d failed with %v, %v", i, errA, errB)
+		}
+		if !secretA.Equals(secretB) || alice.Stats().Replenished != 2*tagBits {
+			t.Errorf("Authenticated session %d agreed different secrets, or gave stats %+v", i, alice.Stats())
+		}
+		if poolA.Available() != 2*tagBits || poolB.Available() != 2*tagBits {
+			t.Errorf("Pools hold %d and %d bits after session %d, want %d", poolA.Available(), poolB.Available(), i,
+				2*tagBits)
+		}
+	}
+
+	// Replacing the hash Alice chooses for privacy amplification, the last message she sends, is detected
+	publicA, publicB := NewPerfectLink()
+	privateA, privateB := seededLossyLink(0, 1)
+	var tampered bool
+	last := func(i int, bs *bitstring.BitString) *bitstring.BitString {
+		if m, _ := DecodeMessage(bs); m.Type == Seed && m.Payload.Length > reconcileSeedBits {
+			bs.Invert(bs.Length - 1)
+			tampered = true
+		}
+		return bs
+	}
+	alice := NewAlice(NewTamperingLink(publicA, last), privateA,
+		Config{SecretLength: length, Generator: seeded(2), Pool: poolA})
+	bob := NewBob(publicB, privateB, Config{SecretLength: length, Generator: seeded(3), Pool: poolB})
+	_, _, errA, errB := runSession(alice, bob)
+	if _, ok := errB.(*AuthenticationError); !ok || !tampered {
+		t.Errorf("Bob failed with %v after tampering, want an AuthenticationError", errB)
+	}
+	if _, ok := errA.(*AuthenticationError); !ok {
+		t.Errorf("Alice failed with %v after tampering, want an AuthenticationError", errA)
+	}
+}
+
+func TestPerfectLink(t *testing.T) {
+	a, b := NewPerfectLink()
+	bs := bitstring.BitStringFromInt(8, 0xA5)
+	go a.Send(bs)
+	if got, err := b.Receive(); err != nil || !got.Equals(bs) {
+		t.Errorf("PerfectLink.Receive() == %v, %v, want %v", got, err, bs)
+	}
+	b.Close()
+	if err := a.Send(bs); err != ErrClosed {
+		t.Errorf("PerfectLink.Send() after Close() == %v, want ErrClosed", err)
+	}
+	if _, err := a.Receive(); err != ErrClosed {
+		t.Errorf("PerfectLink.Receive() after Close() == %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,139 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"github.com/adamhosier/random/src/random"
+	"math"
+)
+
+const (
+	reconcileSeedBits = 48 // Length of the seed Alice chooses for the shuffles and codes of reconciliation
+)
+
+// Reconciles Bob's copy of the key with Alice's by discussion over the public connection. Both sides are given the
+// public [seed] Alice chose and the estimated error rate [qber] of the private channel, and count what they reveal
+// about the key in [stats]
+type Reconciler interface {
+	// Alice's side, revealing what Bob needs about her [key]
+	Reveal(conn *Conn, key *bitstring.BitString, seed int, qber float64, stats *Stats) error
+	// Bob's side, returning his corrected copy of [key]
+	Correct(conn *Conn, key *bitstring.BitString, seed int, qber float64, stats *Stats) (*bitstring.BitString, error)
+}
+
+// Fields of a request from Bob to Alice in a ParityRequest, which is the request type, the pass, and two values
+// depending on the type
+var requestBits = []int{2, 8, 32, 32}
+
+// Encodes a request to Alice of [kind] about pass [pass]
+func encodeRequest(kind, pass, a, b int) *bitstring.BitString {
+	bs := bitstring.NewBitString()
+	for i, v := range []int{kind, pass, a, b} {
+		bs = bs.Extend(bitstring.BitStringFromInt(requestBits[i], v))
+	}
+	return bs
+}
+
+func decodeRequest(bs *bitstring.BitString) (kind, pass, a, b int, err error) {
+	var values [4]int
+	start := 0
+	for i, n := range requestBits {
+		if start+n > bs.Length {
+			return 0, 0, 0, 0, ErrMalformed
+		}
+		values[i] = bs.Substring(start, n).Int()
+		start += n
+	}
+	if start != bs.Length {
+		return 0, 0, 0, 0, ErrMalformed
+	}
+	return values[0], values[1], values[2], values[3], nil
+}
+
+// Counts the [parities] revealed in a reply from Alice
+func (s *Stats) reveal(parities int) {
+	s.Rounds++
+	s.Parities += parities
+	s.BitsLeaked += parities
+}
+
+// Permutations and parity check matrices computed for one reconciliation, kept so that replaying it many times over,
+// as Eve does, computes each only once. Those kept must not be modified
+type codeCache struct {
+	perms  map[[3]int][][]int
+	checks map[[3]int]*parityCheck
+}
+
+func newCodeCache() *codeCache {
+	return &codeCache{make(map[[3]int][][]int), make(map[[3]int]*parityCheck)}
+}
+
+// Permutations for a reconciliation over [c], taken from its cache if it has one
+func (c *Conn) permutations(seed, n, passes int) [][]int {
+	if c.codes == nil {
+		return permutations(seed, n, passes)
+	}
+	key := [3]int{seed, n, passes}
+	perms, ok := c.codes.perms[key]
+	if !ok {
+		perms = permutations(seed, n, passes)
+		c.codes.perms[key] = perms
+	}
+	return perms
+}
+
+// Computes the order in which each pass visits the [n] bits of the key. The first pass takes the key in order, and
+// later passes are shuffled with a prng seeded from the public [seed]
+func permutations(seed, n, passes int) [][]int {
+	perms := make([][]int, passes)
+	for p := range perms {
+		perms[p] = make([]int, n)
+		for i := range perms[p] {
+			perms[p][i] = i
+		}
+		if p == 0 {
+			continue
+		}
+		rng := random.NewGeneratorFromExtractable(random.NewPseudoRandomExtractor(seed + p))
+		for i := n - 1; i > 0; i-- {
+			j := rng.NextIntBetween(0, i+1)
+			perms[p][i], perms[p][j] = perms[p][j], perms[p][i]
+		}
+	}
+	return perms
+}
+
+// Parity of the bits of [key] at positions [lo, hi) of [perm]
+func rangeParity(key *bitstring.BitString, perm []int, lo, hi int) int {
+	parity := 0
+	for _, i := range perm[lo:hi] {
+		if key.Data[i] {
+			parity ^= 1
+		}
+	}
+	return parity
+}
+
+// Number of positions at which the equal length [a] and [b] differ
+func differences(a, b *bitstring.BitString) int {
+	n := 0
+	for i, bit := range a.Data {
+		if bit != b.Data[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// Binary entropy function h(p), the information in bits carried by each error of a channel with error rate [p]
+func BinaryEntropy(p float64) float64 {
+	if p <= 0 || p >= 1 {
+		return 0
+	}
+	return -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+}
+
+// Efficiency f of reconciling [n] bits with error rate [qber] by revealing [leaked] bits, relative to the Shannon
+// limit of n h(qber). A perfect reconciler has efficiency 1
+func Efficiency(leaked, n int, qber float64) float64 {
+	return float64(leaked) / (float64(n) * BinaryEntropy(qber))
+}
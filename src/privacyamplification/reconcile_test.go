@@ -0,0 +1,191 @@
+package privacyamplification
+
+import (
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"testing"
+)
+
+// Runs [r] over a perfect link, correcting [noisy] to match [key]
+func reconcile(r Reconciler, key, noisy *bitstring.BitString, qber float64) (*bitstring.BitString, Stats, Stats,
+	error) {
+	a, b := NewPerfectLink()
+	var statsA, statsB Stats
+	done := make(chan error)
+	go func() {
+		done <- r.Reveal(NewConn(a, true), key, 7, qber, &statsA)
+	}()
+	corrected, err := r.Correct(NewConn(b, false), noisy, 7, qber, &statsB)
+	if errA := <-done; err == nil {
+		err = errA
+	}
+	return corrected, statsA, statsB, err
+}
+
+// Random key of length [n] and a copy with each bit flipped with probability [qber], with the number flipped
+func noisyKey(n int, qber float64, seed int) (key, noisy *bitstring.BitString, errors int) {
+	rng := seeded(seed)
+	key = rng.GetBits(n)
+	noisy = key.Copy()
+	for i := 0; i < n; i++ {
+		if rng.NextNormalizedFloat() < qber {
+			noisy.Invert(i)
+			errors++
+		}
+	}
+	return key, noisy, errors
+}
+
+func TestReconcilers(t *testing.T) {
+	tests := []struct {
+		r    Reconciler
+		qber []float64
+	}{
+		{Cascade{}, []float64{0, 0.01, 0.03, 0.05, 0.1}},
+		{Winnow{}, []float64{0, 0.01, 0.03, 0.05}},
+		{LDPC{}, []float64{0, 0.01, 0.03, 0.05}},
+		{LDPC{Rate: 0.5, FrameSize: 1000}, []float64{0.05}},
+	}
+	for _, test := range tests {
+		for i, qber := range test.qber {
+			key, noisy, errors := noisyKey(4096, qber, i)
+			corrected, statsA, statsB, err := reconcile(test.r, key, noisy, qber)
+			if err != nil {
+				t.Fatalf("%T with error rate %g failed with %v", test.r, qber, err)
+			}
+			if !corrected.Equals(key) {
+				t.Errorf("%T with error rate %g left %d errors in the key", test.r, qber,
+					differences(corrected, key))
+			}
+			// Alice counts exactly the parities she revealed, and Bob exactly those he learnt
+			if statsA.Parities != statsB.Parities || statsA.Rounds != statsB.Rounds ||
+				statsA.BitsLeaked != statsA.Parities {
+				t.Errorf("%T with error rate %g counted %+v and %+v", test.r, qber, statsA, statsB)
+			}
+			if statsB.Corrected != errors {
+				t.Errorf("%T with error rate %g corrected %d errors, want %d", test.r, qber, statsB.Corrected, errors)
+			}
+			if errors > 0 && noisy.Equals(key) {
+				t.Errorf("%T with error rate %g modified its input", test.r, qber)
+			}
+		}
+	}
+}
+
+func TestCascadeBlockSize(t *testing.T) {
+	tests := []struct {
+		qber float64
+		n    int
+		want int
+	}{
+		{0.01, 4096, 73},
+		{1.0 / 32, 512, 24},
+		{0.5, 512, 2},
+		{0.9, 512, 1},
+		{0.001, 512, 512},
+		{0, 512, 512},
+	}
+	for _, test := range tests {
+		if got := cascadeBlockSize(test.qber, test.n); got != test.want {
+			t.Errorf("cascadeBlockSize(%g, %d) == %d, want %d", test.qber, test.n, got, test.want)
+		}
+	}
+}
+
+func TestHammingSyndrome(t *testing.T) {
+	key := bitstring.BitStringOfLength(16)
+	perm := permutations(0, 16, 1)[0]
+	for i := 0; i < 16; i++ {
+		// A single error is located by the syndrome, the first bit being covered by the parity alone
+		noisy := key.Copy()
+		noisy.Invert(i)
+		if got := hammingSyndrome(noisy, perm, 0, 16) ^ hammingSyndrome(key, perm, 0, 16); got != i {
+			t.Errorf("Syndrome of an error at %d is %d", i, got)
+		}
+	}
+}
+
+func TestParityCheck(t *testing.T) {
+	h := newParityCheck(1000, 300, 1)
+	for v, checks := range h.bits {
+		if len(checks) == 0 || len(checks) > ldpcColumnWeight {
+			t.Fatalf("Bit %d of newParityCheck() is in %d checks", v, len(checks))
+		}
+	}
+	for c, bits := range h.checks {
+		if len(bits) < 8 || len(bits) > 12 {
+			t.Errorf("Check %d of newParityCheck() has %d bits, want about 10", c, len(bits))
+		}
+	}
+
+	// A word too far from any with the syndrome fails to decode
+	key, noisy, _ := noisyKey(1000, 0.3, 1)
+	if _, ok := h.decode(noisy.Data, h.syndrome(key.Data), 0.3, 20); ok {
+		t.Errorf("parityCheck.decode() decoded a word with 30%% errors")
+	}
+}
+
+func TestPermutations(t *testing.T) {
+	perms := permutations(3, 100, 3)
+	for p, perm := range perms {
+		seen := make([]bool, len(perm))
+		for _, i := range perm {
+			seen[i] = true
+		}
+		for i, ok := range seen {
+			if !ok {
+				t.Fatalf("Pass %d of permutations() misses %d", p, i)
+			}
+		}
+	}
+	for i, j := range perms[0] {
+		if i != j {
+			t.Fatalf("First pass of permutations() is shuffled")
+		}
+	}
+}
+
+func TestEfficiency(t *testing.T) {
+	if got := BinaryEntropy(0.5); got != 1 {
+		t.Errorf("BinaryEntropy(0.5) == %g, want 1", got)
+	}
+	if got := BinaryEntropy(0); got != 0 {
+		t.Errorf("BinaryEntropy(0) == %g, want 0", got)
+	}
+	if got := Efficiency(500, 1000, 0.5); got != 0.5 {
+		t.Errorf("Efficiency(500, 1000, 0.5) == %g, want 0.5", got)
+	}
+}
+
+// Compares the efficiency f and rounds of each reconciler, correcting keys sent over a lossy link
+func BenchmarkReconcilers(b *testing.B) {
+	const n = 1 << 14
+	for _, r := range []Reconciler{Cascade{}, Winnow{}, LDPC{}} {
+		for _, qber := range []float64{0.01, 0.03, 0.05} {
+			b.Run(fmt.Sprintf("%T/%g", r, qber), func(b *testing.B) {
+				var leaked, rounds, failures int
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					privateA, privateB := seededLossyLink(qber, i)
+					key := seeded(i).GetBits(n)
+					go privateA.Send(key)
+					noisy, _ := privateB.Receive()
+					b.StartTimer()
+
+					corrected, stats, _, err := reconcile(r, key, noisy, qber)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if !corrected.Equals(key) {
+						failures++
+					}
+					leaked += stats.BitsLeaked
+					rounds += stats.Rounds
+				}
+				b.ReportMetric(Efficiency(leaked, n*b.N, qber), "f")
+				b.ReportMetric(float64(rounds)/float64(b.N), "rounds/op")
+				b.ReportMetric(float64(failures)/float64(b.N), "failures/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package privacyamplification
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/adamhosier/random/src/bitstring"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	maxFrameBits = 1 << 28 // Longest message accepted from a socket, guarding against a corrupt length
+)
+
+// Returned by a socket channel when the other end takes longer than the timeout
+var ErrTimeout = errors.New("privacyamplification: channel timed out")
+
+// One end of a link over a stream socket, such as TCP or a Unix domain socket. Each message is framed as its length in
+// bits followed by its bits packed into bytes
+type SocketChannel struct {
+	conn    net.Conn
+	timeout time.Duration // Longest each Send or Receive may take, or no limit if zero
+}
+
+// Wraps the connected socket [conn], failing Send and Receive with ErrTimeout after [timeout] if it is not zero
+func NewSocketChannel(conn net.Conn, timeout time.Duration) *SocketChannel {
+	return &SocketChannel{conn, timeout}
+}
+
+// Connects to a socket channel listening at [address] on [network], which is "tcp" or "unix", waiting at most
+// [timeout] to connect and for each Send and Receive once connected
+func Dial(network, address string, timeout time.Duration) (*SocketChannel, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewSocketChannel(conn, timeout), nil
+}
+
+// Listens for socket channels at [address] on [network]
+type Listener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+// Listens at [address] on [network], which is "tcp" or "unix", waiting at most [timeout] for each connection and for
+// each Send and Receive once connected
+func Listen(network, address string, timeout time.Duration) (*Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{l, timeout}, nil
+}
+
+// Waits for the next connection, failing with ErrTimeout if none arrives in time, or ErrClosed once the listener is
+// closed
+func (l *Listener) Accept() (*SocketChannel, error) {
+	if d, ok := l.Listener.(interface{ SetDeadline(time.Time) error }); ok && l.timeout > 0 {
+		d.SetDeadline(time.Now().Add(l.timeout))
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, socketError(err)
+	}
+	return NewSocketChannel(conn, l.timeout), nil
+}
+
+// Translates socket errors into those of a Channel
+func socketError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET):
+		return ErrClosed
+	}
+	return err
+}
+
+func (sc *SocketChannel) deadline() time.Time {
+	if sc.timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(sc.timeout)
+}
+
+func (sc *SocketChannel) Send(bs *bitstring.BitString) error {
+	frame := make([]byte, 4+(bs.Length+7)/8)
+	binary.BigEndian.PutUint32(frame, uint32(bs.Length))
+	for i, b := range bs.Data {
+		if b {
+			frame[4+i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	sc.conn.SetWriteDeadline(sc.deadline())
+	if _, err := sc.conn.Write(frame); err != nil {
+		return socketError(err)
+	}
+	return nil
+}
+
+func (sc *SocketChannel) Receive() (*bitstring.BitString, error) {
+	sc.conn.SetReadDeadline(sc.deadline())
+	var header [4]byte
+	if _, err := io.ReadFull(sc.conn, header[:]); err != nil {
+		return nil, socketError(err)
+	}
+	n := int(binary.BigEndian.Uint32(header[:]))
+	if n > maxFrameBits {
+		return nil, ErrMalformed
+	}
+	frame := make([]byte, (n+7)/8)
+	if _, err := io.ReadFull(sc.conn, frame); err != nil {
+		return nil, socketError(err)
+	}
+	bs := bitstring.BitStringOfLength(n)
+	for i := range bs.Data {
+		bs.Data[i] = frame[i/8]&(0x80>>uint(i%8)) != 0
+	}
+	return bs, nil
+}
+
+// Closes the socket, so that the other end fails with ErrClosed
+func (sc *SocketChannel) Close() error {
+	return sc.conn.Close()
+}
@@ -0,0 +1,107 @@
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Connects both ends of a socket channel over [network]
+func socketPair(t *testing.T, network string, timeout time.Duration) (*SocketChannel, *SocketChannel) {
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "channel.sock")
+	}
+	l, err := Listen(network, address, timeout)
+	if err != nil {
+		t.Fatalf("Listen(%q) failed with %v", network, err)
+	}
+	defer l.Close()
+	accepted := make(chan *SocketChannel)
+	go func() {
+		b, _ := l.Accept()
+		accepted <- b
+	}()
+	a, err := Dial(network, l.Addr().String(), timeout)
+	if err != nil {
+		t.Fatalf("Dial(%q) failed with %v", network, err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatalf("Accept(%q) failed", network)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestSocketChannel(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		a, b := socketPair(t, network, time.Second)
+		for _, n := range []int{0, 1, 7, 8, 9, 1000} {
+			sent := seeded(n).GetBits(n)
+			go a.Send(sent)
+			if got, err := b.Receive(); err != nil || !got.Equals(sent) {
+				t.Errorf("Received %v, %v over %s, want %v", got, err, network, sent)
+			}
+		}
+		a.Close()
+		if _, err := b.Receive(); err != ErrClosed {
+			t.Errorf("Receive() from a closed %s channel gave %v, want ErrClosed", network, err)
+		}
+		if err := a.Send(bitstring.BitStringOfLength(1)); err != ErrClosed {
+			t.Errorf("Send() on a closed %s channel gave %v, want ErrClosed", network, err)
+		}
+	}
+}
+
+func TestSocketChannelTimeout(t *testing.T) {
+	a, _ := socketPair(t, "tcp", 20*time.Millisecond)
+	if _, err := a.Receive(); err != ErrTimeout {
+		t.Errorf("Receive() with nothing sent gave %v, want ErrTimeout", err)
+	}
+
+	l, err := Listen("tcp", "127.0.0.1:0", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Accept(); err != ErrTimeout {
+		t.Errorf("Accept() with no connection gave %v, want ErrTimeout", err)
+	}
+	l.Close()
+	if _, err := l.Accept(); err != ErrClosed {
+		t.Errorf("Accept() on a closed listener gave %v, want ErrClosed", err)
+	}
+}
+
+func TestSocketChannelMalformed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go client.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	if _, err := NewSocketChannel(server, time.Second).Receive(); err != ErrMalformed {
+		t.Errorf("Receive() of an oversized frame gave %v, want ErrMalformed", err)
+	}
+}
+
+func TestSessionOverSockets(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		publicA, publicB := socketPair(t, network, 10*time.Second)
+		privateA, privateB := socketPair(t, network, 10*time.Second)
+		lossy := NewLossyChannel(privateA, NewBinarySymmetric(defaultBitCorruptionRate, seeded(1)))
+		alice := NewAlice(publicA, lossy, Config{Generator: seeded(2)})
+		bob := NewBob(publicB, privateB, Config{Generator: seeded(3)})
+		secretA, secretB, errA, errB := runSession(alice, bob)
+		if errA != nil || errB != nil {
+			t.Fatalf("Session over %s failed with %v, %v", network, errA, errB)
+		}
+		if !secretA.Equals(secretB) || bob.Stats().Corrected == 0 {
+			t.Errorf("Session over %s agreed different secrets, correcting %d errors", network,
+				bob.Stats().Corrected)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/* Winnow information reconciliation, described in
+ * W. T. Buttler et al., Fast, efficient error reconciliation for quantum cryptography, Phys. Rev. A 67, 052303 (2003)
+ *
+ * Each pass splits a shuffled key into blocks of 2^m bits and compares their parities. For each block whose parity
+ * differs, Alice reveals the m bit syndrome of the Hamming code over the block, and the difference between hers and
+ * Bob's locates a single error. Unlike Cascade, a pass takes two rounds whatever the number of errors, but blocks with
+ * more than one error may be miscorrected, so later passes with larger blocks clean up. The block size stops growing
+ * after a few passes, as two remaining errors sharing a large block would hide each other
+ */
+
+package privacyamplification
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+)
+
+const (
+	defaultWinnowPasses = 8
+	minWinnowBlockBits  = 2  // Smallest blocks are 4 bits, a 3 bit Hamming code and one more bit
+	maxWinnowBlockBits  = 30 // Largest syndromes, which must fit in a request
+	winnowBlockGrowth   = 3  // Passes the block size doubles over, before staying fixed so remaining errors rarely pair
+)
+
+// Requests Bob makes of Alice during Winnow
+const (
+	winnowParities = iota // Parities of every block of a pass, to be followed by the blocks whose parities differ
+	winnowDone            // Reconciliation has finished
+)
+
+// Winnow reconciliation, which takes two rounds each pass
+type Winnow struct {
+	Passes int // Passes over the key, zero is replaced by a default
+}
+
+func (w Winnow) passes() int {
+	if w.Passes <= 0 {
+		return defaultWinnowPasses
+	}
+	return w.Passes
+}
+
+// Chooses the log block size of the first pass for a key with error rate [qber], the largest power of two with fewer
+// errors expected than a block of Cascade
+func winnowBlockBits(qber float64) int {
+	size := math.Floor(math.Log2(cascadeBlockFactor / qber))
+	return int(math.Max(minWinnowBlockBits, math.Min(maxWinnowBlockBits, size)))
+}
+
+// Syndrome of the Hamming code over the bits of [key] at positions [lo, hi) of [perm], which is the xor of the offsets
+// of the set bits within the block
+func hammingSyndrome(key *bitstring.BitString, perm []int, lo, hi int) int {
+	syndrome := 0
+	for i := lo; i < hi; i++ {
+		if key.Data[perm[i]] {
+			syndrome ^= i - lo
+		}
+	}
+	return syndrome
+}
+
+// Alice's side of Winnow, revealing the parities and syndromes Bob requests until he is done
+func (w Winnow) Reveal(conn *Conn, key *bitstring.BitString, seed int, qber float64, stats *Stats) error {
+	perms := conn.permutations(seed, key.Length, w.passes())
+	for {
+		req, err := conn.Receive(ParityRequest)
+		if err != nil {
+			return err
+		}
+		kind, pass, m, _, err := decodeRequest(req)
+		if err != nil {
+			return err
+		}
+		if kind == winnowDone {
+			return nil
+		}
+		if kind != winnowParities || pass >= len(perms) || m < minWinnowBlockBits || m > maxWinnowBlockBits {
+			return ErrMalformed
+		}
+
+		// Reveal the parity of every block
+		perm, size := perms[pass], 1<<uint(m)
+		parities := bitstring.NewBitString()
+		for lo := 0; lo < key.Length; lo += size {
+			hi := int(math.Min(float64(lo+size), float64(key.Length)))
+			parities.Add(rangeParity(key, perm, lo, hi) == 1)
+		}
+		if err := conn.Send(ParityReply, parities); err != nil {
+			return err
+		}
+		stats.reveal(parities.Length)
+
+		// Reveal the syndromes of the blocks whose parities differ
+		odd, err := conn.Receive(ParityRequest)
+		if err != nil {
+			return err
+		}
+		if odd.Length != parities.Length {
+			return ErrMalformed
+		}
+		syndromes := bitstring.NewBitString()
+		for b, differs := range odd.Data {
+			if differs {
+				hi := int(math.Min(float64((b+1)*size), float64(key.Length)))
+				syndromes = syndromes.Extend(bitstring.BitStringFromInt(m, hammingSyndrome(key, perm, b*size, hi)))
+			}
+		}
+		if err := conn.Send(ParityReply, syndromes); err != nil {
+			return err
+		}
+		stats.reveal(syndromes.Length)
+	}
+}
+
+// Bob's side of Winnow, correcting [key] with the parities and syndromes of Alice's
+func (w Winnow) Correct(conn *Conn, key *bitstring.BitString, seed int, qber float64,
+	stats *Stats) (*bitstring.BitString, error) {
+	corrected := key.Copy()
+	first := winnowBlockBits(qber)
+	for pass, perm := range conn.permutations(seed, key.Length, w.passes()) {
+		m := int(math.Min(maxWinnowBlockBits, float64(first+int(math.Min(float64(pass), winnowBlockGrowth)))))
+		size := 1 << uint(m)
+		if err := conn.Send(ParityRequest, encodeRequest(winnowParities, pass, m, 0)); err != nil {
+			return nil, err
+		}
+		parities, err := conn.Receive(ParityReply)
+		if err != nil {
+			return nil, err
+		}
+		if parities.Length != (key.Length+size-1)/size {
+			return nil, ErrMalformed
+		}
+		stats.reveal(parities.Length)
+
+		// Ask for the syndromes of the blocks whose parities differ from Alice's
+		odd := bitstring.BitStringOfLength(parities.Length)
+		for b, parity := range parities.Data {
+			hi := int(math.Min(float64((b+1)*size), float64(key.Length)))
+			odd.Data[b] = parity != (rangeParity(corrected, perm, b*size, hi) == 1)
+		}
+		if err := conn.Send(ParityRequest, odd); err != nil {
+			return nil, err
+		}
+		syndromes, err := conn.Receive(ParityReply)
+		if err != nil {
+			return nil, err
+		}
+		if syndromes.Length != odd.Ones()*m {
+			return nil, ErrMalformed
+		}
+		stats.reveal(syndromes.Length)
+
+		// Flip the bit at the difference of the syndromes in each odd block, unless it falls outside a short block
+		start := 0
+		for b, differs := range odd.Data {
+			if !differs {
+				continue
+			}
+			lo, hi := b*size, int(math.Min(float64((b+1)*size), float64(key.Length)))
+			i := lo + (syndromes.Substring(start, m).Int() ^ hammingSyndrome(corrected, perm, lo, hi))
+			if i < hi {
+				corrected.Invert(perm[i])
+			}
+			start += m
+		}
+	}
+
+	stats.Corrected += differences(corrected, key)
+	return corrected, conn.Send(ParityRequest, encodeRequest(winnowDone, 0, 0, 0))
+}
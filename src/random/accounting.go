@@ -0,0 +1,170 @@
+package random
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"reflect"
+)
+
+const (
+	entropySecurity   = 32                           // Security parameter used when crediting extractor output
+	DefaultEntropyErr = 1.0 / (1 << entropySecurity) // Largest statistical error accepted by a generator's policy
+	defaultReportBits = 256                          // Output length used by Generator.Report
+)
+
+// A bound on the quality of the next n bits produced by an extractable: the output is within statistical distance
+// Error of a distribution with at least MinEntropy bits of min-entropy
+type EntropyBound struct {
+	MinEntropy float64
+	Error      float64
+	Known      bool // False if some source in the tree has no declared min-entropy, or some node has no proven bound
+	IID        bool // Whether the bits are independent and identically distributed, which only a declaration shows
+}
+
+// Reports whether the bound justifies returning [n] bits as uniform with an error of at most [epsilon]
+func (b EntropyBound) Justifies(n int, epsilon float64) bool {
+	return b.Known && b.MinEntropy >= float64(n) && b.Error <= epsilon
+}
+
+func (b EntropyBound) String() string {
+	if !b.Known {
+		return "unknown"
+	}
+	if b.Error == 0 {
+		return fmt.Sprintf("min-entropy %.2f, error 0", b.MinEntropy)
+	}
+	return fmt.Sprintf("min-entropy %.2f, error 2^%.1f", b.MinEntropy, math.Log2(b.Error))
+}
+
+// Implemented by extractables able to bound the entropy of their output
+type EntropyAccountable interface {
+	Extractable
+	EntropyBound(n int) EntropyBound
+}
+
+// An input of an extractor, along with the number of bits the extractor reads from it to produce its output
+type entropyInput struct {
+	name string
+	e    Extractable
+	n    int
+}
+
+// Implemented by extractables built from other extractables, so a report can descend the tree
+type entropyComposite interface {
+	entropyInputs(n int) []entropyInput
+}
+
+// Bounds the output of [e] when [n] bits are requested, which is unknown if [e] does not account for its entropy
+func boundOf(e Extractable, n int) EntropyBound {
+	if a, ok := e.(EntropyAccountable); ok {
+		return a.EntropyBound(n)
+	}
+	return EntropyBound{}
+}
+
+// Bound for a source producing [rate] bits of min-entropy per output bit. Full min-entropy can only come from
+// uniform, and so independent, bits
+func rateBound(rate float64, n int) EntropyBound {
+	return EntropyBound{rate * float64(n), 0, true, rate == 1}
+}
+
+// Bound for an extractor producing [n] bits from [k] bits of usable min-entropy, for which an m bit output is
+// 2^-((k-m)/2) close to uniform, as the leftover hash lemma gives. If k is too small for all n bits to be credited
+// with entropySecurity bits of security, only as many bits as can be are credited
+func extractorBound(n int, k, inputError float64) EntropyBound {
+	m := float64(n)
+	if k < m+2*entropySecurity {
+		m = math.Max(0, math.Floor(k-2*entropySecurity))
+	}
+	if m == 0 {
+		return EntropyBound{0, inputError, true, false}
+	}
+	return EntropyBound{m, math.Min(1, math.Pow(2, -(k-m)/2)+inputError), true, false}
+}
+
+// Wraps an input whose min-entropy rate has been established separately, for instance by an SP 800-90B assessment
+type DeclaredInput struct {
+	input Extractable
+	rate  float64
+	iid   bool
+}
+
+// Declares that [input] produces [rate] bits of min-entropy per bit, panicking if the rate is not in (0, 1]
+func NewDeclaredInput(input Extractable, rate float64) *DeclaredInput {
+	if rate <= 0 || rate > 1 {
+		panic("DeclaredInput: min-entropy rate must be in (0, 1]")
+	}
+	return &DeclaredInput{input, rate, false}
+}
+
+// Declares that [input] produces independent, identically distributed bits with [rate] bits of min-entropy per bit,
+// as an IID assessment may show, panicking if the rate is not in (0, 1]
+func NewDeclaredIIDInput(input Extractable, rate float64) *DeclaredInput {
+	i := NewDeclaredInput(input, rate)
+	i.iid = true
+	return i
+}
+
+func (i *DeclaredInput) GetBits(n int) *bitstring.BitString {
+	return i.input.GetBits(n)
+}
+
+func (i *DeclaredInput) EntropyBound(n int) EntropyBound {
+	b := rateBound(i.rate, n)
+	b.IID = b.IID || i.iid
+	return b
+}
+
+func (i *DeclaredInput) entropyInputs(n int) []entropyInput {
+	return []entropyInput{{"declared", i.input, n}}
+}
+
+// The bound of one node of an extractor tree, along with the bounds of its inputs
+type EntropyReport struct {
+	Role   string // How the parent node uses this input, empty for the root
+	Name   string
+	Bits   int // Number of bits requested from this node
+	Bound  EntropyBound
+	Inputs []*EntropyReport
+}
+
+// Builds the report for the tree rooted at [e] when [n] bits are requested
+func reportOf(role string, e Extractable, n int) *EntropyReport {
+	r := &EntropyReport{Role: role, Name: typeName(e), Bits: n, Bound: boundOf(e, n)}
+	if c, ok := e.(entropyComposite); ok {
+		for _, in := range c.entropyInputs(n) {
+			r.Inputs = append(r.Inputs, reportOf(in.name, in.e, in.n))
+		}
+	}
+	return r
+}
+
+func (r *EntropyReport) String() string {
+	b := new(bytes.Buffer)
+	r.write(b, 0)
+	return b.String()
+}
+
+func (r *EntropyReport) write(b *bytes.Buffer, depth int) {
+	for i := 0; i < depth; i++ {
+		b.WriteString("  ")
+	}
+	if r.Role != "" {
+		fmt.Fprintf(b, "%s: ", r.Role)
+	}
+	fmt.Fprintf(b, "%s (%d bits): %s\n", r.Name, r.Bits, r.Bound)
+	for _, in := range r.Inputs {
+		in.write(b, depth+1)
+	}
+}
+
+// Name of an extractable's type, used to label report nodes
+func typeName(e Extractable) string {
+	t := reflect.TypeOf(e)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
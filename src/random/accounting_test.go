@@ -0,0 +1,143 @@
+package random
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Input repeating the bits of [s] forever
+func cyclicInput(s string) *MockInput {
+	bits, _ := bitstring.BitStringFromString(s)
+	pos := 0
+	return &MockInput{
+		MockGetBits: func(n int) *bitstring.BitString {
+			bs := bitstring.BitStringOfLength(n)
+			for i := range bs.Data {
+				bs.Data[i] = bits.At(pos % bits.Length)
+				pos++
+			}
+			return bs
+		},
+	}
+}
+
+func TestExtractorBound(t *testing.T) {
+	cases := []struct {
+		n          int
+		k          float64
+		minEntropy float64
+		log2Error  float64
+	}{
+		{64, 512, 64, -224},
+		{64, 128, 64, -32},
+		{64, 100, 36, -32},
+		{64, 60, 0, math.Inf(-1)},
+	}
+	for _, c := range cases {
+		b := extractorBound(c.n, c.k, 0)
+		if b.MinEntropy != c.minEntropy || math.Log2(b.Error) != c.log2Error {
+			t.Errorf("extractorBound(%d, %g) == %v, expected min-entropy %g, error 2^%g", c.n, c.k, b,
+				c.minEntropy, c.log2Error)
+		}
+	}
+}
+
+func TestEntropyBounds(t *testing.T) {
+	full := NewDeclaredInput(i1, 1)
+	half := NewDeclaredInput(i1, 0.5)
+	cases := []struct {
+		name       string
+		e          Extractable
+		known      bool
+		minEntropy float64
+		justified  bool // Whether 64 bits are justified at the default error
+	}{
+		{"undeclared", i1, false, 0, false},
+		{"declared", half, true, 32, false},
+		// The blocks are not multiplied in GF(2^n), so the two-source bound does not apply
+		{"inner product", NewInnerProductExtractor(full, full), false, 0, false},
+		{"toeplitz", NewToeplitzExtractor(NewDeclaredInput(i1, 0.75), full, 2), true, 32, false},
+		{"toeplitz, weak seed", NewToeplitzExtractor(full, half, 2), true, 0, false},
+		{"von neumann", NewVonNeumannExtractor(NewDeclaredIIDInput(i1, 0.5)), true, 64, true},
+		{"von neumann, full entropy", NewVonNeumannExtractor(full), true, 64, true},
+		{"von neumann, not iid", NewVonNeumannExtractor(half), false, 0, false},
+		// The walk's nodes come from a PRNG, so the start vertex never reaches the output
+		{"random walk", NewRandomWalkExtractor(full, full), false, 0, false},
+	}
+	for _, c := range cases {
+		b := boundOf(c.e, 64)
+		if b.Known != c.known || b.MinEntropy != c.minEntropy {
+			t.Errorf("%s: bound == %v, expected known %t, min-entropy %g", c.name, b, c.known, c.minEntropy)
+		}
+		if b.Justifies(64, DefaultEntropyErr) != c.justified {
+			t.Errorf("%s: bound %v justifies 64 bits: %t, expected %t", c.name, b, !c.justified, c.justified)
+		}
+	}
+}
+
+func TestVonNeumannExtractor(t *testing.T) {
+	e := NewVonNeumannExtractor(cyclicInput("0110001101"))
+	got := e.GetBits(6).String()
+	if got != "010010" {
+		t.Errorf("VonNeumannExtractor.GetBits(6) == %s, expected 010010", got)
+	}
+}
+
+func TestToeplitzHash(t *testing.T) {
+	seed, _ := bitstring.BitStringFromString("1101")
+	x, _ := bitstring.BitStringFromString("101")
+	if got := ToeplitzHash(seed, x, 2).String(); got != "10" {
+		t.Errorf("ToeplitzHash(1101, 101, 2) == %s, expected 10", got)
+	}
+
+	// The seed is read once and reused between calls
+	e := NewToeplitzExtractor(cyclicInput("1"), cyclicInput("10"), 2)
+	a := e.GetBits(8)
+	b := e.GetBits(8)
+	if !a.Equals(b) {
+		t.Errorf("ToeplitzExtractor.GetBits(8) gave %s then %s for constant input", a, b)
+	}
+}
+
+func TestGeneratorEntropyPolicy(t *testing.T) {
+	g := NewGeneratorFromExtractable(i1)
+	g.GetBits(8)
+	if g.Flagged() != 0 {
+		t.Errorf("Generator.Flagged() == %d under EntropyIgnore, expected 0", g.Flagged())
+	}
+
+	g.SetEntropyPolicy(EntropyFlag, 0)
+	g.GetBits(8)
+	g.NextInt()
+	if g.Flagged() != 2 {
+		t.Errorf("Generator.Flagged() == %d, expected 2", g.Flagged())
+	}
+
+	g.SetEntropyPolicy(EntropyRefuse, 0)
+	if _, err := g.TryGetBits(8); err == nil {
+		t.Error("Generator.TryGetBits(8) succeeded for an undeclared input")
+	}
+
+	g = NewGeneratorFromExtractable(NewToeplitzExtractor(NewOSRandomInput(), NewOSRandomInput(), 0))
+	g.SetEntropyPolicy(EntropyRefuse, 0)
+	if _, err := g.TryGetBits(64); err != nil {
+		t.Errorf("Generator.TryGetBits(64) refused: %v", err)
+	}
+}
+
+func TestGeneratorReport(t *testing.T) {
+	g := NewGeneratorFromExtractable(NewInnerProductExtractor(NewOSRandomInput(), i1))
+	r := g.Report()
+	if r.Bound.Known || len(r.Inputs) != 2 || !r.Inputs[0].Bound.Known || r.Inputs[1].Bound.Known {
+		t.Errorf("Generator.Report() gave unexpected bounds:\n%s", r)
+	}
+	s := r.String()
+	for _, want := range []string{"InnerProductExtractor (256 bits)", "input1: OSRandomInput (2048 bits)",
+		"input2: MockInput (2048 bits): unknown"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Generator.Report() missing %q:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package random
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const minUniformitySequences = 55 // Fewest sequences for which the uniformity of P values is meaningful
+
+// Results of running every check over many sequences from the same source, as reported by NIST's assess tool
+type Assessment struct {
+	Sequences    int
+	Length       int
+	Significance float64
+	Summaries    []Summary // One summary per P value of each test, in the order the tests are run
+}
+
+// Runs the checks selected by [options] over [sequences] sequences of [length] bits read from [source], summarising
+// each P value by the proportion of sequences passing and its uniformity
+func Assess(source Extractable, sequences, length int, options CheckOptions) *Assessment {
+	var names []string
+	var alpha float64
+	results := make(map[string][]TestResult)
+	for i := 0; i < sequences; i++ {
+		_, rs := CheckRandom(source.GetBits(length), options)
+		for _, result := range rs {
+			alpha = result.Significance
+			for _, r := range result.perPValue() {
+				if _, seen := results[r.Name]; !seen {
+					names = append(names, r.Name)
+				}
+				results[r.Name] = append(results[r.Name], r)
+			}
+		}
+	}
+
+	a := &Assessment{Sequences: sequences, Length: length, Significance: alpha}
+	for _, name := range names {
+		a.Summaries = append(a.Summaries, Summarise(name, results[name]))
+	}
+	return a
+}
+
+// Reports whether every test passed on the proportion of passing sequences, and on the uniformity of its P values
+// when there were enough sequences to judge it. Tests inconclusive for every sequence are ignored
+func (a *Assessment) Passed() bool {
+	for _, s := range a.Summaries {
+		if s.Count == 0 {
+			continue
+		}
+		if !s.ProportionPassed || (s.Count >= minUniformitySequences && !s.UniformityPassed) {
+			return false
+		}
+	}
+	return true
+}
+
+// Formats the assessment in the layout of the finalAnalysisReport.txt file written by NIST's assess tool
+func (a *Assessment) String() string {
+	rule := strings.Repeat("-", 78)
+	dashes := strings.Repeat("- ", 39) + "-"
+	b := new(bytes.Buffer)
+	fmt.Fprintln(b, rule)
+	fmt.Fprintln(b, "RESULTS FOR THE UNIFORMITY OF P-VALUES AND THE PROPORTION OF PASSING SEQUENCES")
+	fmt.Fprintln(b, rule)
+	fmt.Fprintf(b, "   %d sequences of %d bits\n", a.Sequences, a.Length)
+	fmt.Fprintln(b, rule)
+	fmt.Fprintln(b, " C1  C2  C3  C4  C5  C6  C7  C8  C9 C10  P-VALUE  PROPORTION  STATISTICAL TEST")
+	fmt.Fprintln(b, rule)
+	for _, s := range a.Summaries {
+		for _, f := range s.Histogram {
+			fmt.Fprintf(b, "%3d ", f)
+		}
+		if s.Count == 0 {
+			fmt.Fprintf(b, "   ----     %9s    %s (inconclusive)\n", "----", s.Name)
+			continue
+		}
+		if s.Count >= minUniformitySequences {
+			fmt.Fprintf(b, " %8.6f %s", s.Uniformity, failureMark(s.UniformityPassed))
+		} else {
+			fmt.Fprint(b, "   ----    ")
+		}
+		fmt.Fprintf(b, " %4d/%-4d %s  %s\n", s.Passed, s.Count, failureMark(s.ProportionPassed), s.Name)
+	}
+
+	// Minimum pass rates, quoted separately for the random excursion tests if they were run over fewer sequences
+	fmt.Fprintln(b, dashes)
+	fmt.Fprintf(b, "The minimum pass rate for each statistical test with the exception of the\n"+
+		"random excursion (variant) test is approximately = %d for a\nsample size = %d binary sequences.\n",
+		minimumPasses(a.Sequences, a.Significance), a.Sequences)
+	for _, s := range a.Summaries {
+		if strings.HasPrefix(s.Name, "Random Excursions") && s.Count > 0 && s.Count != a.Sequences {
+			fmt.Fprintf(b, "\nThe minimum pass rate for the random excursion (variant) test\n"+
+				"is approximately = %d for a sample size = %d binary sequences.\n", minimumPasses(s.Count, a.Significance), s.Count)
+			break
+		}
+	}
+	fmt.Fprintln(b, dashes)
+	return b.String()
+}
+
+// Marks a failing summary in the report
+func failureMark(passed bool) string {
+	if passed {
+		return " "
+	}
+	return "*"
+}
+
+// Lower end of the confidence interval of section 4.2.1 for the number of passing sequences out of [k] at
+// significance level [alpha], truncated as assess does when reporting it
+func minimumPasses(k int, alpha float64) int {
+	if k == 0 {
+		return 0
+	}
+	p := 1 - alpha
+	return int(float64(k) * (p - 3*math.Sqrt(p*(1-p)/float64(k))))
+}
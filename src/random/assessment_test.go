@@ -0,0 +1,53 @@
+package random
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssess(t *testing.T) {
+	a := Assess(NewPseudoRandomExtractor(42), 10, 1000, CheckOptions{})
+	_, results := CheckRandom(NewPseudoRandomExtractor(42).GetBits(1000), CheckOptions{})
+	pvalues := 0
+	for _, r := range results {
+		pvalues += len(r.PValues)
+	}
+	if len(a.Summaries) != pvalues {
+		t.Fatalf("Assess gave %d summaries, want one per P value (%d)", len(a.Summaries), pvalues)
+	}
+	for _, s := range a.Summaries {
+		if s.Count+s.Inconclusive != 10 {
+			t.Errorf("Summary %q covers %d sequences, want 10", s.Name, s.Count+s.Inconclusive)
+		}
+	}
+	report := a.String()
+	for _, want := range []string{"RESULTS FOR THE UNIFORMITY OF P-VALUES", " C1  C2  C3", "Frequency",
+		"approximately = 8 for a\nsample size = 10 binary sequences", "Linear Complexity (500) (inconclusive)", "Serial (P2)"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Assessment report missing %q:\n%s", want, report)
+		}
+	}
+
+	a = Assess(cyclicInput("0"), 10, 128, CheckOptions{})
+	if a.Passed() {
+		t.Error("Assess(zeros).Passed() == true, want false")
+	}
+	if report := a.String(); !strings.Contains(report, "0/10   *  Frequency") {
+		t.Errorf("Assessment report does not mark the failed frequency test:\n%s", report)
+	}
+}
+
+func TestMinimumPasses(t *testing.T) {
+	cases := []struct {
+		k, want int
+	}{
+		{100, 96},
+		{1000, 980},
+		{0, 0},
+	}
+	for _, c := range cases {
+		if got := minimumPasses(c.k, DefaultSignificance); got != c.want {
+			t.Errorf("minimumPasses(%d) == %d, want %d", c.k, got, c.want)
+		}
+	}
+}
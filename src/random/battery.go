@@ -0,0 +1,621 @@
+/* A battery of empirical tests in the style of TestU01's SmallCrush and Dieharder, described in
+ * http://simul.iro.umontreal.ca/testu01/guideshorttestu01.pdf
+ *
+ * Unlike the NIST checks, which test a fixed sequence, each test reads as many bits as it needs from an Extractable.
+ * Values are read TestU01 style, as 32 bit words of which the [r] most significant bits are dropped
+ */
+
+package random
+
+import (
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"sort"
+)
+
+const (
+	wordBits            = 32 // Bits in each word read from a source
+	minExpectedPerClass = 5  // Classes of a chisq test are merged until each is expected this many times
+)
+
+// Tests run by RunBattery, with parameters scaled down from SmallCrush so the battery runs in seconds. The birthday
+// spacings and collision tests drop the high bits of each word, as the low bits of a linear congruential generator
+// have the shortest periods
+var batteryChecks = []struct {
+	name string
+	run  func(source Extractable) TestResult
+}{
+	{"birthday-spacings", func(source Extractable) TestResult {
+		return BirthdaySpacingsCheck(source, 4, 1<<17, 8, 24, 2)
+	}},
+	{"collision", func(source Extractable) TestResult {
+		return CollisionCheck(source, 1, 1<<16, 24, 7, 4)
+	}},
+	{"gap", func(source Extractable) TestResult {
+		return GapCheck(source, 20000, 0, 0, 1.0/16)
+	}},
+	{"poker", func(source Extractable) TestResult {
+		return PokerCheck(source, 20000, 0, 8, 5)
+	}},
+	{"coupon-collector", func(source Extractable) TestResult {
+		return CouponCollectorCheck(source, 10000, 0, 8, 40)
+	}},
+	{"max-of-t", func(source Extractable) TestResult {
+		return MaxOfTCheck(source, 20000, 0, 100, 6)
+	}},
+	{"weight-distribution", func(source Extractable) TestResult {
+		return WeightDistributionCheck(source, 20000, 0, 64, 0, 0.125)
+	}},
+	{"random-walk", func(source Extractable) TestResult {
+		return RandomWalkCheck(source, 10000, 100)
+	}},
+	{"matrix-rank", func(source Extractable) TestResult {
+		return MatrixRankCheck(source, 100, 128)
+	}},
+	{"hamming-weight-dependency", func(source Extractable) TestResult {
+		return HammingWeightDependencyCheck(source, 100000, 32)
+	}},
+}
+
+// Names of the tests RunBattery can run
+func BatteryNames() []string {
+	names := make([]string, len(batteryChecks))
+	for i, c := range batteryChecks {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Runs the battery over bits read from [source], returning whether no test failed and the result of every test. The
+// options are those of CheckRandom, with tests named from BatteryNames. Panics if [options] names an unknown test or
+// a significance level outside (0, 1)
+func RunBattery(source Extractable, options CheckOptions) (bool, []TestResult) {
+	alpha := options.Significance
+	if alpha == 0 {
+		alpha = DefaultSignificance
+	}
+	if alpha < 0 || alpha >= 1 {
+		panic("RunBattery: significance must be in (0, 1)")
+	}
+	selected := make(map[string]bool)
+	for _, name := range options.Tests {
+		selected[name] = true
+	}
+	for _, c := range batteryChecks {
+		delete(selected, c.name)
+	}
+	for name := range selected {
+		panic(fmt.Sprintf("RunBattery: unknown test %q", name))
+	}
+	for _, name := range options.Tests {
+		selected[name] = true
+	}
+
+	passed := true
+	var results []TestResult
+	for _, c := range batteryChecks {
+		if len(selected) > 0 && !selected[c.name] {
+			continue
+		}
+		r := c.run(source).WithSignificance(alpha)
+		passed = passed && r.Status != StatusFail
+		results = append(results, r)
+	}
+	return passed, results
+}
+
+// Birthday spacings test (smarsa_BirthdaySpacings). Each of [N] repetitions throws [n] birthdays into 2^(d*t) days,
+// each birthday being made of [d] bits from [t] words, and counts the spacings between sorted birthdays that repeat
+// an earlier spacing. The total is approximately Poisson with mean N*n^3/(4k)
+func BirthdaySpacingsCheck(source Extractable, N, n, r, d, t int) TestResult {
+	if d*t > 62 {
+		panic("BirthdaySpacingsCheck: d*t must be at most 62")
+	}
+	name := fmt.Sprintf("Birthday Spacings (d = %d, t = %d)", d, t)
+	k := math.Pow(2, float64(d*t))
+	lambda := float64(N) * math.Pow(float64(n), 3) / (4 * k)
+
+	y := 0
+	for rep := 0; rep < N; rep++ {
+		birthdays := make([]uint64, n)
+		words := readWords(source, n*t, r, d)
+		for i := range birthdays {
+			for j := 0; j < t; j++ {
+				birthdays[i] = birthdays[i]<<uint(d) | words[i*t+j]
+			}
+		}
+		sortWords(birthdays)
+		spacings := make([]uint64, n-1)
+		for i := range spacings {
+			spacings[i] = birthdays[i+1] - birthdays[i]
+		}
+		sortWords(spacings)
+		for i := 1; i < len(spacings); i++ {
+			if spacings[i] == spacings[i-1] {
+				y++
+			}
+		}
+	}
+
+	res := newResult(name, N*n*t*wordBits, pValue(poissonP(y, lambda))).
+		withParameters(Value{"N", float64(N)}, Value{"n", float64(n)}, Value{"r", float64(r)},
+			Value{"d", float64(d)}, Value{"t", float64(t)}).
+		withStatistics(Value{"collisions", float64(y)}, Value{"lambda", lambda})
+	if lambda < 1 || lambda > 100 {
+		return res.insufficient("lambda = %g, the Poisson approximation needs a mean between 1 and 100", lambda)
+	}
+	return res
+}
+
+// Collision test (smarsa_CollisionOver). Each of [N] repetitions throws [n] balls into 2^(d*t) urns, each ball being
+// made of [d] bits from [t] words, and counts the balls landing in an occupied urn. In the sparse case the total is
+// approximately Poisson
+func CollisionCheck(source Extractable, N, n, r, d, t int) TestResult {
+	if d*t > 62 {
+		panic("CollisionCheck: d*t must be at most 62")
+	}
+	name := fmt.Sprintf("Collision (d = %d, t = %d)", d, t)
+	k := math.Pow(2, float64(d*t))
+
+	// Expected collisions are n - k(1 - (1 - 1/k)^n), computed without cancellation for large k
+	mu := float64(N) * (float64(n) + k*math.Expm1(float64(n)*math.Log1p(-1/k)))
+
+	c := 0
+	for rep := 0; rep < N; rep++ {
+		urns := make(map[uint64]bool, n)
+		words := readWords(source, n*t, r, d)
+		for i := 0; i < n; i++ {
+			var ball uint64
+			for j := 0; j < t; j++ {
+				ball = ball<<uint(d) | words[i*t+j]
+			}
+			if urns[ball] {
+				c++
+			}
+			urns[ball] = true
+		}
+	}
+
+	res := newResult(name, N*n*t*wordBits, pValue(poissonP(c, mu))).
+		withParameters(Value{"N", float64(N)}, Value{"n", float64(n)}, Value{"r", float64(r)},
+			Value{"d", float64(d)}, Value{"t", float64(t)}).
+		withStatistics(Value{"collisions", float64(c)}, Value{"mu", mu})
+	switch {
+	case float64(n) > k/4:
+		return res.insufficient("n = %d balls in %g urns is not sparse", n, k)
+	case mu < 1:
+		return res.insufficient("mu = %g, at least one collision must be expected", mu)
+	}
+	return res
+}
+
+// Gap test (sknuth_Gap). Reads uniforms until [n] gaps have been seen between values falling in [alpha, beta),
+// comparing the lengths of the gaps against the geometric distribution
+func GapCheck(source Extractable, n, r int, alpha, beta float64) TestResult {
+	if alpha < 0 || beta > 1 || alpha >= beta {
+		panic("GapCheck: 0 <= alpha < beta <= 1 is required")
+	}
+	name := fmt.Sprintf("Gap [%g, %g)", alpha, beta)
+	p := beta - alpha
+
+	// Gaps of length t or more share a class, where t is chosen so that class is expected often enough
+	t := int(math.Max(1, math.Log(minExpectedPerClass/float64(n))/math.Log1p(-p)))
+	probs := make([]float64, t+1)
+	for j := 0; j < t; j++ {
+		probs[j] = p * math.Pow(1-p, float64(j))
+	}
+	probs[t] = math.Pow(1-p, float64(t))
+
+	counts := make([]int, t+1)
+	read, gap := 0, 0
+	for gaps := 0; gaps < n; {
+		for _, u := range readUniforms(source, n, r) {
+			read++
+			if u >= alpha && u < beta {
+				counts[int(math.Min(float64(gap), float64(t)))]++
+				gap = 0
+				if gaps++; gaps == n {
+					break
+				}
+			} else {
+				gap++
+			}
+		}
+	}
+
+	chi, df, pv := chiSquareP(counts, probs)
+	res := newResult(name, read*wordBits, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"r", float64(r)}, Value{"alpha", alpha}, Value{"beta", beta}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d gaps leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Poker test (sknuth_SimpPoker). Splits [n] hands of [k] values in [0, d) and compares the number of distinct values
+// in each hand against its distribution
+func PokerCheck(source Extractable, n, r, d, k int) TestResult {
+	name := fmt.Sprintf("Poker (d = %d, k = %d)", d, k)
+
+	// P(s distinct values) = d(d-1)...(d-s+1) S(k, s) / d^k
+	s2 := stirling2(k)
+	probs := make([]float64, k+1)
+	for s := 1; s <= k && s <= d; s++ {
+		falling := 1.0
+		for i := 0; i < s; i++ {
+			falling *= float64(d - i)
+		}
+		probs[s] = falling * s2[k][s] / math.Pow(float64(d), float64(k))
+	}
+
+	counts := make([]int, k+1)
+	us := readUniforms(source, n*k, r)
+	for h := 0; h < n; h++ {
+		seen := make(map[int]bool, k)
+		for _, u := range us[h*k : (h+1)*k] {
+			seen[int(u*float64(d))] = true
+		}
+		counts[len(seen)]++
+	}
+
+	chi, df, pv := chiSquareP(counts[1:], probs[1:])
+	res := newResult(name, n*k*wordBits, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"r", float64(r)}, Value{"d", float64(d)}, Value{"k", float64(k)}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d hands leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Coupon collector test (sknuth_CouponCollector). Reads values in [0, d) until each has been seen, recording the
+// lengths of [n] such segments, with lengths of [t] or more sharing a class
+func CouponCollectorCheck(source Extractable, n, r, d, t int) TestResult {
+	if t <= d {
+		panic("CouponCollectorCheck: t > d is required")
+	}
+	name := fmt.Sprintf("Coupon Collector (d = %d)", d)
+
+	// P(length = l) = d! S(l-1, d-1) / d^l for d <= l < t, with the remainder in the final class
+	s2 := stirling2(t)
+	factorial := 1.0
+	for i := 2; i <= d; i++ {
+		factorial *= float64(i)
+	}
+	probs := make([]float64, t-d+1)
+	total := 0.0
+	for l := d; l < t; l++ {
+		probs[l-d] = factorial * s2[l-1][d-1] / math.Pow(float64(d), float64(l))
+		total += probs[l-d]
+	}
+	probs[t-d] = 1 - total
+
+	counts := make([]int, t-d+1)
+	read := 0
+	seen := make(map[int]bool, d)
+	length := 0
+	for segments := 0; segments < n; {
+		for _, u := range readUniforms(source, n, r) {
+			read++
+			length++
+			seen[int(u*float64(d))] = true
+			if len(seen) == d {
+				counts[int(math.Min(float64(length), float64(t)))-d]++
+				seen = make(map[int]bool, d)
+				length = 0
+				if segments++; segments == n {
+					break
+				}
+			}
+		}
+	}
+
+	chi, df, pv := chiSquareP(counts, probs)
+	res := newResult(name, read*wordBits, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"r", float64(r)}, Value{"d", float64(d)}, Value{"t", float64(t)}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d segments leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Maximum-of-t test (sknuth_MaxOft). The maximum of each of [n] groups of [t] uniforms, raised to the power t, is
+// uniform, which is tested with a chisq test over [d] equal classes
+func MaxOfTCheck(source Extractable, n, r, d, t int) TestResult {
+	name := fmt.Sprintf("Max-of-t (t = %d)", t)
+	counts := make([]int, d)
+	us := readUniforms(source, n*t, r)
+	for g := 0; g < n; g++ {
+		max := 0.0
+		for _, u := range us[g*t : (g+1)*t] {
+			max = math.Max(max, u)
+		}
+		counts[int(math.Pow(max, float64(t))*float64(d))]++
+	}
+	probs := make([]float64, d)
+	for i := range probs {
+		probs[i] = 1 / float64(d)
+	}
+
+	chi, df, pv := chiSquareP(counts, probs)
+	res := newResult(name, n*t*wordBits, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"r", float64(r)}, Value{"d", float64(d)}, Value{"t", float64(t)}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d groups leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Weight distribution test (svaria_WeightDistrib). Counts how many of each of [n] groups of [k] uniforms fall in
+// [alpha, beta), comparing the counts against the binomial distribution
+func WeightDistributionCheck(source Extractable, n, r, k int, alpha, beta float64) TestResult {
+	if alpha < 0 || beta > 1 || alpha >= beta {
+		panic("WeightDistributionCheck: 0 <= alpha < beta <= 1 is required")
+	}
+	name := fmt.Sprintf("Weight Distribution (k = %d)", k)
+	counts := make([]int, k+1)
+	us := readUniforms(source, n*k, r)
+	for g := 0; g < n; g++ {
+		w := 0
+		for _, u := range us[g*k : (g+1)*k] {
+			if u >= alpha && u < beta {
+				w++
+			}
+		}
+		counts[w]++
+	}
+
+	chi, df, pv := chiSquareP(counts, binomialProbabilities(k, beta-alpha))
+	res := newResult(name, n*k*wordBits, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"r", float64(r)}, Value{"k", float64(k)},
+			Value{"alpha", alpha}, Value{"beta", beta}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d groups leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Random walk test (swalk_RandomWalk1). Runs [n] walks of [L] steps, a step up for each one bit and down for each
+// zero, giving the P value H for the final positions of the walks and M for their maximum positions
+func RandomWalkCheck(source Extractable, n, L int) TestResult {
+	name := fmt.Sprintf("Random Walk (L = %d)", L)
+	bs := source.GetBits(n * L)
+	final := make([]int, L+1) // Indexed by the number of steps up
+	max := make([]int, L+1)
+	for w := 0; w < n; w++ {
+		s, m := 0, 0
+		for _, b := range bs.Data[w*L : (w+1)*L] {
+			if b {
+				s++
+			} else {
+				s--
+			}
+			if s > m {
+				m = s
+			}
+		}
+		final[(s+L)/2]++
+		max[m]++
+	}
+
+	// By the reflection principle P(M >= m) = P(S >= m) + P(S > m) for m >= 1, where S is the final position
+	binomial := binomialProbabilities(L, 0.5)
+	atLeast := func(m int) float64 {
+		p := 0.0
+		for ups, q := range binomial {
+			if s := 2*ups - L; s >= m && m > 0 {
+				p += q
+				if s > m {
+					p += q
+				}
+			}
+		}
+		if m <= 0 {
+			return 1
+		}
+		return p
+	}
+	maxProbs := make([]float64, L+1)
+	for m := range maxProbs {
+		maxProbs[m] = atLeast(m) - atLeast(m+1)
+	}
+
+	chiH, dfH, pH := chiSquareP(final, binomial)
+	chiM, dfM, pM := chiSquareP(max, maxProbs)
+	res := newResult(name, n*L, Value{"H", pH}, Value{"M", pM}).
+		withParameters(Value{"n", float64(n)}, Value{"L", float64(L)}).
+		withStatistics(Value{"chi^2 H", chiH}, Value{"chi^2 M", chiM})
+	if dfH < 1 || dfM < 1 {
+		return res.insufficient("n = %d walks leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Matrix rank test (smarsa_MatrixRank) over [n] random [L] x [L] binary matrices, comparing their ranks against the
+// distribution of ranks of random matrices
+func MatrixRankCheck(source Extractable, n, L int) TestResult {
+	name := fmt.Sprintf("Matrix Rank (%dx%d)", L, L)
+	bs := source.GetBits(n * L * L)
+
+	// Ranks below L-3 are vanishingly unlikely, so share the class of rank L-3
+	counts := make([]int, 4)
+	for k := 0; k < n; k++ {
+		rows := make([][]bool, L)
+		for i := range rows {
+			rows[i] = bs.Data[(k*L+i)*L : (k*L+i+1)*L]
+		}
+		counts[int(math.Min(3, float64(L-binaryRank(rows))))]++
+	}
+	probs := make([]float64, 4)
+	total := 0.0
+	for i := 0; i < 3; i++ {
+		probs[i] = rankProbability(L-i, L, L)
+		total += probs[i]
+	}
+	probs[3] = 1 - total
+
+	chi, df, pv := chiSquareP(counts, probs)
+	res := newResult(name, n*L*L, pValue(pv)).
+		withParameters(Value{"n", float64(n)}, Value{"L", float64(L)}).
+		withStatistics(Value{"chi^2", chi}, Value{"df", float64(df)})
+	if df < 1 {
+		return res.insufficient("n = %d matrices leave no degrees of freedom", n)
+	}
+	return res
+}
+
+// Hamming weight dependency test (sstring_HammingCorr). Measures the correlation between the Hamming weights of
+// successive [L] bit blocks over [n] blocks, which is approximately normal with variance 1/(n-1) when they are
+// independent
+func HammingWeightDependencyCheck(source Extractable, n, L int) TestResult {
+	name := fmt.Sprintf("Hamming Weight Dependency (L = %d)", L)
+	bs := source.GetBits(n * L)
+	weights := make([]float64, n)
+	for i := range weights {
+		for _, b := range bs.Data[i*L : (i+1)*L] {
+			if b {
+				weights[i]++
+			}
+		}
+		weights[i] -= float64(L) / 2
+	}
+
+	// Correlation of successive weights, normalised by the known variance L/4 of each weight
+	sum := 0.0
+	for i := 0; i+1 < n; i++ {
+		sum += weights[i] * weights[i+1]
+	}
+	rho := 4 * sum / float64(L*(n-1))
+	z := rho * math.Sqrt(float64(n-1))
+	p := 2 * (1 - stdNormal(math.Abs(z)))
+
+	res := newResult(name, n*L, pValue(p)).
+		withParameters(Value{"n", float64(n)}, Value{"L", float64(L)}).
+		withStatistics(Value{"rho", rho}, Value{"z", z})
+	if n < 100 {
+		return res.insufficient("n = %d, at least 100 blocks are required", n)
+	}
+	return res
+}
+
+// Reads [n] values of [s] bits from [source], each taken from a 32 bit word after dropping its [r] most significant
+// bits
+func readWords(source Extractable, n, r, s int) []uint64 {
+	if r < 0 || s < 1 || r+s > wordBits {
+		panic("readWords: 0 <= r and r+s <= 32 are required")
+	}
+	bs := source.GetBits(n * wordBits)
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = wordAt(bs, i*wordBits+r, s)
+	}
+	return words
+}
+
+// Reads [n] uniforms in [0, 1) from [source], each made of the 32-r bits left after dropping the [r] most
+// significant bits of a word
+func readUniforms(source Extractable, n, r int) []float64 {
+	s := wordBits - r
+	scale := math.Pow(2, -float64(s))
+	words := readWords(source, n, r, s)
+	us := make([]float64, n)
+	for i, w := range words {
+		us[i] = float64(w) * scale
+	}
+	return us
+}
+
+// The [s] bit integer starting at bit [i] of [bs], most significant bit first
+func wordAt(bs *bitstring.BitString, i, s int) uint64 {
+	var w uint64
+	for _, b := range bs.Data[i : i+s] {
+		w <<= 1
+		if b {
+			w |= 1
+		}
+	}
+	return w
+}
+
+func sortWords(ws []uint64) {
+	sort.Slice(ws, func(i, j int) bool { return ws[i] < ws[j] })
+}
+
+// Two sided P value of observing [y] from a Poisson distribution with mean [lambda]
+func poissonP(y int, lambda float64) float64 {
+	lower := igamc(float64(y+1), lambda) // P(X <= y)
+	upper := 1.0                         // P(X >= y)
+	if y > 0 {
+		upper = igamcP(float64(y), lambda)
+	}
+	return math.Min(1, 2*math.Min(lower, upper))
+}
+
+// Chisq test of [counts] against the class probabilities [probs], merging neighbouring classes until each is expected
+// at least minExpectedPerClass times. Returns the statistic, its degrees of freedom and the P value
+func chiSquareP(counts []int, probs []float64) (float64, int, float64) {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+
+	// Merge classes from the start, folding any final class that is expected too rarely into the one before
+	var observed, expected []float64
+	o, e := 0.0, 0.0
+	for i, c := range counts {
+		o += float64(c)
+		e += probs[i] * float64(n)
+		if e >= minExpectedPerClass {
+			observed = append(observed, o)
+			expected = append(expected, e)
+			o, e = 0, 0
+		}
+	}
+	if k := len(expected); k > 0 {
+		observed[k-1] += o
+		expected[k-1] += e
+	}
+
+	chi := 0.0
+	for i := range observed {
+		chi += math.Pow(observed[i]-expected[i], 2) / expected[i]
+	}
+	df := len(expected) - 1
+	if df < 1 {
+		return chi, 0, 0
+	}
+	return chi, df, igamc(float64(df)/2, chi/2)
+}
+
+// Probabilities of each number of successes in [k] trials with success probability [p]
+func binomialProbabilities(k int, p float64) []float64 {
+	probs := make([]float64, k+1)
+	lk, _ := math.Lgamma(float64(k + 1))
+	for i := range probs {
+		li, _ := math.Lgamma(float64(i + 1))
+		lki, _ := math.Lgamma(float64(k - i + 1))
+		probs[i] = math.Exp(lk - li - lki + float64(i)*math.Log(p) + float64(k-i)*math.Log1p(-p))
+	}
+	return probs
+}
+
+// Table of Stirling numbers of the second kind S(i, j) for i, j <= [n], the number of ways to partition i items into
+// j non-empty sets
+func stirling2(n int) [][]float64 {
+	s := make([][]float64, n+1)
+	for i := range s {
+		s[i] = make([]float64, n+1)
+	}
+	s[0][0] = 1
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= i; j++ {
+			s[i][j] = float64(j)*s[i-1][j] + s[i-1][j-1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package random
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"testing"
+)
+
+// Deterministic input of good quality, the SHA-256 hashes of successive counter values
+func hashInput() *MockInput {
+	var counter uint64
+	var block []byte
+	return &MockInput{
+		MockGetBits: func(n int) *bitstring.BitString {
+			bs := bitstring.BitStringOfLength(n)
+			for i := range bs.Data {
+				if len(block) == 0 {
+					var c [8]byte
+					binary.LittleEndian.PutUint64(c[:], counter)
+					counter++
+					sum := sha256.Sum256(c[:])
+					block = sum[:]
+				}
+				bs.Data[i] = block[0]&(1<<uint(7-i%8)) != 0
+				if i%8 == 7 {
+					block = block[1:]
+				}
+			}
+			return bs
+		},
+	}
+}
+
+func TestRunBattery(t *testing.T) {
+	if passed, results := RunBattery(hashInput(), CheckOptions{}); !passed {
+		for _, r := range results {
+			t.Errorf("RunBattery(SHA-256) gave %s with P = %f", r.Name, r.P)
+		}
+	}
+
+	// The low bits of the LCG's output have short periods, so their birthdays are anything but random
+	passed, results := RunBattery(NewPseudoRandomExtractor(42),
+		CheckOptions{Tests: []string{"birthday-spacings", "collision"}})
+	if passed || len(results) != 2 || results[0].Status != StatusFail || results[1].Status != StatusFail {
+		t.Errorf("RunBattery(PseudoRandomExtractor) == %t, want birthday spacings and collision failures", passed)
+	}
+}
+
+func TestPoissonP(t *testing.T) {
+	cases := []struct {
+		y      int
+		lambda float64
+		want   float64
+	}{
+		{8, 8, 1},
+		{0, 8, 2 * math.Exp(-8)},
+		{1, 1, 1},
+		{4, 1, 2 * (1 - 8/3.0*math.Exp(-1))},
+	}
+	for _, c := range cases {
+		if got := poissonP(c.y, c.lambda); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("poissonP(%d, %g) == %g, want %g", c.y, c.lambda, got, c.want)
+		}
+	}
+}
+
+func TestChiSquareP(t *testing.T) {
+	// The last two classes are each expected too rarely, so are merged
+	want := 25.0/45 + 25.0/5
+	chi, df, p := chiSquareP([]int{50, 40, 8, 2}, []float64{0.5, 0.45, 0.04, 0.01})
+	if df != 2 || math.Abs(chi-want) > 1e-12 || p != igamc(1, chi/2) {
+		t.Errorf("chiSquareP gave chi %f with %d degrees of freedom, want %f with 2", chi, df, want)
+	}
+	if _, df, p := chiSquareP([]int{1, 2}, []float64{0.5, 0.5}); df != 0 || p != 0 {
+		t.Errorf("chiSquareP over 3 samples gave %d degrees of freedom, want 0", df)
+	}
+}
+
+func TestStirling2(t *testing.T) {
+	s := stirling2(10)
+	for _, c := range []struct{ n, k, want int }{{5, 2, 15}, {5, 3, 25}, {10, 4, 34105}, {4, 4, 1}, {4, 0, 0}} {
+		if got := s[c.n][c.k]; got != float64(c.want) {
+			t.Errorf("S(%d, %d) == %g, want %d", c.n, c.k, got, c.want)
+		}
+	}
+
+	// Every distribution used by the battery sums to one
+	sum := 0.0
+	for _, p := range binomialProbabilities(10, 0.3) {
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-12 {
+		t.Errorf("binomialProbabilities(10, 0.3) sum to %g", sum)
+	}
+}
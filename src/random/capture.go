@@ -0,0 +1,228 @@
+package random
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	defaultSampleRate    = 44100
+	defaultChannels      = 1
+	defaultBitsPerSample = 16
+	defaultLSBs          = 1
+	defaultFrameWidth    = 320
+	defaultFrameHeight   = 240
+)
+
+// Options for audio capture, zero values are replaced by defaults
+type AudioOptions struct {
+	SampleRate    int // Samples per second per channel
+	Channels      int // Number of interleaved channels
+	BitsPerSample int // Size of each little-endian PCM sample, one of 8, 16, 24 or 32
+	LSBs          int // Number of least-significant bits kept from every sample
+}
+
+// Options for video capture, zero values are replaced by defaults
+type VideoOptions struct {
+	Width  int
+	Height int
+	LSBs   int // Number of least-significant bits kept from every byte of a frame
+}
+
+func (o *AudioOptions) setDefaults() {
+	if o.SampleRate <= 0 {
+		o.SampleRate = defaultSampleRate
+	}
+	if o.Channels <= 0 {
+		o.Channels = defaultChannels
+	}
+	if o.BitsPerSample <= 0 {
+		o.BitsPerSample = defaultBitsPerSample
+	}
+	if o.LSBs <= 0 {
+		o.LSBs = defaultLSBs
+	}
+	if o.BitsPerSample%8 != 0 || o.BitsPerSample > 32 {
+		panic(fmt.Sprintf("AudioOptions: unsupported sample size %d", o.BitsPerSample))
+	}
+	if o.LSBs > o.BitsPerSample {
+		panic("AudioOptions: cannot keep more bits than there are in a sample")
+	}
+}
+
+func (o *VideoOptions) setDefaults() {
+	if o.Width <= 0 {
+		o.Width = defaultFrameWidth
+	}
+	if o.Height <= 0 {
+		o.Height = defaultFrameHeight
+	}
+	if o.LSBs <= 0 {
+		o.LSBs = defaultLSBs
+	}
+	if o.LSBs > 8 {
+		panic("VideoOptions: cannot keep more than 8 bits of each byte")
+	}
+}
+
+// Input extracting the noisy least-significant bits from a stream of little-endian samples, such as PCM audio or
+// raw video frames
+type SampleInput struct {
+	r           io.Reader
+	sampleBytes int
+	lsbs        int
+	pending     *bitstring.BitString // Extracted bits not yet returned
+	closer      io.Closer
+}
+
+// Builds a new input taking the [lsbs] lowest bits of each [sampleBytes] byte sample read from [r]
+func NewSampleInput(r io.Reader, sampleBytes, lsbs int) *SampleInput {
+	closer, _ := r.(io.Closer)
+	return &SampleInput{r, sampleBytes, lsbs, bitstring.NewBitString(), closer}
+}
+
+// Builds an audio input reading PCM samples from a WAV or raw PCM file at [path]. A WAV header, if present,
+// overrides the sample format given in [opts]
+func NewAudioFileInput(path string, opts AudioOptions) *SampleInput {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("AudioFileInput: could not open '%s': %v\n", path, err))
+	}
+	if err := readWAVHeader(file, &opts); err != nil {
+		file.Close()
+		panic(fmt.Sprintf("AudioFileInput: '%s': %v\n", path, err))
+	}
+	opts.setDefaults()
+	return NewSampleInput(file, opts.BitsPerSample/8, opts.LSBs)
+}
+
+// Closes the arecord process along with its output pipe
+type processReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *processReader) Close() error {
+	r.cmd.Process.Kill()
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// Builds an audio input capturing PCM samples from the ALSA device [device] (e.g. "default" or "hw:1,0") by running
+// arecord, which must be installed from alsa-utils. Returns an error if arecord cannot be started
+func NewArecordInput(device string, opts AudioOptions) (*SampleInput, error) {
+	opts.setDefaults()
+	if device == "" {
+		device = "default"
+	}
+	formats := map[int]string{8: "S8", 16: "S16_LE", 24: "S24_3LE", 32: "S32_LE"}
+	cmd := exec.Command("arecord", "-q", "-t", "raw", "-D", device, "-f", formats[opts.BitsPerSample],
+		"-r", strconv.Itoa(opts.SampleRate), "-c", strconv.Itoa(opts.Channels))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("ArecordInput: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ArecordInput: could not start arecord on '%s': %v", device, err)
+	}
+	return NewSampleInput(&processReader{stdout, cmd}, opts.BitsPerSample/8, opts.LSBs), nil
+}
+
+// Builds a video input reading raw frames (one byte per sample, e.g. YUYV or greyscale) from the file at [path]
+func NewVideoFileInput(path string, opts VideoOptions) *SampleInput {
+	opts.setDefaults()
+	file, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("VideoFileInput: could not open '%s': %v\n", path, err))
+	}
+	return NewSampleInput(file, 1, opts.LSBs)
+}
+
+// Fetches n bits, reading as many samples as needed to extract them
+func (i *SampleInput) GetBits(n int) *bitstring.BitString {
+	if n <= 0 {
+		panic("SampleInput.GetBits(n) requires n > 0")
+	}
+
+	// Read just enough samples to cover the bits still needed
+	if needed := n - i.pending.Length; needed > 0 {
+		samples := (needed-1)/i.lsbs + 1
+		buf := make([]byte, samples*i.sampleBytes)
+		if _, err := io.ReadFull(i.r, buf); err != nil {
+			panic(fmt.Sprintf("SampleInput.GetBits: could not read %d samples: %v", samples, err))
+		}
+		for s := 0; s < samples; s++ {
+			sample := buf[s*i.sampleBytes : (s+1)*i.sampleBytes]
+			i.pending = i.pending.Extend(bitstring.BitStringFromInt(i.lsbs, lowBits(sample, i.lsbs)))
+		}
+	}
+
+	bs := i.pending.First(n)
+	i.pending = i.pending.Substring(n, i.pending.Length-n)
+	return bs
+}
+
+// Closes the underlying capture stream
+func (i *SampleInput) Close() error {
+	if i.closer == nil {
+		return nil
+	}
+	return i.closer.Close()
+}
+
+// Takes the [n] least-significant bits of a little-endian sample
+func lowBits(sample []byte, n int) int {
+	var v int
+	for j := len(sample) - 1; j >= 0; j-- {
+		v = v<<8 | int(sample[j])
+	}
+	return v & (1<<uint(n) - 1)
+}
+
+// Reads a RIFF/WAVE header from [f] into [opts], leaving [f] positioned at the start of the sample data. Files
+// without a RIFF header are treated as raw PCM and left at their start
+func readWAVHeader(f *os.File, opts *AudioOptions) error {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		_, err := f.Seek(0, io.SeekStart)
+		return err
+	}
+
+	// Walk the chunks until the sample data is found
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(f, header[:]); err != nil {
+			return errors.New("no data chunk in WAV file")
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		switch string(header[0:4]) {
+		case "fmt ":
+			var format [16]byte
+			if size < 16 {
+				return errors.New("malformed fmt chunk in WAV file")
+			}
+			if _, err := io.ReadFull(f, format[:]); err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint16(format[0:]) != 1 {
+				return errors.New("only integer PCM WAV files are supported")
+			}
+			opts.Channels = int(binary.LittleEndian.Uint16(format[2:]))
+			opts.SampleRate = int(binary.LittleEndian.Uint32(format[4:]))
+			opts.BitsPerSample = int(binary.LittleEndian.Uint16(format[14:]))
+			size -= 16
+		case "data":
+			return nil
+		}
+		// Skip the rest of the chunk, which is padded to an even length
+		if _, err := f.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package random
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// V4L2 constants from linux/videodev2.h
+const (
+	v4l2BufTypeVideoCapture = 1
+	v4l2FieldAny            = 0
+	v4l2CapReadWrite        = 0x01000000
+	v4l2CapDeviceCaps       = 0x80000000
+	v4l2PixFmtYUYV          = 'Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24
+)
+
+// struct v4l2_capability
+type v4l2Capability struct {
+	Driver       [16]byte
+	Card         [32]byte
+	BusInfo      [32]byte
+	Version      uint32
+	Capabilities uint32
+	DeviceCaps   uint32
+	Reserved     [3]uint32
+}
+
+// struct v4l2_format, where the union is aligned to a pointer as it is in the kernel headers
+type v4l2Format struct {
+	Type uint32
+	Fmt  struct {
+		_   [0]uintptr
+		Pix v4l2PixFormat
+		_   [200 - unsafe.Sizeof(v4l2PixFormat{})]byte
+	}
+}
+
+// struct v4l2_pix_format
+type v4l2PixFormat struct {
+	Width        uint32
+	Height       uint32
+	PixelFormat  uint32
+	Field        uint32
+	BytesPerLine uint32
+	SizeImage    uint32
+	ColorSpace   uint32
+	Priv         uint32
+	Flags        uint32
+	YcbcrEnc     uint32
+	Quantization uint32
+	XferFunc     uint32
+}
+
+var (
+	vidiocQueryCap = ioc(2, 'V', 0, unsafe.Sizeof(v4l2Capability{}))
+	vidiocSFmt     = ioc(3, 'V', 5, unsafe.Sizeof(v4l2Format{}))
+)
+
+// Encodes an ioctl request number as the _IOC macro does
+func ioc(dir, t, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | t<<8 | nr
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Reads whole frames from a V4L2 device, as the read() I/O method requires
+type v4l2Reader struct {
+	file  *os.File
+	frame []byte
+	buf   []byte // Unread part of the last frame
+}
+
+func (r *v4l2Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		n, err := r.file.Read(r.frame)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = r.frame[:n]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *v4l2Reader) Close() error {
+	return r.file.Close()
+}
+
+// Builds a video input capturing YUYV frames from the V4L2 device at [path] (e.g. /dev/video0). The device must
+// support the read() I/O method
+func NewV4L2Input(path string, opts VideoOptions) *SampleInput {
+	opts.setDefaults()
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		panic(fmt.Sprintf("V4L2Input: could not open '%s': %v\n", path, err))
+	}
+
+	// Check the device can be read from directly
+	var capability v4l2Capability
+	if err := ioctl(file.Fd(), vidiocQueryCap, unsafe.Pointer(&capability)); err != nil {
+		file.Close()
+		panic(fmt.Sprintf("V4L2Input: '%s' is not a V4L2 device: %v\n", path, err))
+	}
+	caps := capability.Capabilities
+	if caps&v4l2CapDeviceCaps != 0 {
+		caps = capability.DeviceCaps
+	}
+	if caps&v4l2CapReadWrite == 0 {
+		file.Close()
+		panic(fmt.Sprintf("V4L2Input: '%s' does not support the read() I/O method\n", path))
+	}
+
+	// Request the frame size and format, the driver may adjust these to the closest it supports
+	format := v4l2Format{Type: v4l2BufTypeVideoCapture}
+	format.Fmt.Pix = v4l2PixFormat{Width: uint32(opts.Width), Height: uint32(opts.Height),
+		PixelFormat: v4l2PixFmtYUYV, Field: v4l2FieldAny}
+	if err := ioctl(file.Fd(), vidiocSFmt, unsafe.Pointer(&format)); err != nil {
+		file.Close()
+		panic(fmt.Sprintf("V4L2Input: could not set format on '%s': %v\n", path, err))
+	}
+	size := int(format.Fmt.Pix.SizeImage)
+	if size == 0 {
+		size = int(format.Fmt.Pix.Width * format.Fmt.Pix.Height * 2)
+	}
+
+	return NewSampleInput(&v4l2Reader{file: file, frame: make([]byte, size)}, 1, opts.LSBs)
+}
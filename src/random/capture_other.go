@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package random
+
+// V4L2 capture is only available on Linux
+func NewV4L2Input(path string, opts VideoOptions) *SampleInput {
+	panic("V4L2Input: V4L2 capture is only supported on Linux")
+}
@@ -0,0 +1,75 @@
+package random
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path"
+	"testing"
+)
+
+// Builds a WAV file holding 16 bit mono [samples], with an extra chunk before the data
+func wavFile(samples []int16) []byte {
+	data := new(bytes.Buffer)
+	binary.Write(data, binary.LittleEndian, samples)
+
+	b := new(bytes.Buffer)
+	b.WriteString("RIFF")
+	binary.Write(b, binary.LittleEndian, uint32(4+24+10+8+data.Len()))
+	b.WriteString("WAVEfmt ")
+	binary.Write(b, binary.LittleEndian, []uint32{16})
+	binary.Write(b, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(b, binary.LittleEndian, []uint32{8000, 16000})
+	binary.Write(b, binary.LittleEndian, []uint16{2, 16})
+	b.WriteString("LIST")
+	binary.Write(b, binary.LittleEndian, uint32(1))
+	b.WriteString("x\x00")
+	b.WriteString("data")
+	binary.Write(b, binary.LittleEndian, uint32(data.Len()))
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestAudioFileInput(t *testing.T) {
+	p := tempFile(t, wavFile([]int16{1, 2, 3, -1, 0x100}))
+	defer os.RemoveAll(path.Dir(p))
+
+	// The WAV header overrides the 8 bit sample size given here
+	i := NewAudioFileInput(p, AudioOptions{BitsPerSample: 8, LSBs: 2})
+	defer i.Close()
+	if got := i.GetBits(3).String(); got != "011" {
+		t.Errorf("AudioFileInput.GetBits(3) == %s, wanted 011", got)
+	}
+	if got := i.GetBits(7).String(); got != "0111100" {
+		t.Errorf("AudioFileInput.GetBits(7) == %s, wanted 0111100", got)
+	}
+}
+
+func TestAudioFileInputRaw(t *testing.T) {
+	p := tempFile(t, []byte{0x01, 0xFF, 0x02, 0x00, 0x03, 0x00})
+	defer os.RemoveAll(path.Dir(p))
+
+	i := NewAudioFileInput(p, AudioOptions{BitsPerSample: 16, LSBs: 1})
+	defer i.Close()
+	if got := i.GetBits(3).String(); got != "101" {
+		t.Errorf("AudioFileInput.GetBits(3) on raw PCM == %s, wanted 101", got)
+	}
+}
+
+func TestVideoFileInput(t *testing.T) {
+	p := tempFile(t, []byte{0x10, 0x11, 0x12, 0x13, 0xFE, 0xFF})
+	defer os.RemoveAll(path.Dir(p))
+
+	i := NewVideoFileInput(p, VideoOptions{Width: 3, Height: 1, LSBs: 1})
+	defer i.Close()
+	if got := i.GetBits(6).String(); got != "010101" {
+		t.Errorf("VideoFileInput.GetBits(6) == %s, wanted 010101", got)
+	}
+}
+
+func TestArecordInputMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := NewArecordInput("default", AudioOptions{}); err == nil {
+		t.Error("NewArecordInput() succeeded without arecord installed")
+	}
+}
@@ -1,4 +1,4 @@
-/* Implements some of the NIST randomness statistical tests described in here
+/* Implements the NIST randomness statistical tests described in here
  * http://csrc.nist.gov/publications/nistpubs/800-22-rev1a/SP800-22rev1a.pdf
  *
  * Adam Hosier 2017
@@ -10,286 +10,653 @@ import (
 	"fmt"
 	"github.com/adamhosier/random/src/bitstring"
 	"math"
+	"math/cmplx"
 )
 
-const significance float64 = 0.01
+const (
+	defaultTemplateLength  = 9 // Length of the templates used by the non-overlapping template test, as in NIST's assess
+	defaultTemplateBlocks  = 8 // Number of blocks used by the non-overlapping template test
+	uniformityBins         = 10
+	uniformitySignificance = 0.0001 // P values are considered uniformly distributed above this level
+)
 
-type testResult struct {
-	Name         string
-	P            float64
-	Significance float64
-	Result       bool
+// Options of CheckRandom, zero values are replaced by defaults
+type CheckOptions struct {
+	Significance float64  // Level every P value must reach, DefaultSignificance if zero
+	Tests        []string // Names of the tests to run, from CheckNames, or every test if empty
 }
 
-// Runs all cbecks over [bs] to determine if it appears random or notm returing the result of every check
-func CheckRandom(bs *bitstring.BitString) (bool, []testResult) {
-	// Templates for templace matching checks
-	t1, _ := bitstring.BitStringFromString("010101")
-	t2, _ := bitstring.BitStringFromString("001100")
-	t3, _ := bitstring.BitStringFromString("000111")
+// A test run by CheckRandom, which builds an accumulator with the parameters recommended for a sequence of n bits
+type check struct {
+	name  string
+	suite bool // Whether the test gives many results, judged on the proportion that pass
+	new   func(n int) Accumulator
+}
 
-	// Run all tests
-	results := []testResult{FrequencyCheck(bs), BlockFrequencyCheck(bs, bs.Length/10), RunsCheck(bs),
-		LongestRunCheck(bs), NonOverlappingTemplateMatchingCheck(bs, t1), NonOverlappingTemplateMatchingCheck(bs, t2),
-		NonOverlappingTemplateMatchingCheck(bs, t3), SerialCheck(bs), ApproximateEntropyCheck(bs),
-		CumulativeSumsCheck(bs)}
+// Tests run by CheckRandom in the order of NIST's assess
+var checks = []check{
+	{"frequency", false, func(n int) Accumulator {
+		return NewFrequencyAccumulator()
+	}},
+	{"block-frequency", false, func(n int) Accumulator {
+		return NewBlockFrequencyAccumulator(blockFrequencyBlockSize(n))
+	}},
+	{"cumulative-sums", false, func(n int) Accumulator {
+		return NewCumulativeSumsAccumulator()
+	}},
+	{"runs", false, func(n int) Accumulator {
+		return NewRunsAccumulator()
+	}},
+	{"longest-run", false, func(n int) Accumulator {
+		return NewLongestRunAccumulator(longestRunBlockSize(n))
+	}},
+	{"rank", false, func(n int) Accumulator {
+		return NewBinaryMatrixRankAccumulator(32, 32)
+	}},
+	{"fft", false, func(n int) Accumulator {
+		return NewDiscreteFourierTransformAccumulator(int(math.Min(float64(n), maxFourierBits)))
+	}},
+	{"non-overlapping-template", true, func(n int) Accumulator {
+		return NewNonOverlappingTemplateAccumulator(AperiodicTemplates(defaultTemplateLength), n,
+			defaultTemplateBlocks)
+	}},
+	{"overlapping-template", false, func(n int) Accumulator {
+		t, _ := bitstring.BitStringFromString("111111111")
+		return NewOverlappingTemplateAccumulator(t, 1032)
+	}},
+	{"universal", false, func(n int) Accumulator {
+		L := universalBlockLength(n)
+		return NewMaurersUniversalAccumulator(L, 10*(1<<uint(L)))
+	}},
+	{"approximate-entropy", false, func(n int) Accumulator {
+		return NewApproximateEntropyAccumulator(approximateEntropyBlockLength(n))
+	}},
+	{"random-excursions", false, func(n int) Accumulator {
+		return NewRandomExcursionsAccumulator(false)
+	}},
+	{"random-excursions-variant", false, func(n int) Accumulator {
+		return NewRandomExcursionsAccumulator(true)
+	}},
+	{"serial", false, func(n int) Accumulator {
+		return NewSerialAccumulator(serialBlockLength(n))
+	}},
+	{"linear-complexity", false, func(n int) Accumulator {
+		return NewLinearComplexityAccumulator(500)
+	}},
+}
 
-	// Calculate overall result
-	overallResult := true
-	for _, res := range results {
-		overallResult = overallResult && res.Result
+// Names of the tests CheckRandom can run
+func CheckNames() []string {
+	names := make([]string, len(checks))
+	for i, c := range checks {
+		names[i] = c.name
 	}
+	return names
+}
+
+// Runs all cbecks over [bs] to determine if it appears random or notm returing the result of every check. Tests
+// use the parameters recommended for the length of [bs], and tests for which it is too short are reported as
+// inconclusive rather than counting as failures. The non-overlapping template test is judged on the proportion of
+// its templates that pass, as a few failures are expected among so many. The discrete Fourier transform test only
+// transforms the first 2^20 bits. Panics if [options] names an unknown test or a significance level outside (0, 1)
+func CheckRandom(bs *bitstring.BitString, options CheckOptions) (bool, []TestResult) {
+	alpha, selected := selectChecks("CheckRandom", options)
 
+	// Run the selected tests, calculating the overall result
+	overallResult := true
+	var results []TestResult
+	for _, c := range selected {
+		rs := accumulate(c.new(bs.Length), bs)
+		overallResult = judge(c, rs, alpha) && overallResult
+		results = append(results, rs...)
+	}
 	return overallResult, results
 }
 
+// Validates [options], returning the significance level and the selected checks in order. Panics naming [caller] if
+// a test is unknown or the significance level is outside (0, 1)
+func selectChecks(caller string, options CheckOptions) (float64, []check) {
+	alpha := options.Significance
+	if alpha == 0 {
+		alpha = DefaultSignificance
+	}
+	if alpha < 0 || alpha >= 1 {
+		panic(caller + ": significance must be in (0, 1)")
+	}
+	names := make(map[string]bool)
+	for _, name := range options.Tests {
+		names[name] = true
+	}
+	var selected []check
+	for _, c := range checks {
+		if len(options.Tests) == 0 || names[c.name] {
+			selected = append(selected, c)
+		}
+		delete(names, c.name)
+	}
+	for name := range names {
+		panic(fmt.Sprintf("%s: unknown test %q", caller, name))
+	}
+	return alpha, selected
+}
+
+// Judges the results [rs] of [c] again at significance level [alpha], returning whether the test passed
+func judge(c check, rs []TestResult, alpha float64) bool {
+	passed := true
+	for i := range rs {
+		rs[i] = rs[i].WithSignificance(alpha)
+		passed = passed && rs[i].Status != StatusFail
+	}
+	if c.suite {
+		s := Summarise(c.name, rs)
+		return s.Count == 0 || s.ProportionPassed
+	}
+	return passed
+}
+
+// Block size for the block frequency test, the smallest meeting the recommendations M >= 20 and M > n/100
+func blockFrequencyBlockSize(n int) int {
+	return int(math.Max(20, float64(n/100+1)))
+}
+
+// Largest block size of the longest run test that [n] bits support
+func longestRunBlockSize(n int) int {
+	M := 8
+	for _, size := range []int{128, 10000} {
+		if n >= longestRunParameters[size].minLength {
+			M = size
+		}
+	}
+	return M
+}
+
+// Largest block length of the serial test that [n] bits support, at most 16 as in NIST's assess
+func serialBlockLength(n int) int {
+	return int(math.Min(16, math.Floor(math.Log2(float64(n)))-3))
+}
+
+// Largest block length of the approximate entropy test that [n] bits support, at most 10 as in NIST's assess
+func approximateEntropyBlockLength(n int) int {
+	return int(math.Min(10, math.Floor(math.Log2(float64(n)))-6))
+}
+
 // Tests that the proportion of ones and zeros are approximately equal
-func FrequencyCheck(bs *bitstring.BitString) testResult {
-	// Sum over each bit, where a zero is worth -1 and a one is worth 1
-	var sum int
-	for _, b := range bs.Data {
+func FrequencyCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewFrequencyAccumulator(), bs)[0]
+}
+
+// Accumulates the frequency test
+type FrequencyAccumulator struct {
+	n   int
+	sum int // Sum over each bit, where a zero is worth -1 and a one is worth 1
+}
+
+func NewFrequencyAccumulator() *FrequencyAccumulator {
+	return &FrequencyAccumulator{}
+}
+
+func (a *FrequencyAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
 		if b {
-			sum++
+			a.sum++
 		} else {
-			sum--
+			a.sum--
 		}
 	}
+	a.n += chunk.Length
+}
+
+func (a *FrequencyAccumulator) Finalize() []TestResult {
 	// Calculate statistic
-	s := math.Abs(float64(sum)) / math.Sqrt(float64(bs.Length))
+	s := math.Abs(float64(a.sum)) / math.Sqrt(float64(a.n))
 
 	// Calculate P value
 	p := math.Erfc(s / math.Sqrt2)
 
-	return testResult{"Frequency", p, significance, p >= significance}
+	r := newResult("Frequency", a.n, pValue(p)).withStatistics(Value{"s_obs", s})
+	if a.n < 100 {
+		r = r.insufficient("n = %d, at least 100 bits are required", a.n)
+	}
+	return []TestResult{r}
+}
+
+// Tests the proportion of ones in each block of size [M]
+func BlockFrequencyCheck(bs *bitstring.BitString, M int) TestResult {
+	return accumulate(NewBlockFrequencyAccumulator(M), bs)[0]
 }
 
-// Tests the proportion of ones in each block of size [m]
-func BlockFrequencyCheck(bs *bitstring.BitString, M int) testResult {
-	// Partition string into blocks of length m
-	blocks := bs.Partition(M)
+// Accumulates the block frequency test with blocks of size [M]
+type BlockFrequencyAccumulator struct {
+	M         int
+	n         int
+	ones      int     // Ones in the current block
+	numblocks int     // Number of complete blocks
+	sum       float64 // Sum of the squared distances of each block's proportion of ones from a half
+}
 
-	// Calculate proportion of ones to zeros in each block
-	numblocks := bs.Length / M
-	pi := make([]float64, numblocks)
-	for i, block := range blocks {
-		pi[i] = block.Proportion()
+func NewBlockFrequencyAccumulator(M int) *BlockFrequencyAccumulator {
+	return &BlockFrequencyAccumulator{M: M}
+}
+
+func (a *BlockFrequencyAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if b {
+			a.ones++
+		}
+		a.n++
+		if a.n%a.M == 0 {
+			a.sum += math.Pow(float64(a.ones)/float64(a.M)-0.5, 2)
+			a.numblocks++
+			a.ones = 0
+		}
 	}
+}
 
-	// Calculate chisq statistic
-	sum := 0.0
-	for _, p := range pi {
-		sum += math.Pow((p - 0.5), 2)
+func (a *BlockFrequencyAccumulator) Finalize() []TestResult {
+	M := a.M
+	name := fmt.Sprintf("Block Frequency (%d)", M)
+	if a.numblocks == 0 {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(Value{"M", float64(M)}).
+			insufficient("n = %d is shorter than a block", a.n)}
 	}
-	chi := 4.0 * float64(M) * sum
+
+	// Calculate chisq statistic
+	chi := 4.0 * float64(M) * a.sum
 
 	// find p value using incomplete gamma function
-	p := igamc(float64(numblocks)/2.0, chi/2.0)
+	p := igamc(float64(a.numblocks)/2.0, chi/2.0)
 
-	return testResult{fmt.Sprintf("Block Frequency (%d)", M), p, significance, p >= significance}
+	r := newResult(name, a.n, pValue(p)).withParameters(Value{"M", float64(M)}).
+		withStatistics(Value{"chi^2", chi})
+	switch {
+	case a.n < 100:
+		r = r.insufficient("n = %d, at least 100 bits are required", a.n)
+	case M < 20 || M*100 <= a.n:
+		r = r.insufficient("M = %d, M >= 20 and M > n/100 are required", M)
+	}
+	return []TestResult{r}
 }
 
 // Tests the amount of consecutive ones or zeros over the whole string
-func RunsCheck(bs *bitstring.BitString) testResult {
+func RunsCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewRunsAccumulator(), bs)[0]
+}
+
+// Accumulates the runs test
+type RunsAccumulator struct {
+	n    int
+	ones int
+	sum  int  // Number of neighbouring bits that differ
+	last bool // The last bit seen
+}
+
+func NewRunsAccumulator() *RunsAccumulator {
+	return &RunsAccumulator{}
+}
+
+func (a *RunsAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if b {
+			a.ones++
+		}
+		if a.n > 0 && b != a.last {
+			a.sum++
+		}
+		a.last = b
+		a.n++
+	}
+}
+
+func (a *RunsAccumulator) Finalize() []TestResult {
 	// Test the proportion of ones to zeros, as this must be valid for runs test to succeed
-	pi := bs.Proportion()
-	if math.Abs(pi-0.5) >= 2.0/math.Sqrt(10) {
-		return testResult{"Consecutive Runs", 0, significance, false}
+	if a.n < 100 {
+		return []TestResult{newResult("Consecutive Runs", a.n, pValue(0)).
+			insufficient("n = %d, at least 100 bits are required", a.n)}
+	}
+	pi := float64(a.ones) / float64(a.n)
+	if math.Abs(pi-0.5) >= 2/math.Sqrt(float64(a.n)) {
+		return []TestResult{newResult("Consecutive Runs", a.n, pValue(0)).withStatistics(Value{"pi", pi})}
 	}
 
 	// Calculate runs test statistic
-	sum := 0
-	for i, b := range bs.Data {
-		if i < bs.Length-1 && b != bs.Data[i+1] {
-			sum++
-		}
-	}
-	s := float64(sum + 1)
+	s := float64(a.sum + 1)
 
 	// Calculate p value
 	tmp := 2.0 * pi * (1.0 - pi)
-	n := float64(bs.Length)
+	n := float64(a.n)
 	p := math.Erfc(math.Abs(s-tmp*n) / (tmp * math.Sqrt(2*n)))
 
-	return testResult{"Consecutive Runs", p, significance, p >= significance}
-}
-
-// Tests the longest run of ones in each block of size 8, 128 or 10^4
-// Assumes length of [bs] must be either 128, 6272 or 750,000
-func LongestRunCheck(bs *bitstring.BitString) testResult {
-	// Find parameters for different lengths of [bs]
-	M, k := 0, 0
-	var pi []float64
-	if bs.Length < 128 {
-		return testResult{"Longest Runs", 0, significance, false}
-	} else if bs.Length < 6272 {
-		bs = bs.Substring(0, 128)
-		M = 8
-		k = 4
-		pi = []float64{0.2148, 0.3672, 0.2305, 0.1875}
-	} else if bs.Length < 750000 {
-		bs = bs.Substring(0, 6272)
-		M = 128
-		k = 6
-		pi = []float64{0.1174, 0.2430, 0.2493, 0.1752, 0.1027, 0.1124}
-	} else {
-		bs = bs.Substring(0, 750000)
-		M = 100000
-		k = 7
-		pi = []float64{0.0882, 0.2092, 0.2483, 0.1933, 0.1208, 0.0675, 0.0727}
-	}
-	n := bs.Length / M
-
-	// Find longest run in each block, recording the lowest and highest run sizes
-	blocks := bs.Partition(M)
-	longestRuns := make([]int, n)
-	for i, block := range blocks {
-		current := 0
-		for _, b := range block.Data {
-			if b {
-				current++
-			} else {
-				current = 0
-			}
-			if current > longestRuns[i] {
-				longestRuns[i] = current
-			}
-		}
+	return []TestResult{newResult("Consecutive Runs", a.n, pValue(p)).withStatistics(Value{"pi", pi}, Value{"V_n", s})}
+}
+
+// Parameters of the longest run test for each supported block size
+type longestRunParameter struct {
+	minLength int       // Recommended minimum length of the input
+	shortest  int       // Runs of this length or shorter are counted in the first class
+	pi        []float64 // Probability of each class of longest run
+}
+
+var longestRunParameters = map[int]longestRunParameter{
+	8:     {128, 1, []float64{0.2148, 0.3672, 0.2305, 0.1875}},
+	128:   {6272, 4, []float64{0.1174, 0.2430, 0.2493, 0.1752, 0.1027, 0.1124}},
+	10000: {750000, 10, []float64{0.0882, 0.2092, 0.2483, 0.1933, 0.1208, 0.0675, 0.0727}},
+}
+
+// Tests the longest run of ones in each block of size [M], which must be 8, 128 or 10^4
+func LongestRunCheck(bs *bitstring.BitString, M int) TestResult {
+	return accumulate(NewLongestRunAccumulator(M), bs)[0]
+}
+
+// Accumulates the longest run test with blocks of size [M]
+type LongestRunAccumulator struct {
+	M       int
+	param   longestRunParameter
+	n       int
+	current int   // Length of the current run of ones
+	longest int   // Longest run of ones in the current block
+	v       []int // Number of blocks in each class of longest run
+}
+
+// Panics unless [M] is 8, 128 or 10^4
+func NewLongestRunAccumulator(M int) *LongestRunAccumulator {
+	param, ok := longestRunParameters[M]
+	if !ok {
+		panic("LongestRunCheck: M must be 8, 128 or 10000")
 	}
+	return &LongestRunAccumulator{M: M, param: param, v: make([]int, len(param.pi))}
+}
 
-	// Categorise these run lengths, where each element contains the number of blocks with some run length
-	// Also build the theoretical probabilities pi
-	v := make([]int, k)
-	for _, r := range longestRuns {
-		if bs.Length == 128 {
-			switch {
-			case r <= 1:
-				v[0]++
-			case r >= 4:
-				v[3]++
-			default:
-				v[r-1]++
-			}
-		} else if bs.Length == 6272 {
-			switch {
-			case r <= 4:
-				v[0]++
-			case r >= 9:
-				v[5]++
-			default:
-				v[r-4]++
-			}
+func (a *LongestRunAccumulator) Update(chunk *bitstring.BitString) {
+	k := len(a.v)
+	for _, b := range chunk.Data {
+		if b {
+			a.current++
 		} else {
-			switch {
-			case r <= 10:
-				v[0]++
-			case r >= 16:
-				v[6]++
-			default:
-				v[r-10]++
+			a.current = 0
+		}
+		if a.current > a.longest {
+			a.longest = a.current
+		}
+		a.n++
+
+		// Categorise the run length at the end of each block
+		if a.n%a.M == 0 {
+			c := a.longest - a.param.shortest
+			if c < 0 {
+				c = 0
+			} else if c >= k {
+				c = k - 1
 			}
+			a.v[c]++
+			a.current, a.longest = 0, 0
 		}
 	}
+}
+
+func (a *LongestRunAccumulator) Finalize() []TestResult {
+	M, param := a.M, a.param
+	name := fmt.Sprintf("Longest Runs (%d)", M)
+	n := a.n / M
+	if n == 0 {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(Value{"M", float64(M)}).
+			insufficient("n = %d is shorter than a block", a.n)}
+	}
 
 	// Calculate chisq statistic
+	k := len(param.pi)
 	chi := 0.0
-	for i, p := range v {
-		npi := pi[i] * float64(n)
+	for i, p := range a.v {
+		npi := param.pi[i] * float64(n)
 		chi += math.Pow((float64(p)-npi), 2) / npi
 	}
 
 	// Calculate p value
 	p := igamc(float64(k-1)/2.0, chi/2.0)
 
-	return testResult{"Longest Runs", p, significance, p >= significance}
+	r := newResult(name, a.n, pValue(p)).withParameters(Value{"M", float64(M)}).
+		withStatistics(Value{"chi^2", chi})
+	if a.n < param.minLength {
+		r = r.insufficient("n = %d, at least %d bits are required for M = %d", a.n, param.minLength, M)
+	}
+	return []TestResult{r}
 }
 
-// Tests a [template] BitString against [bs] to find if the template occurs significantly often
-func NonOverlappingTemplateMatchingCheck(bs, template *bitstring.BitString) testResult {
-	// Set parameters, including theoretical mean and variance
-	n := bs.Length
-	m := template.Length
-	N := 8     // number of blocks is fixed to 8
-	M := n / N // block size
-	mean := float64(M-m+1) / math.Pow(2.0, float64(m))
-	variance := float64(M) * ((1 / math.Pow(2.0, float64(m))) - float64(2*m-1)/math.Pow(2.0, float64(2*m)))
+// Tests a [template] BitString against [bs] to find if the template occurs significantly often in any of [N] blocks
+func NonOverlappingTemplateMatchingCheck(bs, template *bitstring.BitString, N int) TestResult {
+	return accumulate(NewNonOverlappingTemplateAccumulator([]*bitstring.BitString{template}, bs.Length, N), bs)[0]
+}
+
+// Runs the non-overlapping template test over [bs] with every aperiodic template of length [m], using [N] blocks
+func NonOverlappingTemplateSuite(bs *bitstring.BitString, m, N int) []TestResult {
+	return accumulate(NewNonOverlappingTemplateAccumulator(AperiodicTemplates(m), bs.Length, N), bs)
+}
+
+// Accumulates the non-overlapping template test for several templates of the same length at once, giving a result
+// for each. As the blocks are sized from the length of the whole sequence, that length must be known in advance
+type NonOverlappingTemplateAccumulator struct {
+	templates []*bitstring.BitString
+	index     []int // Index of the template with each m bit value, or -1
+	m, N, M   int
+	n         int
+	window    int     // The last m bits
+	next      []int   // Position in the current block from which each template may match again
+	w         [][]int // Matches of each template in each block
+}
+
+// Builds an accumulator for a sequence of [n] bits split into [N] blocks, where [templates] all have the same length
+func NewNonOverlappingTemplateAccumulator(templates []*bitstring.BitString, n, N int) *NonOverlappingTemplateAccumulator {
+	m := templates[0].Length
+	a := &NonOverlappingTemplateAccumulator{templates: templates, index: make([]int, 1<<uint(m)), m: m, N: N, M: n / N,
+		next: make([]int, len(templates)), w: make([][]int, len(templates))}
+	for i := range a.index {
+		a.index[i] = -1
+	}
+	for i, t := range templates {
+		if t.Length != m {
+			panic("NewNonOverlappingTemplateAccumulator: templates must have the same length")
+		}
+		a.index[t.Int()] = i
+		a.w[i] = make([]int, N)
+	}
+	return a
+}
 
-	// Partition the string into blocks
-	blocks := bs.Partition(M)
-	w := make([]int, N)
-	for i, block := range blocks {
-		// Scan block for template matches
-		for j := 0; j < M-m+1; j++ {
-			if block.HasTemplateAt(template, j) {
-				w[i]++
-				j += m - 2 // skip the remainder of the pattern
+func (a *NonOverlappingTemplateAccumulator) Update(chunk *bitstring.BitString) {
+	if a.M < a.m {
+		a.n += chunk.Length
+		return
+	}
+	mask := 1<<uint(a.m) - 1
+	for _, b := range chunk.Data {
+		block, j := a.n/a.M, a.n%a.M
+		a.n++
+		if block >= a.N {
+			continue
+		}
+		if j == 0 {
+			for i := range a.next {
+				a.next[i] = 0
 			}
 		}
+		a.window = (a.window << 1) & mask
+		if b {
+			a.window |= 1
+		}
+
+		// Look up the template ending at this bit, skipping the remainder of the pattern after a match
+		start := j - a.m + 1
+		if i := a.index[a.window]; start >= 0 && i >= 0 && start >= a.next[i] {
+			a.w[i][block]++
+			a.next[i] = j + 1
+		}
 	}
+}
+
+func (a *NonOverlappingTemplateAccumulator) Finalize() []TestResult {
+	results := make([]TestResult, len(a.templates))
+	for i, template := range a.templates {
+		results[i] = a.result(template, a.w[i])
+	}
+	return results
+}
+
+// The result of the test for [template], given its matches [w] in each block
+func (a *NonOverlappingTemplateAccumulator) result(template *bitstring.BitString, w []int) TestResult {
+	name := fmt.Sprintf("Non Overlapping Templates (%q)", template)
+
+	// Set parameters, including theoretical mean and variance
+	n, m, N, M := a.n, a.m, a.N, a.M
+	params := []Value{{"m", float64(m)}, {"N", float64(N)}, {"M", float64(M)}}
+	if M < m {
+		return newResult(name, n, pValue(0)).withParameters(params...).
+			insufficient("blocks of %d bits are shorter than the template", M)
+	}
+	mean := float64(M-m+1) / math.Pow(2.0, float64(m))
+	variance := float64(M) * ((1 / math.Pow(2.0, float64(m))) - float64(2*m-1)/math.Pow(2.0, float64(2*m)))
 
 	// Compute chisq value
 	chi := 0.0
-	for _, v := range w {
+	stats := make([]Value, len(w))
+	for i, v := range w {
 		chi += math.Pow(float64(v)-mean, 2.0) / variance
+		stats[i] = Value{fmt.Sprintf("W_%d", i+1), float64(v)}
 	}
 
 	// Compute p value
 	p := igamc(float64(N)/2.0, chi/2.0)
 
-	return testResult{fmt.Sprintf("Non Overlapping Templates (%q)", template), p, significance, p >= significance}
+	r := newResult(name, n, pValue(p)).withParameters(params...).withStatistics(Value{"chi^2", chi}).
+		withStatistics(stats...)
+	if N > 100 {
+		return r.insufficient("N = %d, at most 100 blocks are recommended", N)
+	}
+	return r
 }
 
-// Checks every binary block over a few sizes to ensure they don't occur too commonly
-// Assumes bs.length >= 16
-func SerialCheck(bs *bitstring.BitString) testResult {
-	// Set parameters
-	n := bs.Length
-	m := int(math.Floor(math.Log2(float64(n)))) - 3
-
-	// Extend string by adding m-1 bits from its start to its end
-	ebs := bs.Extend(bs.First(m - 1))
+// Generates every aperiodic template of length [m] in increasing order, where a template is aperiodic if no proper
+// prefix of it is also a suffix, so that two matches can never overlap. There are 148 templates of length 9
+func AperiodicTemplates(m int) []*bitstring.BitString {
+	if m < 2 || m > 21 {
+		panic("AperiodicTemplates(m): m must be in [2, 21]")
+	}
+	var templates []*bitstring.BitString
+	failure := make([]int, m)
+	for v := 0; v < 1<<uint(m); v++ {
+		t := bitstring.BitStringFromInt(m, v)
 
-	// Get all m, m-1 and m-2 bit blocks, and the number of times the occur in [bs]
-	v1 := make([]int, int(math.Pow(2.0, float64(m))))
-	for i, t := range bitstring.BitStringsOfLength(m) {
-		for j := 0; j < n; j++ {
-			if ebs.HasTemplateAt(t, j) {
-				v1[i]++
+		// The KMP failure function gives the length of the longest proper prefix that is also a suffix
+		failure[0] = 0
+		for i, k := 1, 0; i < m; i++ {
+			for k > 0 && t.Data[i] != t.Data[k] {
+				k = failure[k-1]
 			}
-		}
-	}
-	v2 := make([]int, int(math.Pow(2.0, float64(m-1))))
-	for i, t := range bitstring.BitStringsOfLength(m - 1) {
-		for j := 0; j < n; j++ {
-			if ebs.HasTemplateAt(t, j) {
-				v2[i]++
+			if t.Data[i] == t.Data[k] {
+				k++
 			}
+			failure[i] = k
+		}
+		if failure[m-1] == 0 {
+			templates = append(templates, t)
 		}
 	}
-	v3 := make([]int, int(math.Pow(2.0, float64(m-2))))
-	for i, t := range bitstring.BitStringsOfLength(m - 2) {
-		for j := 0; j < n; j++ {
-			if ebs.HasTemplateAt(t, j) {
-				v3[i]++
-			}
+	return templates
+}
+
+// Summary of the P values a test gave over many templates or sequences, following section 4.2 of the spec
+type Summary struct {
+	Name             string
+	Count            int // Number of results summarised, excluding inconclusive results
+	Inconclusive     int
+	Passed           int
+	Proportion       float64
+	MinProportion    float64 // Lowest proportion of passes within the 99.7% confidence interval
+	ProportionPassed bool
+	Histogram        [uniformityBins]int // Number of P values in each tenth of [0, 1]
+	Uniformity       float64             // P value of the chisq test for uniformity of the P values
+	UniformityPassed bool
+}
+
+// Summarises [results], which should all come from the same test, ignoring inconclusive results. The proportion
+// passing must lie within three standard deviations of the expected proportion, and the P values must be uniformly
+// distributed. Results with several P values are summarised by the smallest, so should be split first
+func Summarise(name string, results []TestResult) Summary {
+	s := Summary{Name: name}
+	alpha := DefaultSignificance
+	for _, r := range results {
+		if r.Status == StatusInconclusive {
+			s.Inconclusive++
+			continue
 		}
+		alpha = r.Significance
+		s.Count++
+		if r.Result {
+			s.Passed++
+		}
+		s.Histogram[int(math.Min(r.P*uniformityBins, uniformityBins-1))]++
+	}
+	if s.Count == 0 {
+		return s
 	}
 
-	// Compute psisq values
-	sum := 0.0
-	for _, v := range v1 {
-		sum += math.Pow(float64(v), 2.0)
+	// Proportion of passes against the confidence interval
+	k := float64(s.Count)
+	p := 1 - alpha
+	s.Proportion = float64(s.Passed) / k
+	s.MinProportion = p - 3*math.Sqrt(p*(1-p)/k)
+	s.ProportionPassed = s.Proportion >= s.MinProportion
+
+	// Uniformity of the P values
+	chi := 0.0
+	expected := k / uniformityBins
+	for _, f := range s.Histogram {
+		chi += math.Pow(float64(f)-expected, 2) / expected
 	}
-	psi1 := (math.Pow(2.0, float64(m))/float64(n))*sum - float64(n)
-	sum = 0.0
-	for _, v := range v2 {
-		sum += math.Pow(float64(v), 2.0)
+	s.Uniformity = igamc(float64(uniformityBins-1)/2, chi/2)
+	s.UniformityPassed = s.Uniformity >= uniformitySignificance
+
+	return s
+}
+
+// Checks every [m] bit block, with wrap around, to ensure none occur too commonly, giving the two P values P1 and P2
+func SerialCheck(bs *bitstring.BitString, m int) TestResult {
+	return accumulate(NewSerialAccumulator(m), bs)[0]
+}
+
+// Accumulates the serial test with blocks of length [m]
+type SerialAccumulator struct {
+	m      int
+	counts *blockCounter // Counts of m, m-1 and m-2 bit blocks
+}
+
+func NewSerialAccumulator(m int) *SerialAccumulator {
+	a := &SerialAccumulator{m: m}
+	if m >= 2 {
+		a.counts = newBlockCounter(m, m-1, m-2)
 	}
-	psi2 := (math.Pow(2.0, float64(m-1))/float64(n))*sum - float64(n)
-	sum = 0.0
-	for _, v := range v3 {
-		sum += math.Pow(float64(v), 2.0)
+	return a
+}
+
+func (a *SerialAccumulator) Update(chunk *bitstring.BitString) {
+	if a.counts != nil {
+		a.counts.update(chunk)
 	}
-	psi3 := (math.Pow(2.0, float64(m-2))/float64(n))*sum - float64(n)
+}
+
+func (a *SerialAccumulator) Finalize() []TestResult {
+	const name = "Serial"
+	m := a.m
+	n := 0
+	if a.counts != nil {
+		n = a.counts.n
+	}
+	if m < 2 || n < m {
+		return []TestResult{newResult(name, n, Value{"P1", 0}, Value{"P2", 0}).withParameters(Value{"m", float64(m)}).
+			insufficient("m = %d, 2 <= m <= n is required", m)}
+	}
+	counts := a.counts.finish()
+	psi1 := psiSquared(counts[0], n)
+	psi2 := psiSquared(counts[1], n)
+	psi3 := psiSquared(counts[2], n)
 
 	// Compute delta psysq
 	dpsi1 := psi1 - psi2
@@ -299,59 +666,142 @@ func SerialCheck(bs *bitstring.BitString) testResult {
 	p1 := igamc(math.Pow(2.0, float64(m-2)), dpsi1/2.0)
 	p2 := igamc(math.Pow(2.0, float64(m-3)), dpsi2/2.0)
 
-	if !(p1 >= significance) {
-		return testResult{"Serial (p1)", p1, significance, false}
-	}
-	if !(p2 >= significance) {
-		return testResult{"Serial (p2)", p2, significance, false}
+	r := newResult(name, n, Value{"P1", p1}, Value{"P2", p2}).withParameters(Value{"m", float64(m)})
+	if float64(m) >= math.Floor(math.Log2(float64(n)))-2 {
+		r = r.insufficient("m = %d, m < floor(log2 n) - 2 is required", m)
 	}
-	return testResult{"Serial", (p1 + p2) / 2.0, significance, true}
+	return []TestResult{r}
 }
 
-// Compares all possible bit patterns of a certain length to see if any occur significantly often
-func ApproximateEntropyCheck(bs *bitstring.BitString) testResult {
-	// Set parameters
-	n := bs.Length
-	m := int(math.Floor(math.Log2(float64(n)))) - 5
+// Counts the occurrences of blocks of several lengths at every position of a sequence, wrapping around at the end, by
+// keeping a rolling window of the last bits. The first bits are kept so that the blocks wrapping around can be
+// counted once the end is known
+type blockCounter struct {
+	lengths []int
+	counts  [][]int
+	max     int // The longest block length
+	n       int
+	window  int    // The last max bits
+	head    []bool // The first max-1 bits
+}
 
-	// Extend string by adding m bits from its start to its end
-	ebs := bs.Extend(bs.First(m))
+func newBlockCounter(lengths ...int) *blockCounter {
+	c := &blockCounter{lengths: lengths, counts: make([][]int, len(lengths))}
+	for i, m := range lengths {
+		c.counts[i] = make([]int, 1<<uint(m))
+		if m > c.max {
+			c.max = m
+		}
+	}
+	return c
+}
 
-	// Count occurrences of each m bit block in bs
-	numBlocks := int(math.Pow(2.0, float64(m)))
-	c1 := make([]float64, numBlocks)
-	for i := 0; i < n; i++ {
-		c1[ebs.Substring(i, m).Int()]++
+func (c *blockCounter) update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if len(c.head) < c.max-1 {
+			c.head = append(c.head, b)
+		}
+		c.push(b)
+
+		// Count the blocks ending at this bit
+		for i, m := range c.lengths {
+			if m > 0 && c.n >= m-1 {
+				c.counts[i][c.window&(1<<uint(m)-1)]++
+			}
+		}
+		c.n++
 	}
-	for i := 0; i < numBlocks; i++ {
-		c1[i] /= float64(n)
+}
+
+func (c *blockCounter) push(b bool) {
+	c.window = (c.window << 1) & (1<<uint(c.max) - 1)
+	if b {
+		c.window |= 1
 	}
+}
+
+// Counts the blocks that wrap around, returning the counts for each length. The sequence must be at least as long as
+// the longest block, and nothing may be added afterwards
+func (c *blockCounter) finish() [][]int {
+	for j, b := range c.head {
+		c.push(b)
 
-	// Compute phi for m bit blocks
-	phi1 := 0.0
-	for _, c := range c1 {
-		if c != 0 {
-			phi1 += c * math.Log(c)
+		// Count the blocks ending at the jth bit after the end, which start before the end
+		for i, m := range c.lengths {
+			if j < m-1 {
+				c.counts[i][c.window&(1<<uint(m)-1)]++
+			}
+		}
+	}
+	for i, m := range c.lengths {
+		if m == 0 {
+			c.counts[i][0] = c.n
 		}
 	}
+	return c.counts
+}
 
-	// Count occurrences of each m+1 bit block in bs
-	numBlocks = int(math.Pow(2.0, float64(m+1)))
-	c2 := make([]float64, numBlocks)
-	for i := 0; i < n; i++ {
-		c2[ebs.Substring(i, m+1).Int()]++
+// The psi squared statistic of the serial test for the block [counts] of a sequence of length [n]
+func psiSquared(counts []int, n int) float64 {
+	sum := 0.0
+	for _, v := range counts {
+		sum += math.Pow(float64(v), 2.0)
 	}
-	for i := 0; i < numBlocks; i++ {
-		c2[i] /= float64(n)
+	return float64(len(counts))/float64(n)*sum - float64(n)
+}
+
+// Compares the frequencies of overlapping [m] and m+1 bit blocks, with wrap around, to see if any occur
+// significantly often
+func ApproximateEntropyCheck(bs *bitstring.BitString, m int) TestResult {
+	return accumulate(NewApproximateEntropyAccumulator(m), bs)[0]
+}
+
+// Accumulates the approximate entropy test with blocks of length [m]
+type ApproximateEntropyAccumulator struct {
+	m      int
+	counts *blockCounter // Counts of m and m+1 bit blocks
+}
+
+func NewApproximateEntropyAccumulator(m int) *ApproximateEntropyAccumulator {
+	a := &ApproximateEntropyAccumulator{m: m}
+	if m >= 1 {
+		a.counts = newBlockCounter(m, m+1)
 	}
+	return a
+}
 
-	// Compute phi for m+1 bit blocks
-	phi2 := 0.0
-	for _, c := range c2 {
-		if c != 0 {
-			phi2 += c * math.Log(c)
+func (a *ApproximateEntropyAccumulator) Update(chunk *bitstring.BitString) {
+	if a.counts != nil {
+		a.counts.update(chunk)
+	}
+}
+
+func (a *ApproximateEntropyAccumulator) Finalize() []TestResult {
+	const name = "Approximate Entropy"
+	m := a.m
+	n := 0
+	if a.counts != nil {
+		n = a.counts.n
+	}
+	if m < 1 || n < m+1 {
+		return []TestResult{newResult(name, n, pValue(0)).withParameters(Value{"m", float64(m)}).
+			insufficient("m = %d, 1 <= m < n is required", m)}
+	}
+	counts := a.counts.finish()
+
+	// Compute phi for m and m+1 bit blocks
+	phi := func(counts []int) float64 {
+		sum := 0.0
+		for _, c := range counts {
+			if c != 0 {
+				f := float64(c) / float64(n)
+				sum += f * math.Log(f)
+			}
 		}
+		return sum
 	}
+	phi1 := phi(counts[0])
+	phi2 := phi(counts[1])
 
 	// Compute chisq statistic
 	chi := float64(2*n) * (math.Log(2.0) - (phi1 - phi2))
@@ -359,45 +809,654 @@ func ApproximateEntropyCheck(bs *bitstring.BitString) testResult {
 	// Compute p value
 	p := igamc(math.Pow(2.0, float64(m-1)), chi/2.0)
 
-	return testResult{"Approximate Entropy", p, significance, p >= significance}
+	r := newResult(name, n, pValue(p)).withParameters(Value{"m", float64(m)}).
+		withStatistics(Value{"ApEn", phi1 - phi2}, Value{"chi^2", chi})
+	if float64(m) >= math.Floor(math.Log2(float64(n)))-5 {
+		r = r.insufficient("m = %d, m < floor(log2 n) - 5 is required", m)
+	}
+	return []TestResult{r}
 }
 
-// Find consecutive partial sums from the start, checking they don't get too high or low
-func CumulativeSumsCheck(bs *bitstring.BitString) testResult {
-	// Find partial sums, saving the max in z
-	n := bs.Length
-	s := make([]int, n)
-	z := 0
-	for i, b := range bs.Data {
-		var v int
-		if b {
-			v = 1
-		} else {
-			v = -1
+// Find consecutive partial sums, from both the start and the end of [bs], checking they don't get too high or low. The
+// P values are named after the two modes, forward and backward
+func CumulativeSumsCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewCumulativeSumsAccumulator(), bs)[0]
+}
+
+// Accumulates the cumulative sums test. Summing from the end gives S_n - S_j for each earlier partial sum S_j, so the
+// backward mode only needs the extremes of the partial sums before the last
+type CumulativeSumsAccumulator struct {
+	n        int
+	s        int // The current partial sum
+	z        int // Largest absolute partial sum
+	min, max int // Extremes of the partial sums before the current one, including the empty sum
+}
+
+func NewCumulativeSumsAccumulator() *CumulativeSumsAccumulator {
+	return &CumulativeSumsAccumulator{}
+}
+
+func (a *CumulativeSumsAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if a.s < a.min {
+			a.min = a.s
+		} else if a.s > a.max {
+			a.max = a.s
 		}
-		if i == 0 {
-			s[0] = v
+		if b {
+			a.s++
 		} else {
-			s[i] = s[i-1] + v
+			a.s--
 		}
-		sa := int(math.Abs(float64(s[i])))
-		if sa > z {
-			z = sa
+		if sa := int(math.Abs(float64(a.s))); sa > a.z {
+			a.z = sa
 		}
 	}
+	a.n += chunk.Length
+}
+
+func (a *CumulativeSumsAccumulator) Finalize() []TestResult {
+	const name = "Cumulative Sums"
+	n := a.n
+	zf := a.z
+	zb := int(math.Max(float64(a.s-a.min), float64(a.max-a.s)))
+	r := newResult(name, n, Value{"forward", cusumP(n, zf)}, Value{"backward", cusumP(n, zb)}).
+		withStatistics(Value{"z forward", float64(zf)}, Value{"z backward", float64(zb)})
+	switch {
+	case n == 0:
+		r = r.insufficient("the sequence is empty")
+	case n < 100:
+		r = r.insufficient("n = %d, at least 100 bits are required", n)
+	}
+	return []TestResult{r}
+}
 
-	// Find p value
+// Computes the P value of the cumulative sums test over [n] bits whose partial sums reach [z] at the furthest. The P
+// value is zero for an empty sequence
+func cusumP(n, z int) float64 {
+	if z == 0 {
+		return 0
+	}
+	sqrtn := math.Sqrt(float64(n))
+	nz := float64(n) / float64(z)
 	sum1, sum2 := 0.0, 0.0
-	max := (n/z - 1) / 4
-	for k := (-n/z + 1) / 4; k <= max; k++ {
-		sqrtn := math.Sqrt(float64(n))
+	max := int(math.Floor((nz - 1) / 4))
+	for k := int(math.Floor((-nz + 1) / 4)); k <= max; k++ {
 		sum1 += stdNormal(float64((4*k+1)*z)/sqrtn) - stdNormal(float64((4*k-1)*z)/sqrtn)
 	}
-	for k := (-n/z - 3) / 4; k <= max; k++ {
-		sqrtn := math.Sqrt(float64(n))
+	for k := int(math.Floor((-nz - 3) / 4)); k <= max; k++ {
 		sum2 += stdNormal(float64((4*k+3)*z)/sqrtn) - stdNormal(float64((4*k+1)*z)/sqrtn)
 	}
-	p := 1.0 - sum1 + sum2
+	return 1.0 - sum1 + sum2
+}
+
+const maxFourierBits = 1 << 20 // Most bits transformed by the discrete Fourier transform test within CheckRandom
+
+// Tests for periodic features by counting the peaks in the discrete Fourier transform of [bs] exceeding the 95%
+// threshold
+func DiscreteFourierTransformCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewDiscreteFourierTransformAccumulator(bs.Length), bs)[0]
+}
+
+// Accumulates the discrete Fourier transform test. The transform needs the whole sequence at once, so only the first
+// [maxBits] bits are kept and tested
+type DiscreteFourierTransformAccumulator struct {
+	maxBits int
+	x       []complex128 // The bits as -1s and 1s
+}
+
+func NewDiscreteFourierTransformAccumulator(maxBits int) *DiscreteFourierTransformAccumulator {
+	return &DiscreteFourierTransformAccumulator{maxBits: maxBits}
+}
+
+func (a *DiscreteFourierTransformAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if len(a.x) == a.maxBits {
+			return
+		}
+		if b {
+			a.x = append(a.x, 1)
+		} else {
+			a.x = append(a.x, -1)
+		}
+	}
+}
+
+func (a *DiscreteFourierTransformAccumulator) Finalize() []TestResult {
+	// Transform the sequence of -1s and 1s
+	n := len(a.x)
+	s := dft(a.x)
+
+	// Count the peaks in the first half of the transform that are below the threshold
+	t := math.Sqrt(math.Log(1/0.05) * float64(n))
+	n0 := 0.95 * float64(n) / 2
+	n1 := 0
+	for _, c := range s[:n/2] {
+		if cmplx.Abs(c) < t {
+			n1++
+		}
+	}
+
+	// Calculate p value
+	d := (float64(n1) - n0) / math.Sqrt(float64(n)*0.95*0.05/4)
+	p := math.Erfc(math.Abs(d) / math.Sqrt2)
+
+	r := newResult("Discrete Fourier Transform", n, pValue(p)).withStatistics(Value{"N1", float64(n1)}, Value{"d", d})
+	if n < 1000 {
+		r = r.insufficient("n = %d, at least 1000 bits are required", n)
+	}
+	return []TestResult{r}
+}
+
+// Tests for linear dependence between substrings by finding the rank of disjoint [M] x [Q] matrices built from [bs]
+func BinaryMatrixRankCheck(bs *bitstring.BitString, M, Q int) TestResult {
+	return accumulate(NewBinaryMatrixRankAccumulator(M, Q), bs)[0]
+}
+
+// Accumulates the binary matrix rank test with [M] x [Q] matrices, keeping the bits of one matrix at a time
+type BinaryMatrixRankAccumulator struct {
+	M, Q    int
+	n       int
+	N       int    // Number of complete matrices
+	bits    []bool // Bits of the current matrix
+	fm, fm1 int    // Number of matrices of full rank and of rank one less than full
+}
+
+func NewBinaryMatrixRankAccumulator(M, Q int) *BinaryMatrixRankAccumulator {
+	return &BinaryMatrixRankAccumulator{M: M, Q: Q, bits: make([]bool, 0, M*Q)}
+}
+
+func (a *BinaryMatrixRankAccumulator) Update(chunk *bitstring.BitString) {
+	M, Q := a.M, a.Q
+	full := int(math.Min(float64(M), float64(Q)))
+	for _, b := range chunk.Data {
+		a.bits = append(a.bits, b)
+		if len(a.bits) < M*Q {
+			continue
+		}
+
+		// Count the matrices of full rank and of rank one less than full
+		rows := make([][]bool, M)
+		for i := range rows {
+			rows[i] = a.bits[i*Q : (i+1)*Q]
+		}
+		switch binaryRank(rows) {
+		case full:
+			a.fm++
+		case full - 1:
+			a.fm1++
+		}
+		a.N++
+		a.bits = a.bits[:0]
+	}
+	a.n += chunk.Length
+}
+
+func (a *BinaryMatrixRankAccumulator) Finalize() []TestResult {
+	M, Q, N := a.M, a.Q, a.N
+	name := fmt.Sprintf("Binary Matrix Rank (%dx%d)", M, Q)
+	params := []Value{{"M", float64(M)}, {"Q", float64(Q)}, {"N", float64(N)}}
+	if N == 0 {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(params...).
+			insufficient("n = %d is too short for a single matrix", a.n)}
+	}
+
+	full := int(math.Min(float64(M), float64(Q)))
+	p := matrixRankP(a.fm, a.fm1, N, rankProbability(full, M, Q), rankProbability(full-1, M, Q))
+	r := newResult(name, a.n, pValue(p)).withParameters(params...).
+		withStatistics(Value{"F_M", float64(a.fm)}, Value{"F_M-1", float64(a.fm1)})
+	if N < 38 {
+		r = r.insufficient("N = %d, at least 38 matrices are required", N)
+	}
+	return []TestResult{r}
+}
+
+// Probability that a random [M] x [Q] binary matrix has rank [r]
+func rankProbability(r, M, Q int) float64 {
+	p := math.Pow(2, float64(r*(Q+M-r)-M*Q))
+	for i := 0; i < r; i++ {
+		p *= (1 - math.Pow(2, float64(i-Q))) * (1 - math.Pow(2, float64(i-M))) / (1 - math.Pow(2, float64(i-r)))
+	}
+	return p
+}
+
+// Computes the p value of the matrix rank test given the number of matrices [fm] of full rank and [fm1] of one less
+// than full rank out of [N], where these occur with probabilities [pFull] and [pFull1]
+func matrixRankP(fm, fm1, N int, pFull, pFull1 float64) float64 {
+	n := float64(N)
+	pRest := 1 - pFull - pFull1
+	rest := float64(N - fm - fm1)
+	chi := math.Pow(float64(fm)-pFull*n, 2)/(pFull*n) + math.Pow(float64(fm1)-pFull1*n, 2)/(pFull1*n) +
+		math.Pow(rest-pRest*n, 2)/(pRest*n)
+	return math.Exp(-chi / 2)
+}
+
+const overlappingTemplateDegrees = 5 // Number of degrees of freedom of the overlapping template test
+
+// Tests [bs] for too many occurrences of [template], counting overlapping matches in blocks of size [M]
+func OverlappingTemplateMatchingCheck(bs, template *bitstring.BitString, M int) TestResult {
+	return accumulate(NewOverlappingTemplateAccumulator(template, M), bs)[0]
+}
+
+// Accumulates the overlapping template test for [template] with blocks of size [M]
+type OverlappingTemplateAccumulator struct {
+	template *bitstring.BitString
+	value    int // The template as an integer, compared against the window
+	M        int
+	n        int
+	window   int   // The last m bits
+	matches  int   // Matches within the current block
+	v        []int // Number of blocks with each number of matches, up to K or more
+}
+
+func NewOverlappingTemplateAccumulator(template *bitstring.BitString, M int) *OverlappingTemplateAccumulator {
+	return &OverlappingTemplateAccumulator{template: template, value: template.Int(), M: M,
+		v: make([]int, overlappingTemplateDegrees+1)}
+}
+
+func (a *OverlappingTemplateAccumulator) Update(chunk *bitstring.BitString) {
+	K := overlappingTemplateDegrees
+	m := a.template.Length
+	mask := 1<<uint(m) - 1
+	for _, b := range chunk.Data {
+		j := a.n % a.M
+		a.n++
+		a.window = (a.window << 1) & mask
+		if b {
+			a.window |= 1
+		}
+
+		// Count the matches lying wholly within the block
+		if j >= m-1 && a.window == a.value {
+			a.matches++
+		}
+		if j == a.M-1 {
+			a.v[int(math.Min(float64(a.matches), float64(K)))]++
+			a.matches = 0
+		}
+	}
+}
+
+func (a *OverlappingTemplateAccumulator) Finalize() []TestResult {
+	name := fmt.Sprintf("Overlapping Templates (%q)", a.template)
+	K := overlappingTemplateDegrees
+	m, M := a.template.Length, a.M
+	N := a.n / M
+	params := []Value{{"m", float64(m)}, {"M", float64(M)}, {"N", float64(N)}}
+	if N == 0 || M < m {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(params...).
+			insufficient("n = %d is too short for a block of %d bits", a.n, M)}
+	}
+
+	// Compute chisq value against the theoretical probabilities of each number of matches
+	pi := overlappingTemplateProbabilities(m, M, K)
+	chi := 0.0
+	for i, c := range a.v {
+		npi := float64(N) * pi[i]
+		chi += math.Pow(float64(c)-npi, 2) / npi
+	}
+
+	// Compute p value
+	p := igamc(float64(K)/2, chi/2)
+
+	r := newResult(name, a.n, pValue(p)).withParameters(params...).withStatistics(Value{"chi^2", chi})
+	minPi := pi[0]
+	for _, v := range pi {
+		minPi = math.Min(minPi, v)
+	}
+	switch {
+	case a.n < 1000000:
+		r = r.insufficient("n = %d, at least 10^6 bits are required", a.n)
+	case float64(N)*minPi <= 5:
+		r = r.insufficient("N = %d blocks give expected counts of 5 or fewer", N)
+	}
+	return []TestResult{r}
+}
+
+// Probabilities of each number of matches that the NIST reference implementation uses for m = 9, M = 1032 and K = 5,
+// corrected from the compound Poisson approximation, which is inaccurate for these parameters (SP 800-22 3.8)
+var overlappingTemplateReferencePi = []float64{0.364091, 0.185659, 0.139381, 0.100571, 0.070432, 0.139865}
+
+// Probabilities of a block of [M] bits containing 0, 1, ..., K-1 and at least [K] overlapping matches of an [m] bit
+// template. The reference implementation's corrected values are used for its default parameters, so results can be
+// compared with its own
+func overlappingTemplateProbabilities(m, M, K int) []float64 {
+	if m == 9 && M == 1032 && K == 5 {
+		return overlappingTemplateReferencePi
+	}
+	return overlappingProbabilities(float64(M-m+1)/math.Pow(2, float64(m))/2, K)
+}
+
+// Probabilities of a block containing 0, 1, ..., K-1 and at least K overlapping template matches, given by the
+// compound Poisson distribution with parameter [eta]
+func overlappingProbabilities(eta float64, K int) []float64 {
+	pi := make([]float64, K+1)
+	pi[0] = math.Exp(-eta)
+	total := pi[0]
+	for u := 1; u < K; u++ {
+		// Sum over l of C(u-1, l-1) eta^l / l!
+		sum := 0.0
+		binomial, term := 1.0, 1.0
+		for l := 1; l <= u; l++ {
+			term *= eta / float64(l)
+			sum += binomial * term
+			binomial = binomial * float64(u-l) / float64(l)
+		}
+		pi[u] = math.Exp(-eta) / math.Pow(2, float64(u)) * sum
+		total += pi[u]
+	}
+	pi[K] = 1 - total
+	return pi
+}
+
+// Expected value and variance of Maurer's universal statistic for block lengths 1 to 16
+var (
+	universalExpected = []float64{0.7326495, 1.5374383, 2.4016068, 3.3112247, 4.2534266, 5.2177052, 6.1962507,
+		7.1836656, 8.1764248, 9.1723243, 10.170032, 11.168765, 12.168070, 13.167693, 14.167488, 15.167379}
+	universalVariance = []float64{0.690, 1.338, 1.901, 2.358, 2.705, 2.954, 3.125, 3.238, 3.311, 3.356, 3.384, 3.401,
+		3.410, 3.416, 3.419, 3.421}
+)
+
+// Tests whether [bs] can be significantly compressed, by measuring the distance between matching [L] bit blocks
+// after initialising with [Q] blocks
+func MaurersUniversalCheck(bs *bitstring.BitString, L, Q int) TestResult {
+	return accumulate(NewMaurersUniversalAccumulator(L, Q), bs)[0]
+}
+
+// Accumulates Maurer's universal test, summing log2 of the distance between each [L] bit test block and the previous
+// occurrence of the same block, after [Q] initialisation blocks
+type MaurersUniversalAccumulator struct {
+	L, Q      int
+	n         int
+	block     int   // Value of the current block
+	numblocks int   // Number of complete blocks
+	last      []int // Index of the last occurrence of each block
+	sum       float64
+}
+
+func NewMaurersUniversalAccumulator(L, Q int) *MaurersUniversalAccumulator {
+	a := &MaurersUniversalAccumulator{L: L, Q: Q}
+	if L >= 1 && L <= 16 {
+		a.last = make([]int, 1<<uint(L))
+	}
+	return a
+}
+
+func (a *MaurersUniversalAccumulator) Update(chunk *bitstring.BitString) {
+	if a.last == nil {
+		a.n += chunk.Length
+		return
+	}
+	for _, b := range chunk.Data {
+		a.block <<= 1
+		if b {
+			a.block |= 1
+		}
+		a.n++
+		if a.n%a.L != 0 {
+			continue
+		}
+		a.numblocks++
+		if a.numblocks > a.Q {
+			a.sum += math.Log2(float64(a.numblocks - a.last[a.block]))
+		}
+		a.last[a.block] = a.numblocks
+		a.block = 0
+	}
+}
+
+func (a *MaurersUniversalAccumulator) Finalize() []TestResult {
+	L, Q := a.L, a.Q
+	name := fmt.Sprintf("Maurer's Universal (L = %d)", L)
+	K := a.n/L - Q
+	params := []Value{{"L", float64(L)}, {"Q", float64(Q)}, {"K", float64(K)}}
+	if L < 1 || L > 16 || Q < 1 || K <= 0 {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(params...).
+			insufficient("L = %d and Q = %d leave no test blocks", L, Q)}
+	}
+	fn := a.sum / float64(K)
+
+	// Calculate p value, correcting the variance for the number of test blocks
+	c := 0.7 - 0.8/float64(L) + (4+32/float64(L))*math.Pow(float64(K), -3/float64(L))/15
+	sigma := c * math.Sqrt(universalVariance[L-1]/float64(K))
+	p := math.Erfc(math.Abs(fn-universalExpected[L-1]) / (math.Sqrt2 * sigma))
 
-	return testResult{"Cumulative Sums", p, significance, p >= significance}
+	r := newResult(name, a.n, pValue(p)).withParameters(params...).withStatistics(Value{"f_n", fn})
+	switch {
+	case L < 6:
+		r = r.insufficient("L = %d, 6 <= L <= 16 is required", L)
+	case Q < 10*(1<<uint(L)):
+		r = r.insufficient("Q = %d, Q >= 10 * 2^L is required", Q)
+	case K < 1000*(1<<uint(L)):
+		r = r.insufficient("K = %d test blocks, at least 1000 * 2^L are required", K)
+	}
+	return []TestResult{r}
+}
+
+// Chooses the largest block length for Maurer's universal test that [n] bits can support, following the table of
+// recommended input sizes
+func universalBlockLength(n int) int {
+	L := 1
+	for l := 2; l <= 16; l++ {
+		if n >= 1010*(1<<uint(l))*l {
+			L = l
+		}
+	}
+	return L
+}
+
+// Theoretical probabilities of each class of the linear complexity test
+var linearComplexityProbabilities = []float64{0.010417, 0.03125, 0.125, 0.5, 0.25, 0.0625, 0.020833}
+
+// Tests whether [bs] is complex enough by finding the length of the shortest LFSR generating each block of size [M]
+func LinearComplexityCheck(bs *bitstring.BitString, M int) TestResult {
+	return accumulate(NewLinearComplexityAccumulator(M), bs)[0]
+}
+
+// Accumulates the linear complexity test with blocks of size [M], keeping one block at a time
+type LinearComplexityAccumulator struct {
+	M     int
+	n     int
+	sign  float64
+	mu    float64 // Theoretical mean linear complexity
+	block []bool  // Bits of the current block
+	v     []int   // Number of blocks in each class
+}
+
+func NewLinearComplexityAccumulator(M int) *LinearComplexityAccumulator {
+	// Theoretical mean linear complexity
+	sign := 1.0
+	if M%2 == 1 {
+		sign = -1.0
+	}
+	mu := float64(M)/2 + (9-sign)/36 - (float64(M)/3+2.0/9)/math.Pow(2, float64(M))
+	return &LinearComplexityAccumulator{M: M, sign: sign, mu: mu, block: make([]bool, 0, M),
+		v: make([]int, len(linearComplexityProbabilities))}
+}
+
+func (a *LinearComplexityAccumulator) Update(chunk *bitstring.BitString) {
+	K := len(a.v) - 1
+	for _, b := range chunk.Data {
+		a.block = append(a.block, b)
+		if len(a.block) < a.M {
+			continue
+		}
+
+		// Classify the linear complexity of each block by its distance from the mean
+		t := a.sign*(float64(linearComplexity(a.block))-a.mu) + 2.0/9
+		i := int(math.Ceil(t + 2.5))
+		a.v[int(math.Max(0, math.Min(float64(K), float64(i))))]++
+		a.block = a.block[:0]
+	}
+	a.n += chunk.Length
+}
+
+func (a *LinearComplexityAccumulator) Finalize() []TestResult {
+	M := a.M
+	name := fmt.Sprintf("Linear Complexity (%d)", M)
+	N := a.n / M
+	params := []Value{{"M", float64(M)}, {"N", float64(N)}}
+	if N == 0 {
+		return []TestResult{newResult(name, a.n, pValue(0)).withParameters(params...).
+			insufficient("n = %d is shorter than a block", a.n)}
+	}
+
+	// Compute chisq value
+	K := len(a.v) - 1
+	chi := 0.0
+	for i, c := range a.v {
+		npi := float64(N) * linearComplexityProbabilities[i]
+		chi += math.Pow(float64(c)-npi, 2) / npi
+	}
+
+	// Compute p value
+	p := igamc(float64(K)/2, chi/2)
+
+	r := newResult(name, a.n, pValue(p)).withParameters(params...).withStatistics(Value{"chi^2", chi})
+	switch {
+	case a.n < 1000000:
+		r = r.insufficient("n = %d, at least 10^6 bits are required", a.n)
+	case M < 500 || M > 5000:
+		r = r.insufficient("M = %d, 500 <= M <= 5000 is required", M)
+	case N < 200:
+		r = r.insufficient("N = %d, at least 200 blocks are required", N)
+	}
+	return []TestResult{r}
+}
+
+const (
+	excursionMax        = 4 // Largest state of the random excursions test
+	excursionVariantMax = 9 // Largest state of the random excursions variant test
+)
+
+// States visited by the random excursions test
+var excursionStates = []int{-4, -3, -2, -1, 1, 2, 3, 4}
+
+// Tests the number of visits to each state within a cycle of the random walk defined by [bs], giving a P value for
+// each state in excursionStates
+func RandomExcursionsCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewRandomExcursionsAccumulator(false), bs)[0]
+}
+
+// Tests the total number of visits to each state in [-9, 9] of the random walk defined by [bs], giving a P value for
+// each non-zero state
+func RandomExcursionsVariantCheck(bs *bitstring.BitString) TestResult {
+	return accumulate(NewRandomExcursionsAccumulator(true), bs)[0]
+}
+
+// Accumulates the random excursions test, splitting the random walk given by the partial sums of the sequence into
+// cycles that start and end at zero
+type RandomExcursionsAccumulator struct {
+	variant bool
+	n       int
+	s       int                            // The current state
+	J       int                            // Number of complete cycles
+	current [2*excursionMax + 1]int        // Visits to each state in the current cycle
+	cycles  [2*excursionMax + 1][6]int     // Number of cycles visiting each state k times, for k up to 5 or more
+	visits  [2*excursionVariantMax + 1]int // Total visits to each state of the variant
+}
+
+// Builds an accumulator for the random excursions test, or for the random excursions variant test if [variant]
+func NewRandomExcursionsAccumulator(variant bool) *RandomExcursionsAccumulator {
+	return &RandomExcursionsAccumulator{variant: variant}
+}
+
+func (a *RandomExcursionsAccumulator) Update(chunk *bitstring.BitString) {
+	for _, b := range chunk.Data {
+		if b {
+			a.s++
+		} else {
+			a.s--
+		}
+		switch {
+		case a.s == 0:
+			a.J = endCycle(&a.cycles, &a.current, a.J)
+		case a.s >= -excursionMax && a.s <= excursionMax:
+			a.current[a.s+excursionMax]++
+			fallthrough
+		case a.s >= -excursionVariantMax && a.s <= excursionVariantMax:
+			a.visits[a.s+excursionVariantMax]++
+		}
+	}
+	a.n += chunk.Length
+}
+
+// Records the visits of the [current] cycle in [cycles], returning the number of cycles [J] including it
+func endCycle(cycles *[2*excursionMax + 1][6]int, current *[2*excursionMax + 1]int, J int) int {
+	for i, k := range current {
+		cycles[i][int(math.Min(float64(k), 5))]++
+		current[i] = 0
+	}
+	return J + 1
+}
+
+func (a *RandomExcursionsAccumulator) Finalize() []TestResult {
+	// The walk is closed by returning to zero at the end
+	cycles, current, J := a.cycles, a.current, a.J
+	if a.s != 0 {
+		J = endCycle(&cycles, &current, J)
+	}
+
+	if a.variant {
+		var ps []Value
+		for x := -excursionVariantMax; x <= excursionVariantMax; x++ {
+			if x == 0 {
+				continue
+			}
+			p := Value{fmt.Sprintf("x = %+d", x), 0}
+			if J > 0 {
+				xi := a.visits[x+excursionVariantMax]
+				p.Value = math.Erfc(math.Abs(float64(xi-J)) / math.Sqrt(2*float64(J)*(4*math.Abs(float64(x))-2)))
+			}
+			ps = append(ps, p)
+		}
+		return []TestResult{excursionResult(newResult("Random Excursions Variant", a.n, ps...), a.n, J)}
+	}
+
+	ps := make([]Value, len(excursionStates))
+	for i, x := range excursionStates {
+		ps[i] = Value{fmt.Sprintf("x = %+d", x), 0}
+		if J == 0 {
+			continue
+		}
+
+		// Compute chisq value over the cycles in which x was visited k times
+		chi := 0.0
+		for k, c := range cycles[x+excursionMax] {
+			jpi := float64(J) * excursionProbability(k, x)
+			chi += math.Pow(float64(c)-jpi, 2) / jpi
+		}
+
+		// Compute p value
+		ps[i].Value = igamc(5.0/2, chi/2)
+	}
+	return []TestResult{excursionResult(newResult("Random Excursions", a.n, ps...), a.n, J)}
+}
+
+// Checks a random excursions result was computed over enough bits and cycles, the minimum number of cycles being
+// that used by NIST's reference implementation
+func excursionResult(r TestResult, n, J int) TestResult {
+	r = r.withStatistics(Value{"J", float64(J)})
+	switch {
+	case J == 0:
+		return r.insufficient("the random walk has no cycles")
+	case n < 1000000:
+		return r.insufficient("n = %d, at least 10^6 bits are required", n)
+	case float64(J) < math.Max(500, 0.005*math.Sqrt(float64(n))):
+		return r.insufficient("J = %d cycles, at least max(500, 0.005 sqrt(n)) are required", J)
+	}
+	return r
+}
+
+// Probability that state [x] is visited [k] times in a cycle of a random walk, or at least 5 times when k is 5
+func excursionProbability(k, x int) float64 {
+	a := 1 / (2 * math.Abs(float64(x)))
+	switch {
+	case k == 0:
+		return 1 - a
+	case k < 5:
+		return a * a * math.Pow(1-a, float64(k-1))
+	default:
+		return a * math.Pow(1-a, 4)
+	}
 }
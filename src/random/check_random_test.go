@@ -2,7 +2,10 @@ package random
 
 import (
 	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"math/cmplx"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -116,13 +119,21 @@ func TestRunsCheck(t *testing.T) {
 	}
 }
 
+func TestRunsCheckBiased(t *testing.T) {
+	// Runs as frequent as a sequence of 60% ones should have, which fails only the frequency prerequisite
+	bs, _ := bitstring.BitStringFromString(strings.Repeat("11011001101110011100", 50))
+	if got := RunsCheck(bs); got.Result || got.P != 0 {
+		t.Errorf("RunsCheck() of a sequence of 60%% ones gave P %g, want 0", got.P)
+	}
+}
+
 func TestLongestRunCheck(t *testing.T) {
 	cases := []randomTest{
 		{in: testBitStrings[6], want: false},
 		{in: testBitStrings[7], want: true},
 	}
 	for _, c := range cases {
-		got := LongestRunCheck(c.in)
+		got := LongestRunCheck(c.in, 8)
 		if got.Result != c.want {
 			t.Errorf("LongestRunCheck(%q) == %t, want %t", c.in, got.Result, c.want)
 		}
@@ -149,13 +160,78 @@ func TestNonOverlappingTemplateMatchingCheck(t *testing.T) {
 		{testBitStrings[5], templateBitStrings[3], true},
 	}
 	for _, c := range cases {
-		got := NonOverlappingTemplateMatchingCheck(c.in, c.template)
+		got := NonOverlappingTemplateMatchingCheck(c.in, c.template, 8)
 		if got.Result != c.want {
 			t.Errorf("NonOverlappingTemplateMatchingCheck(%q, %q) == %t, want %t", c.in, c.template, got.Result, c.want)
 		}
 	}
 }
 
+func TestNonOverlappingMatches(t *testing.T) {
+	cases := []struct {
+		block, template string
+		want            int
+	}{
+		{"01010", "010", 1},
+		{"0100101", "010", 2},
+		{"1010101010", "1010", 2},
+		{"000000", "00", 3},
+	}
+	for _, c := range cases {
+		block, _ := bitstring.BitStringFromString(c.block)
+		template, _ := bitstring.BitStringFromString(c.template)
+		got := NonOverlappingTemplateMatchingCheck(block, template, 1).Statistics[1]
+		if got.Name != "W_1" || got.Value != float64(c.want) {
+			t.Errorf("NonOverlappingTemplateMatchingCheck(%s, %s, 1) %s == %v, want %d", c.block, c.template,
+				got.Name, got.Value, c.want)
+		}
+	}
+}
+
+func TestAperiodicTemplates(t *testing.T) {
+	cases := []struct {
+		m, want int
+	}{
+		{2, 2},
+		{3, 4},
+		{4, 6},
+		{5, 12},
+		{9, 148},
+		{10, 284},
+	}
+	for _, c := range cases {
+		if got := len(AperiodicTemplates(c.m)); got != c.want {
+			t.Errorf("len(AperiodicTemplates(%d)) == %d, want %d", c.m, got, c.want)
+		}
+	}
+	if got := AperiodicTemplates(9)[0].String(); got != "000000001" {
+		t.Errorf("AperiodicTemplates(9)[0] == %s, want 000000001", got)
+	}
+	if got := len(NonOverlappingTemplateSuite(testBitStrings[0], 9, 8)); got != 148 {
+		t.Errorf("NonOverlappingTemplateSuite returned %d results, want 148", got)
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	uniform := make([]TestResult, 100)
+	skewed := make([]TestResult, 100)
+	for i := range uniform {
+		p := (float64(i) + 0.5) / 100
+		uniform[i] = newResult("Test", 100, pValue(p))
+		skewed[i] = newResult("Test", 100, pValue(0.005))
+	}
+	skewed = append(skewed, newResult("Test", 10, pValue(0.5)).insufficient("too short"))
+
+	s := Summarise("Test", uniform)
+	if s.Passed != 99 || !s.ProportionPassed || !s.UniformityPassed || s.Histogram[0] != 10 {
+		t.Errorf("Summarise(uniform) == %+v, want 99 passes with uniform P values", s)
+	}
+	s = Summarise("Test", skewed)
+	if s.Passed != 0 || s.Count != 100 || s.Inconclusive != 1 || s.ProportionPassed || s.UniformityPassed {
+		t.Errorf("Summarise(skewed) == %+v, want failing proportion and uniformity", s)
+	}
+}
+
 func TestSerialCheck(t *testing.T) {
 	cases := []randomTest{
 		{in: testBitStrings[0], want: true},
@@ -168,7 +244,7 @@ func TestSerialCheck(t *testing.T) {
 		{in: testBitStrings[7], want: true},
 	}
 	for _, c := range cases {
-		got := SerialCheck(c.in)
+		got := SerialCheck(c.in, serialBlockLength(c.in.Length))
 		if got.Result != c.want {
 			t.Errorf("SerialCheck(%q) == %t, want %t", c.in, got.Result, c.want)
 		}
@@ -187,7 +263,7 @@ func TestApproximateEntropyCheck(t *testing.T) {
 		{in: testBitStrings[7], want: true},
 	}
 	for _, c := range cases {
-		got := ApproximateEntropyCheck(c.in)
+		got := ApproximateEntropyCheck(c.in, int(math.Log2(float64(c.in.Length)))-5)
 		if got.Result != c.want {
 			t.Errorf("ApproximateEntropyCheck(%q) == %t, want %t", c.in, got.Result, c.want)
 		}
@@ -212,3 +288,259 @@ func TestCumulativeSumsCheck(t *testing.T) {
 		}
 	}
 }
+
+// The remaining tests use the worked examples in the specification, checking P values where the example's figures
+// follow from the test as specified and the intermediate values otherwise
+
+func TestDiscreteFourierTransformCheck(t *testing.T) {
+	// Example 2.6.4. The spec reports N1 = 4 here and N1 = 46 for example 2.6.8, neither of which agrees with its
+	// own threshold, so the transform is checked by hand and the P values follow the reference implementation
+	bs, _ := bitstring.BitStringFromString("1001010011")
+	x := make([]complex128, bs.Length)
+	for i, b := range bs.Data {
+		x[i] = -1
+		if b {
+			x[i] = 1
+		}
+	}
+	for i, want := range []float64{0, 2, math.Sqrt(20), 2, math.Sqrt(20)} {
+		if got := cmplx.Abs(dft(x)[i]); math.Abs(got-want) > 1e-9 {
+			t.Errorf("|dft(%s)[%d]| == %f, want %f", bs, i, got, want)
+		}
+	}
+
+	cases := []struct {
+		in   *bitstring.BitString
+		want float64
+	}{
+		{bs, 0.468160},
+		{testBitStrings[0], 0.646355},
+	}
+	for _, c := range cases {
+		if got := DiscreteFourierTransformCheck(c.in); math.Abs(got.P-c.want) > 1e-6 {
+			t.Errorf("DiscreteFourierTransformCheck(%q).P == %f, want %f", c.in, got.P, c.want)
+		}
+	}
+}
+
+func TestBinaryMatrixRankCheck(t *testing.T) {
+	// Example 2.5.4, with two 3x3 matrices of rank 2 and 3
+	cases := []struct {
+		rows string
+		want int
+	}{
+		{"010110010", 2},
+		{"010101011", 3},
+	}
+	for _, c := range cases {
+		bs, _ := bitstring.BitStringFromString(c.rows)
+		rows := [][]bool{bs.Data[0:3], bs.Data[3:6], bs.Data[6:9]}
+		if got := binaryRank(rows); got != c.want {
+			t.Errorf("binaryRank(%s) == %d, want %d", c.rows, got, c.want)
+		}
+	}
+
+	// The example uses the probabilities of 32x32 matrices, quoted to four places
+	for r, want := range map[int]float64{32: 0.2888, 31: 0.5776} {
+		if got := rankProbability(r, 32, 32); math.Abs(got-want) > 1e-4 {
+			t.Errorf("rankProbability(%d, 32, 32) == %f, want %f", r, got, want)
+		}
+	}
+	if got := matrixRankP(1, 1, 2, 0.2888, 0.5776); math.Abs(got-0.741948) > 1e-6 {
+		t.Errorf("matrixRankP(1, 1, 2) == %f, want 0.741948", got)
+	}
+
+	bs, _ := bitstring.BitStringFromString("01011001001010101101")
+	if got := BinaryMatrixRankCheck(bs, 3, 3); !got.Result {
+		t.Errorf("BinaryMatrixRankCheck(%q, 3, 3) == false, want true", bs)
+	}
+	if got := BinaryMatrixRankCheck(bs, 32, 32); got.Status != StatusInconclusive {
+		t.Errorf("BinaryMatrixRankCheck(%q, 32, 32) has status %s, want inconclusive", bs, got.Status)
+	}
+}
+
+func TestOverlappingTemplateMatchingCheck(t *testing.T) {
+	// Example 2.8.4, where eta = 1.125
+	for i, want := range []float64{0.324652, 0.182617, 0.142670, 0.106645, 0.077147, 0.166269} {
+		if got := overlappingProbabilities(1.125, 5)[i]; math.Abs(got-want) > 1e-6 {
+			t.Errorf("overlappingProbabilities(1.125, 5)[%d] == %f, want %f", i, got, want)
+		}
+	}
+	// The default parameters use the reference implementation's corrected probabilities
+	for i, want := range []float64{0.364091, 0.185659, 0.139381, 0.100571, 0.070432, 0.139865} {
+		if got := overlappingTemplateProbabilities(9, 1032, 5)[i]; got != want {
+			t.Errorf("overlappingTemplateProbabilities(9, 1032, 5)[%d] == %f, want %f", i, got, want)
+		}
+	}
+
+	bs, _ := bitstring.BitStringFromString("10111011110010110100011100101110111110000101101001")
+	template, _ := bitstring.BitStringFromString("11")
+	if got := OverlappingTemplateMatchingCheck(bs, template, 10); math.Abs(got.P-0.409635) > 1e-6 {
+		t.Errorf("OverlappingTemplateMatchingCheck(%q, %q, 10).P == %f, want 0.409635", bs, template, got.P)
+	}
+}
+
+func TestMaurersUniversalCheck(t *testing.T) {
+	// Example 2.9.4. Its P value omits the variance correction for K, so only the statistic is checked
+	bs, _ := bitstring.BitStringFromString("01011010011101010111")
+	if got := MaurersUniversalCheck(bs, 2, 4).Statistics[0].Value; math.Abs(got-1.1949875) > 1e-7 {
+		t.Errorf("MaurersUniversalCheck(%q, 2, 4) f_n == %f, want 1.1949875", bs, got)
+	}
+	if got := MaurersUniversalCheck(bs, 2, 20); got.Result {
+		t.Errorf("MaurersUniversalCheck(%q, 2, 20) == true with no test blocks, want false", bs)
+	}
+
+	cases := []struct {
+		n    int
+		want int
+	}{
+		{1000, 1},
+		{387839, 5},
+		{387840, 6},
+		{1000000, 7},
+	}
+	for _, c := range cases {
+		if got := universalBlockLength(c.n); got != c.want {
+			t.Errorf("universalBlockLength(%d) == %d, want %d", c.n, got, c.want)
+		}
+	}
+}
+
+func TestLinearComplexityCheck(t *testing.T) {
+	// Example 2.10.4
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"1101011110001", 4},
+		{"0000000000", 0},
+		{"0000000001", 10},
+		{"1010101010", 2},
+	}
+	for _, c := range cases {
+		bs, _ := bitstring.BitStringFromString(c.in)
+		if got := linearComplexity(bs.Data); got != c.want {
+			t.Errorf("linearComplexity(%s) == %d, want %d", c.in, got, c.want)
+		}
+	}
+	if got := LinearComplexityCheck(testBitStrings[5], 20); got.Result {
+		t.Errorf("LinearComplexityCheck(%q, 20) == true, want false", testBitStrings[5])
+	}
+}
+
+func TestRandomExcursionsCheck(t *testing.T) {
+	// Example 2.14.4, which quotes a rounded chisq value
+	bs, _ := bitstring.BitStringFromString("0110110101")
+	ps := RandomExcursionsCheck(bs).PValues
+	if len(ps) != 8 {
+		t.Fatalf("RandomExcursionsCheck(%q) gave %d P values, want 8", bs, len(ps))
+	}
+	if got := ps[4]; got.Name != "x = +1" || math.Abs(got.Value-0.502529) > 1e-4 {
+		t.Errorf("RandomExcursionsCheck(%q) gave %s = %f, want x = +1 = 0.502529", bs, got.Name, got.Value)
+	}
+}
+
+func TestRandomExcursionsVariantCheck(t *testing.T) {
+	// Example 2.15.4
+	bs, _ := bitstring.BitStringFromString("0110110101")
+	ps := RandomExcursionsVariantCheck(bs).PValues
+	if len(ps) != 18 {
+		t.Fatalf("RandomExcursionsVariantCheck(%q) gave %d P values, want 18", bs, len(ps))
+	}
+	if got := ps[9]; got.Name != "x = +1" || math.Abs(got.Value-0.683091) > 1e-6 {
+		t.Errorf("RandomExcursionsVariantCheck(%q) gave %s = %f, want x = +1 = 0.683091", bs, got.Name, got.Value)
+	}
+}
+
+func TestWorkedExamples(t *testing.T) {
+	e := testBitStrings[0]
+	cases := []struct {
+		name string
+		got  TestResult
+		want float64
+		tol  float64
+	}{
+		{"FrequencyCheck", FrequencyCheck(e), 0.109599, 1e-6},
+		{"BlockFrequencyCheck", BlockFrequencyCheck(e, 10), 0.706438, 1e-6},
+		{"RunsCheck", RunsCheck(e), 0.500798, 1e-6},
+		// The example's class probabilities are quoted to four places
+		{"LongestRunCheck", LongestRunCheck(testBitStrings[7], 8), 0.180609, 1e-4},
+		{"ApproximateEntropyCheck", ApproximateEntropyCheck(e, 2), 0.235301, 1e-6},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got.P-c.want) > c.tol {
+			t.Errorf("%s P == %f, want %f", c.name, c.got.P, c.want)
+		}
+	}
+	if got := CumulativeSumsCheck(e).PValues; math.Abs(got[0].Value-0.219194) > 1e-6 ||
+		math.Abs(got[1].Value-0.114866) > 1e-6 {
+		t.Errorf("CumulativeSumsCheck P values == %v, want forward 0.219194, backward 0.114866", got)
+	}
+
+	bs, _ := bitstring.BitStringFromString("0011011101")
+	if got := SerialCheck(bs, 3).PValues; math.Abs(got[0].Value-0.808792) > 1e-6 ||
+		math.Abs(got[1].Value-0.670320) > 1e-6 {
+		t.Errorf("SerialCheck(%q, 3) P values == %v, want 0.808792, 0.670320", bs, got)
+	}
+	// The example evaluates the normal distribution from rounded tables
+	bs, _ = bitstring.BitStringFromString("1011010111")
+	if got := CumulativeSumsCheck(bs).PValues[0].Value; math.Abs(got-0.4116588) > 1e-4 {
+		t.Errorf("CumulativeSumsCheck(%q) P == %f, want 0.4116588", bs, got)
+	}
+}
+
+func TestInconclusive(t *testing.T) {
+	short, _ := bitstring.BitStringFromString("0011011101")
+	cases := []struct {
+		name string
+		got  TestResult
+		want TestStatus
+	}{
+		{"FrequencyCheck", FrequencyCheck(short), StatusInconclusive},
+		{"BlockFrequencyCheck", BlockFrequencyCheck(testBitStrings[0], 10), StatusInconclusive},
+		{"BlockFrequencyCheck", BlockFrequencyCheck(testBitStrings[0], 20), StatusPass},
+		{"LongestRunCheck", LongestRunCheck(testBitStrings[7], 128), StatusInconclusive},
+		{"SerialCheck", SerialCheck(testBitStrings[0], 4), StatusInconclusive},
+		{"ApproximateEntropyCheck", ApproximateEntropyCheck(testBitStrings[0], 2), StatusInconclusive},
+		{"CumulativeSumsCheck", CumulativeSumsCheck(bitstring.NewBitString()), StatusInconclusive},
+		{"DiscreteFourierTransformCheck", DiscreteFourierTransformCheck(testBitStrings[0]), StatusInconclusive},
+	}
+	for _, c := range cases {
+		if c.got.Status != c.want {
+			t.Errorf("%s has status %s (%s), want %s", c.name, c.got.Status, c.got.Reason, c.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("LongestRunCheck(bs, 10) did not panic")
+		}
+	}()
+	LongestRunCheck(testBitStrings[7], 10)
+}
+
+func TestCheckOptions(t *testing.T) {
+	bs := NewPseudoRandomExtractor(42).GetBits(1000)
+	_, results := CheckRandom(bs, CheckOptions{Tests: []string{"frequency", "serial"}})
+	if len(results) != 2 || results[0].Name != "Frequency" || results[1].Name != "Serial" {
+		t.Errorf("CheckRandom ran %d tests, want Frequency and Serial", len(results))
+	}
+	for _, r := range results {
+		if len(r.PValues) == 0 || r.SampleSize != 1000 || r.Significance != DefaultSignificance {
+			t.Errorf("CheckRandom gave result %+v, want P values over 1000 bits at the default significance", r)
+		}
+	}
+
+	// Every P value fails at a significance level of almost one
+	passed, results := CheckRandom(bs, CheckOptions{Significance: 0.999, Tests: []string{"frequency"}})
+	if passed || results[0].Significance != 0.999 || results[0].Status != StatusFail {
+		t.Errorf("CheckRandom at significance 0.999 passed with %+v", results[0])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("CheckRandom with an unknown test did not panic")
+		}
+	}()
+	CheckRandom(bs, CheckOptions{Tests: []string{"frequncy"}})
+}
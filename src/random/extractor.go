@@ -93,13 +93,45 @@ func (e *RandomWalkExtractor) GetBits(n int) *bitstring.BitString {
 	return current.value
 }
 
+// The two-source extractor bound only holds for the inner product over GF(2^n)^blockSize, but the blocks are
+// multiplied as integers mod 2^n, which is not a field, so the output is never credited
+func (e *InnerProductExtractor) EntropyBound(n int) EntropyBound {
+	return EntropyBound{}
+}
+
+func (e *InnerProductExtractor) entropyInputs(n int) []entropyInput {
+	return []entropyInput{{"input1", e.input1, e.blockSize * n}, {"input2", e.input2, e.blockSize * n}}
+}
+
+// Every neighbour is drawn from a PRNG with a 48 bit seed, so after the first step the walk only visits those nodes,
+// and the output carries at most 48 bits plus the walk's own min-entropy, however good the start vertex. The expander
+// bound does not apply, so the output is never credited
+func (e *RandomWalkExtractor) EntropyBound(n int) EntropyBound {
+	return EntropyBound{}
+}
+
+func (e *RandomWalkExtractor) entropyInputs(n int) []entropyInput {
+	steps := 2 * int(math.Log2(float64(n)))
+	return []entropyInput{{"input1", e.input1, 64 + n}, {"input2", e.input2, steps * int(math.Log2(float64(e.d)))}}
+}
+
 // Pseudo-random extractor (used for PRNG)
 type PseudoRandomExtractor struct {
 	seed int
+
+	seedBound EntropyBound // Bound on the 48 seed bits used, unknown unless set when the extractor is configured
 }
 
 func NewPseudoRandomExtractor(seed int) *PseudoRandomExtractor {
-	return &PseudoRandomExtractor{(seed ^ 0x5DEECE66D) & (1<<48 - 1)}
+	return &PseudoRandomExtractor{seed: (seed ^ 0x5DEECE66D) & (1<<48 - 1)}
+}
+
+// The output of a PRNG can never carry more min-entropy than its 48 bit seed
+func (e *PseudoRandomExtractor) EntropyBound(n int) EntropyBound {
+	if !e.seedBound.Known {
+		return EntropyBound{}
+	}
+	return EntropyBound{math.Min(float64(n), math.Min(48, e.seedBound.MinEntropy)), e.seedBound.Error, true, false}
 }
 
 func (e *PseudoRandomExtractor) GetBits(n int) *bitstring.BitString {
@@ -120,3 +152,118 @@ func (e *PseudoRandomExtractor) GetBits(n int) *bitstring.BitString {
 
 	return result
 }
+
+// Von Neumann debiaser, reading pairs of bits and outputting the first bit of each pair that differs
+type VonNeumannExtractor struct {
+	input Extractable
+}
+
+func NewVonNeumannExtractor(input Extractable) *VonNeumannExtractor {
+	return &VonNeumannExtractor{input}
+}
+
+func (e *VonNeumannExtractor) GetBits(n int) *bitstring.BitString {
+	result := bitstring.NewBitString()
+	for result.Length < n {
+		// Each pair produces at most one bit, so this never overshoots
+		bs := e.input.GetBits(2 * (n - result.Length))
+		for i := 0; i < bs.Length; i += 2 {
+			if bs.At(i) != bs.At(i+1) {
+				result.Add(bs.At(i))
+			}
+		}
+	}
+	return result
+}
+
+// The output is exactly unbiased only if the input bits are independent and identically distributed, so it is
+// credited in full when the input is declared IID, and not at all otherwise
+func (e *VonNeumannExtractor) EntropyBound(n int) EntropyBound {
+	b := boundOf(e.input, e.inputBits(n))
+	if !b.Known || !b.IID || b.MinEntropy == 0 {
+		return EntropyBound{}
+	}
+	return EntropyBound{float64(n), b.Error, true, true}
+}
+
+func (e *VonNeumannExtractor) entropyInputs(n int) []entropyInput {
+	return []entropyInput{{"input", e.input, e.inputBits(n)}}
+}
+
+// Expected number of input bits read to produce [n] bits, for independent bits whose most likely value has
+// probability p = 2^-h, where h is the input's declared rate
+func (e *VonNeumannExtractor) inputBits(n int) int {
+	b := boundOf(e.input, 2*n)
+	if !b.Known || b.MinEntropy == 0 {
+		return 2 * n
+	}
+	p := math.Pow(2, -b.MinEntropy/float64(2*n))
+	return int(math.Ceil(float64(n) / (p * (1 - p))))
+}
+
+const defaultToeplitzExpansion = 2
+
+// Conditioner applying a Toeplitz matrix, a universal hash, to its input. The matrix is defined by bits from a
+// seed input, which should be uniform and independent of the input; the seed is read once and reused
+type ToeplitzExtractor struct {
+	input     Extractable
+	seedInput Extractable
+	expansion int                  // Number of input bits read per output bit
+	seed      *bitstring.BitString // Seed bits read so far
+}
+
+// Creates a new Toeplitz extractor hashing [expansion] bits of [input] into each output bit, using [seed] to
+// choose the hash. An expansion of 0 uses the default of 2
+func NewToeplitzExtractor(input, seed Extractable, expansion int) *ToeplitzExtractor {
+	if expansion <= 0 {
+		expansion = defaultToeplitzExpansion
+	}
+	return &ToeplitzExtractor{input, seed, expansion, bitstring.NewBitString()}
+}
+
+func (e *ToeplitzExtractor) GetBits(n int) *bitstring.BitString {
+	l := e.expansion * n
+	if need := l + n - 1 - e.seed.Length; need > 0 {
+		e.seed = e.seed.Extend(e.seedInput.GetBits(need))
+	}
+	return ToeplitzHash(e.seed.Substring(0, l+n-1), e.input.GetBits(l), n)
+}
+
+// Bounds the output using the leftover hash lemma, where an m bit output is 2^-((k-m)/2) close to uniform for an
+// input with min-entropy k. The lemma needs a uniform seed, so nothing is credited if the seed is not full entropy
+func (e *ToeplitzExtractor) EntropyBound(n int) EntropyBound {
+	l := e.expansion * n
+	b := boundOf(e.input, l)
+	seed := boundOf(e.seedInput, l+n-1)
+	if !b.Known || !seed.Known {
+		return EntropyBound{}
+	}
+	if seed.MinEntropy < float64(l+n-1) {
+		return EntropyBound{0, b.Error + seed.Error, true, false}
+	}
+	return extractorBound(n, b.MinEntropy, b.Error+seed.Error)
+}
+
+func (e *ToeplitzExtractor) entropyInputs(n int) []entropyInput {
+	l := e.expansion * n
+	return []entropyInput{{"input", e.input, l}, {"seed", e.seedInput, l + n - 1}}
+}
+
+// Multiplies [x] by the [m] x len(x) Toeplitz matrix whose diagonals are given by [seed], which must contain
+// len(x)+m-1 bits. Entry (i, j) of the matrix is seed[i-j+len(x)-1]
+func ToeplitzHash(seed, x *bitstring.BitString, m int) *bitstring.BitString {
+	if seed.Length != x.Length+m-1 {
+		panic("ToeplitzHash: seed must contain len(x)+m-1 bits")
+	}
+	result := bitstring.BitStringOfLength(m)
+	for i := 0; i < m; i++ {
+		bit := false
+		for j := 0; j < x.Length; j++ {
+			if x.Data[j] && seed.Data[i-j+x.Length-1] {
+				bit = !bit
+			}
+		}
+		result.Data[i] = bit
+	}
+	return result
+}
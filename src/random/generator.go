@@ -20,12 +20,63 @@ type ExtractableConfig struct {
 	Seed          int                `json:"seed"`
 	SeedGenerator *ExtractableConfig `json:"seedGenerator"`
 	Path          string             `json:"path"`
+	OnEOF         string             `json:"onEOF"`
+	Network       string             `json:"network"`
+	Address       string             `json:"address"`
+	APIKey        string             `json:"apiKey"`
+	Method        string             `json:"method"`
+	URL           string             `json:"url"`
+	PublicKey     string             `json:"publicKey"`
+	Device        string             `json:"device"`
+	SampleRate    int                `json:"sampleRate"`
+	Channels      int                `json:"channels"`
+	BitsPerSample int                `json:"bitsPerSample"`
+	LSBs          int                `json:"lsbs"`
+	Width         int                `json:"width"`
+	Height        int                `json:"height"`
+	OSR           int                `json:"osr"`
+	MinEntropy    float64            `json:"minEntropy"`
+	IID           bool               `json:"iid"`
+	Expansion     int                `json:"expansion"`
+	Health        *HealthTestConfig  `json:"health"`
 	Input1        *ExtractableConfig `json:"input1"`
 	Input2        *ExtractableConfig `json:"input2"`
 }
 
+// Health tests attached to a config node
+type HealthTestConfig struct {
+	MinEntropy float64            `json:"minEntropy"`
+	SampleBits int                `json:"sampleBits"`
+	Alpha      float64            `json:"alpha"`
+	OnFailure  string             `json:"onFailure"`
+	Fallback   *ExtractableConfig `json:"fallback"`
+}
+
+// What a generator does when asked for more bits than the entropy bound of its extractor justifies
+type EntropyPolicy int
+
+const (
+	EntropyIgnore EntropyPolicy = iota // Return the bits regardless
+	EntropyFlag                        // Return the bits, counting the request in Flagged
+	EntropyRefuse                      // Refuse the request, GetBits panics with an *EntropyError
+)
+
+// Error reported when a request is refused for exceeding the entropy bound
+type EntropyError struct {
+	Requested int
+	Bound     EntropyBound
+}
+
+func (e *EntropyError) Error() string {
+	return fmt.Sprintf("generator: %d bits requested, bound is %s", e.Requested, e.Bound)
+}
+
 type Generator struct {
 	e Extractable
+
+	policy  EntropyPolicy
+	epsilon float64 // Largest statistical error the policy accepts
+	flagged int     // Number of requests flagged by the policy
 }
 
 // Creates a random number genertor using the configuration defined in 'default.json'
@@ -51,42 +102,164 @@ func NewGeneratorFromConfig(name string) *Generator {
 	return NewGeneratorFromExtractable(configureExtractable(*config.Extractor))
 }
 
-// Compiles the json representation
+// Compiles the json representation, wrapping the node in its declared min-entropy and health tests if configured
 func configureExtractable(config ExtractableConfig) Extractable {
+	e := buildExtractable(config)
+	if config.MinEntropy > 0 && config.IID {
+		e = NewDeclaredIIDInput(e, config.MinEntropy)
+	} else if config.MinEntropy > 0 {
+		e = NewDeclaredInput(e, config.MinEntropy)
+	}
+	if config.Health == nil {
+		return e
+	}
+
+	health := HealthConfig{MinEntropy: config.Health.MinEntropy, SampleBits: config.Health.SampleBits,
+		Alpha: config.Health.Alpha}
+	switch config.Health.OnFailure {
+	case "", "error":
+		health.OnFailure = HealthFailError
+	case "block":
+		health.OnFailure = HealthFailBlock
+	case "fallback":
+		if config.Health.Fallback == nil {
+			panic("NewGenerator: Invalid health config (fallback policy without a fallback)")
+		}
+		health.OnFailure = HealthFailFallback
+		health.Fallback = configureExtractable(*config.Health.Fallback)
+	default:
+		panic(fmt.Sprintf("NewGenerator: Invalid health config (onFailure '%s')", config.Health.OnFailure))
+	}
+	return NewHealthTestedInput(e, health)
+}
+
+// Builds the extractable described by a single config node
+func buildExtractable(config ExtractableConfig) Extractable {
 	switch config.Type {
 	case "pseudorandom":
 		if config.SeedGenerator != nil {
-			return NewPseudoRandomExtractor(configureExtractable(*config.SeedGenerator).GetBits(64).Int())
+			seed := configureExtractable(*config.SeedGenerator)
+			e := NewPseudoRandomExtractor(seed.GetBits(64).Int())
+			// Only the low 48 bits of the seed are used, losing up to 16 bits of its min-entropy
+			e.seedBound = boundOf(seed, 64)
+			e.seedBound.MinEntropy = math.Max(0, e.seedBound.MinEntropy-16)
+			return e
 		} else {
-			return NewPseudoRandomExtractor(config.Seed)
+			e := NewPseudoRandomExtractor(config.Seed)
+			e.seedBound = EntropyBound{Known: true}
+			return e
 		}
 	case "input":
-		_, thisfile, _, _ := runtime.Caller(0)
-		return NewInput(fmt.Sprintf("%s/%s", path.Dir(path.Dir(path.Dir(thisfile))), config.Path))
+		return NewInput(resolvePath(config.Path))
+	case "file":
+		switch config.OnEOF {
+		case "", "fail":
+			return NewFileInput(resolvePath(config.Path), EOFFail)
+		case "rewind":
+			return NewFileInput(resolvePath(config.Path), EOFRewind)
+		case "reopen":
+			return NewFileInput(resolvePath(config.Path), EOFReopen)
+		default:
+			panic(fmt.Sprintf("NewGenerator: Invalid onEOF policy '%s'", config.OnEOF))
+		}
+	case "device":
+		return NewDeviceInput(resolvePath(config.Path))
+	case "socket":
+		return NewSocketInput(config.Network, config.Address)
+	case "osrandom":
+		return NewOSRandomInput()
+	case "randomorg":
+		rc := RandomOrgConfig{APIKey: config.APIKey, URL: config.URL, Method: config.Method}
+		if config.PublicKey != "" {
+			key, err := LoadRandomOrgPublicKey(resolvePath(config.PublicKey))
+			if err != nil {
+				panic(fmt.Sprintf("NewGenerator: %v", err))
+			}
+			rc.PublicKey = key
+		}
+		return NewRandomOrgSource(rc)
+	case "jitter":
+		return NewJitterInput(config.OSR)
+	case "audio":
+		opts := AudioOptions{config.SampleRate, config.Channels, config.BitsPerSample, config.LSBs}
+		return NewAudioFileInput(resolvePath(config.Path), opts)
+	case "arecord":
+		opts := AudioOptions{config.SampleRate, config.Channels, config.BitsPerSample, config.LSBs}
+		i, err := NewArecordInput(config.Device, opts)
+		if err != nil {
+			panic(fmt.Sprintf("NewGenerator: %v", err))
+		}
+		return i
+	case "video":
+		opts := VideoOptions{config.Width, config.Height, config.LSBs}
+		p := resolvePath(config.Path)
+		if info, err := os.Stat(p); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return NewV4L2Input(p, opts)
+		}
+		return NewVideoFileInput(p, opts)
 	case "innerproduct":
 		return NewInnerProductExtractor(configureExtractable(*config.Input1), configureExtractable(*config.Input2))
 	case "randomwalk":
 		return NewRandomWalkExtractor(configureExtractable(*config.Input1), configureExtractable(*config.Input2))
+	case "vonneumann":
+		return NewVonNeumannExtractor(configureExtractable(*config.Input1))
+	case "toeplitz":
+		return NewToeplitzExtractor(configureExtractable(*config.Input1), configureExtractable(*config.Input2),
+			config.Expansion)
 	default:
 		panic("NewGenerator: Invalid generator config (extractable object)")
 	}
 }
 
+// Resolves relative paths in a config against the root of the repository
+func resolvePath(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	_, thisfile, _, _ := runtime.Caller(0)
+	return fmt.Sprintf("%s/%s", path.Dir(path.Dir(path.Dir(thisfile))), p)
+}
+
 // Creates a random number generator using a user defined configuration
 func NewGeneratorFromExtractable(e Extractable) *Generator {
-	return &Generator{e}
+	return &Generator{e: e, epsilon: DefaultEntropyErr}
+}
+
+// Sets what happens when a request exceeds the extractor's entropy bound, accepting statistical errors of up to
+// [epsilon]. An epsilon of 0 uses DefaultEntropyErr
+func (g *Generator) SetEntropyPolicy(policy EntropyPolicy, epsilon float64) {
+	if epsilon <= 0 {
+		epsilon = DefaultEntropyErr
+	}
+	g.policy = policy
+	g.epsilon = epsilon
+}
+
+// Number of requests flagged under EntropyFlag
+func (g *Generator) Flagged() int {
+	return g.flagged
+}
+
+// Bound on the whole extractor tree for a request of defaultReportBits bits
+func (g *Generator) Report() *EntropyReport {
+	return g.ReportFor(defaultReportBits)
+}
+
+// Bound on the whole extractor tree for a request of [n] bits
+func (g *Generator) ReportFor(n int) *EntropyReport {
+	return reportOf("", g.e, n)
 }
 
 // Gets a bool from the extractable
 func (g *Generator) NextBool() bool {
-	return g.e.GetBits(1).At(0)
+	return g.GetBits(1).At(0)
 }
 
 // Gets a 64 bit float following IEEE 754 double-precision binary format
 func (g *Generator) NextFloat64() float64 {
 	sign := g.next(1)
 	fraction := 1.0
-	for i, b := range g.e.GetBits(52).Data {
+	for i, b := range g.GetBits(52).Data {
 		if b {
 			fraction += math.Pow(2, float64(-(i + 1)))
 		}
@@ -103,7 +276,7 @@ func (g *Generator) NextInt() int {
 // Gets a 64 bit float between 0 and 1 includive
 func (g *Generator) NextNormalizedFloat() float64 {
 	fraction := 1.0
-	for i, b := range g.e.GetBits(52).Data {
+	for i, b := range g.GetBits(52).Data {
 		if b {
 			fraction -= math.Pow(2, float64(-(i + 1)))
 		}
@@ -127,10 +300,27 @@ func (g *Generator) NextIntBetween(start, end int) int {
 
 // Gets an integer consisting of n bits of randomness, with n < 64
 func (g *Generator) next(n int) int {
-	return g.e.GetBits(n).Int()
+	return g.GetBits(n).Int()
 }
 
-// Allow bits to be taken straight from the extractor
+// Allow bits to be taken straight from the extractor, subject to the generator's entropy policy
 func (g *Generator) GetBits(n int) *bitstring.BitString {
-	return g.e.GetBits(n)
+	bs, err := g.TryGetBits(n)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+// Gets bits from the extractor, returning an *EntropyError instead if the entropy policy refuses the request
+func (g *Generator) TryGetBits(n int) (*bitstring.BitString, error) {
+	if g.policy != EntropyIgnore {
+		if b := boundOf(g.e, n); !b.Justifies(n, g.epsilon) {
+			if g.policy == EntropyRefuse {
+				return nil, &EntropyError{n, b}
+			}
+			g.flagged++
+		}
+	}
+	return g.e.GetBits(n), nil
 }
@@ -0,0 +1,254 @@
+/* Continuous health tests for entropy sources, as described in section 4.4 of
+ * https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-90B.pdf
+ */
+
+package random
+
+import (
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"time"
+)
+
+// Behaviour of a HealthTestedInput when a health test fails
+type HealthFailurePolicy int
+
+const (
+	HealthFailError    HealthFailurePolicy = iota // Panic with a *HealthTestError
+	HealthFailBlock                               // Discard output and wait until the source passes the startup tests again
+	HealthFailFallback                            // Permanently switch to a fallback source
+)
+
+const (
+	defaultHealthAlpha      = 20   // False positive rate of the health tests is 2^-alpha
+	defaultHealthSampleBits = 1    // Samples are single bits unless configured otherwise
+	healthStartupSamples    = 1024 // Number of samples tested before any output is used
+	aptWindowBinary         = 1024 // APT window for binary sources
+	aptWindowNonBinary      = 512  // APT window for all other sources
+	defaultBlockInterval    = 100 * time.Millisecond
+)
+
+// Configuration of a HealthTestedInput, zero values are replaced by defaults
+type HealthConfig struct {
+	MinEntropy    float64             // Declared min-entropy per sample in bits, required
+	SampleBits    int                 // Number of bits making up each sample
+	Alpha         float64             // Tests have a false positive rate of 2^-Alpha
+	OnFailure     HealthFailurePolicy // What to do when a test fails
+	Fallback      Extractable         // Source used after a failure under HealthFailFallback
+	BlockInterval time.Duration       // Wait between recovery attempts under HealthFailBlock
+}
+
+// Error reported when a health test fails
+type HealthTestError struct {
+	Test    string // Name of the failing test
+	Sample  int    // The sample value that caused the failure
+	Startup bool   // Whether the failure happened during the startup tests
+}
+
+func (e *HealthTestError) Error() string {
+	if e.Startup {
+		return fmt.Sprintf("health: %s failed during startup on sample %d", e.Test, e.Sample)
+	}
+	return fmt.Sprintf("health: %s failed on sample %d", e.Test, e.Sample)
+}
+
+// Repetition Count Test (SP 800-90B 4.4.1), detecting a source stuck on a single value
+type RepetitionCountTest struct {
+	cutoff int
+	last   int
+	count  int
+}
+
+// Builds an RCT for samples with [h] bits of min-entropy, with a false positive rate of 2^-[alpha]
+func NewRepetitionCountTest(h, alpha float64) *RepetitionCountTest {
+	return &RepetitionCountTest{cutoff: 1 + int(math.Ceil(alpha/h))}
+}
+
+// Returns false once the same sample has been seen [cutoff] times in a row
+func (t *RepetitionCountTest) Test(sample int) bool {
+	if sample == t.last && t.count > 0 {
+		t.count++
+	} else {
+		t.last, t.count = sample, 1
+	}
+	return t.count < t.cutoff
+}
+
+func (t *RepetitionCountTest) Reset() {
+	t.count = 0
+}
+
+// Adaptive Proportion Test (SP 800-90B 4.4.2), detecting a large loss of entropy such as a value becoming common
+type AdaptiveProportionTest struct {
+	window int
+	cutoff int
+	first  int
+	seen   int // Samples seen in the current window
+	count  int // Occurrences of the first sample of the window
+}
+
+// Builds an APT over windows of [w] samples with [h] bits of min-entropy, with a false positive rate of 2^-[alpha]
+func NewAdaptiveProportionTest(w int, h, alpha float64) *AdaptiveProportionTest {
+	return &AdaptiveProportionTest{window: w, cutoff: aptCutoff(w, h, alpha)}
+}
+
+// Returns false if the first sample of a window occurs [cutoff] times within that window
+func (t *AdaptiveProportionTest) Test(sample int) bool {
+	if t.seen == 0 {
+		t.first, t.count = sample, 0
+	}
+	if sample == t.first {
+		t.count++
+	}
+	t.seen = (t.seen + 1) % t.window
+	return t.count < t.cutoff
+}
+
+func (t *AdaptiveProportionTest) Reset() {
+	t.seen = 0
+}
+
+// Computes the APT cutoff for a window of [w] samples each with [h] bits of min-entropy and a false positive rate of
+// 2^-[alpha], as the smallest c with P(X >= c) <= 2^-alpha where X ~ Binomial(w, 2^-h)
+func aptCutoff(w int, h float64, alpha float64) int {
+	p := math.Pow(2, -h)
+	target := math.Pow(2, -alpha)
+	tail := 0.0
+	for c := w; c > 0; c-- {
+		lg1, _ := math.Lgamma(float64(w + 1))
+		lg2, _ := math.Lgamma(float64(c + 1))
+		lg3, _ := math.Lgamma(float64(w - c + 1))
+		pc := math.Exp(lg1 - lg2 - lg3 + float64(c)*math.Log(p) + float64(w-c)*math.Log1p(-p))
+		if tail+pc > target {
+			return c + 1
+		}
+		tail += pc
+	}
+	return 1
+}
+
+// Wraps an input, running the RCT and APT over every sample it produces
+type HealthTestedInput struct {
+	input    Extractable
+	config   HealthConfig
+	rct      *RepetitionCountTest
+	apt      *AdaptiveProportionTest
+	failed   bool // Set once the input has switched to its fallback
+	failures int  // Number of health test failures seen
+}
+
+// Builds a new health tested input wrapping [input], running the startup tests immediately
+func NewHealthTestedInput(input Extractable, config HealthConfig) *HealthTestedInput {
+	if config.SampleBits <= 0 {
+		config.SampleBits = defaultHealthSampleBits
+	}
+	if config.MinEntropy <= 0 || config.MinEntropy > float64(config.SampleBits) {
+		panic("HealthTestedInput: min-entropy per sample must be in (0, SampleBits]")
+	}
+	if config.Alpha <= 0 {
+		config.Alpha = defaultHealthAlpha
+	}
+	if config.BlockInterval <= 0 {
+		config.BlockInterval = defaultBlockInterval
+	}
+	if config.OnFailure == HealthFailFallback && config.Fallback == nil {
+		panic("HealthTestedInput: fallback policy requires a fallback source")
+	}
+
+	window := aptWindowNonBinary
+	if config.SampleBits == 1 {
+		window = aptWindowBinary
+	}
+	i := &HealthTestedInput{
+		input:  input,
+		config: config,
+		rct:    NewRepetitionCountTest(config.MinEntropy, config.Alpha),
+		apt:    NewAdaptiveProportionTest(window, config.MinEntropy, config.Alpha),
+	}
+	if err := i.startup(); err != nil {
+		i.fail(err)
+	}
+	return i
+}
+
+// Number of health test failures seen so far
+func (i *HealthTestedInput) Failures() int {
+	return i.failures
+}
+
+// Reports whether the input has switched to its fallback source
+func (i *HealthTestedInput) Failed() bool {
+	return i.failed
+}
+
+// Fetches n bits from the wrapped input, testing every sample before returning them
+func (i *HealthTestedInput) GetBits(n int) *bitstring.BitString {
+	for !i.failed {
+		// Only whole samples can be tested, so round up and discard the extra bits
+		samples := (n-1)/i.config.SampleBits + 1
+		bs := i.input.GetBits(samples * i.config.SampleBits)
+		if err := i.test(bs, false); err != nil {
+			i.fail(err)
+			continue
+		}
+		return bs.Substring(0, n)
+	}
+	return i.config.Fallback.GetBits(n)
+}
+
+// Credits the declared min-entropy per sample, or defers to the fallback once the input has switched to it
+func (i *HealthTestedInput) EntropyBound(n int) EntropyBound {
+	if i.failed {
+		return boundOf(i.config.Fallback, n)
+	}
+	return rateBound(i.config.MinEntropy/float64(i.config.SampleBits), n)
+}
+
+func (i *HealthTestedInput) entropyInputs(n int) []entropyInput {
+	if i.failed {
+		return []entropyInput{{"fallback", i.config.Fallback, n}}
+	}
+	return []entropyInput{{"tested", i.input, n}}
+}
+
+// Runs the startup tests over healthStartupSamples samples, which are then discarded
+func (i *HealthTestedInput) startup() error {
+	i.rct.Reset()
+	i.apt.Reset()
+	return i.test(i.input.GetBits(healthStartupSamples*i.config.SampleBits), true)
+}
+
+// Runs both tests over every sample in [bs]
+func (i *HealthTestedInput) test(bs *bitstring.BitString, startup bool) error {
+	for _, sample := range bs.Partition(i.config.SampleBits) {
+		v := sample.Int()
+		if !i.rct.Test(v) {
+			return &HealthTestError{"Repetition Count Test", v, startup}
+		}
+		if !i.apt.Test(v) {
+			return &HealthTestError{"Adaptive Proportion Test", v, startup}
+		}
+	}
+	return nil
+}
+
+// Applies the failure policy after [err]
+func (i *HealthTestedInput) fail(err error) {
+	i.failures++
+	switch i.config.OnFailure {
+	case HealthFailBlock:
+		// Wait until the source passes a fresh set of startup tests
+		for {
+			time.Sleep(i.config.BlockInterval)
+			if i.startup() == nil {
+				return
+			}
+			i.failures++
+		}
+	case HealthFailFallback:
+		i.failed = true
+	default:
+		panic(err)
+	}
+}
@@ -0,0 +1,90 @@
+package random
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"testing"
+)
+
+// Input producing zeros after the first [good] bits, as a stuck sensor would
+type stuckInput struct {
+	rng  Extractable
+	good int
+}
+
+func (i *stuckInput) GetBits(n int) *bitstring.BitString {
+	if i.good >= n {
+		i.good -= n
+		return i.rng.GetBits(n)
+	}
+	return bitstring.BitStringOfLength(n)
+}
+
+func TestAPTCutoff(t *testing.T) {
+	// Cutoffs from SP 800-90B table 2 (W = 512, alpha = 2^-20)
+	cases := map[float64]int{0.5: 410, 1: 311, 2: 177, 4: 62, 8: 13}
+	for h, want := range cases {
+		if got := aptCutoff(512, h, 20); got != want {
+			t.Errorf("aptCutoff(512, %g, 20) == %d, wanted %d", h, got, want)
+		}
+	}
+}
+
+func TestRepetitionCountTest(t *testing.T) {
+	rct := NewRepetitionCountTest(10, 20)
+	for i, want := range []bool{true, true, false, true} {
+		v := 1
+		if i == 3 {
+			v = 2
+		}
+		if got := rct.Test(v); got != want {
+			t.Errorf("RepetitionCountTest.Test(%d) at sample %d == %t, wanted %t", v, i, got, want)
+		}
+	}
+}
+
+func TestHealthTestedInput(t *testing.T) {
+	i := NewHealthTestedInput(NewOSRandomInput(), HealthConfig{MinEntropy: 0.9})
+	if bs := i.GetBits(10000); bs.Length != 10000 {
+		t.Errorf("HealthTestedInput.GetBits(10000) contained %d bits", bs.Length)
+	}
+	if i.Failures() != 0 {
+		t.Errorf("HealthTestedInput reported %d failures on crypto/rand", i.Failures())
+	}
+}
+
+func TestHealthTestedInputError(t *testing.T) {
+	defer func() {
+		if err, ok := recover().(*HealthTestError); !ok || err.Startup {
+			t.Error("HealthTestedInput did not panic with a HealthTestError when its source became stuck")
+		}
+	}()
+	i := NewHealthTestedInput(&stuckInput{NewOSRandomInput(), 8192}, HealthConfig{MinEntropy: 1, SampleBits: 8})
+	i.GetBits(10000)
+}
+
+func TestHealthTestedInputStartup(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HealthTestError)
+		if !ok || !err.Startup {
+			t.Error("HealthTestedInput did not fail its startup tests on a stuck source")
+		}
+	}()
+	NewHealthTestedInput(&stuckInput{NewOSRandomInput(), 0}, HealthConfig{MinEntropy: 1})
+}
+
+func TestHealthTestedInputFallback(t *testing.T) {
+	fallback := &MockInput{MockGetBits: func(n int) *bitstring.BitString {
+		bs := bitstring.BitStringOfLength(n)
+		bs.Invert(0)
+		return bs
+	}}
+	i := NewHealthTestedInput(&stuckInput{NewOSRandomInput(), 8192},
+		HealthConfig{MinEntropy: 1, SampleBits: 8, OnFailure: HealthFailFallback, Fallback: fallback})
+	i.GetBits(10000)
+	if !i.Failed() {
+		t.Error("HealthTestedInput did not switch to its fallback on a stuck source")
+	}
+	if !i.GetBits(8).At(0) {
+		t.Error("HealthTestedInput did not use its fallback after failing")
+	}
+}
@@ -0,0 +1,158 @@
+package random
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"time"
+)
+
+const (
+	defaultJitterOSR      = 3         // Oversampling rate, number of time deltas collected per bit of output
+	jitterMemorySize      = 64 * 1024 // Size of the buffer walked by the memory access loop, larger than most L1 caches
+	jitterMemoryAccesses  = 128       // Number of memory locations touched per sample
+	jitterStartupSamples  = 1024      // Number of samples tested when the input is created
+	jitterHealthAlpha     = 30        // False positive rate of the health tests is 2^-jitterHealthAlpha
+	jitterAPTWindow       = 512       // Window size of the adaptive proportion test
+	jitterMaxStuckStartup = 90        // Percentage of stuck samples at startup above which the timer is rejected
+)
+
+// Timer origin, deltas are measured against the monotonic clock
+var jitterEpoch = time.Now()
+
+// CPU execution time jitter entropy source, in the spirit of jitterentropy-rng. Each sample is the time taken by a
+// memory-access loop followed by a loop with data dependent branches, and the variation in these timings caused by
+// caches, pipelines and interrupts is the source of entropy.
+type JitterInput struct {
+	osr       int
+	memory    []byte
+	index     int    // Current position of the memory access loop
+	pool      uint64 // State of the branch heavy loop, hashed into each block along with the deltas
+	prevTime  int64
+	prevDelta int64
+	prevDelt2 int64
+	rct       *RepetitionCountTest
+	apt       *AdaptiveProportionTest
+	buffer    *bitstring.BitString // Conditioned output not yet returned
+}
+
+// Builds a new jitter entropy input, collecting [osr] time deltas per output bit. Panics if the timer does not
+// appear to provide enough resolution, or the startup health tests fail
+func NewJitterInput(osr int) *JitterInput {
+	if osr <= 0 {
+		osr = defaultJitterOSR
+	}
+
+	// Each non-stuck delta is credited with 1/osr bits of min-entropy
+	h := 1.0 / float64(osr)
+	j := &JitterInput{
+		osr:    osr,
+		memory: make([]byte, jitterMemorySize),
+		rct:    NewRepetitionCountTest(h, jitterHealthAlpha),
+		apt:    NewAdaptiveProportionTest(jitterAPTWindow, h, jitterHealthAlpha),
+		buffer: bitstring.NewBitString(),
+	}
+	j.prevTime = j.now()
+
+	// Startup tests, ensuring the timer moves between samples and the health tests pass
+	stuck := 0
+	for i := 0; i < jitterStartupSamples; i++ {
+		if _, ok := j.sample(); !ok {
+			stuck++
+		}
+	}
+	if stuck*100 > jitterStartupSamples*jitterMaxStuckStartup {
+		panic(fmt.Sprintf("JitterInput: timer too coarse, %d of %d startup samples were stuck", stuck,
+			jitterStartupSamples))
+	}
+	return j
+}
+
+// Each 256 bit block is conditioned from 256*osr deltas credited with 1/osr bits each, so is full entropy
+func (j *JitterInput) EntropyBound(n int) EntropyBound {
+	return rateBound(1, n)
+}
+
+// Fetches n bits, each block of 256 bits being the SHA-256 of 256*osr non-stuck time deltas and the pool. Only the
+// deltas are credited with entropy
+func (j *JitterInput) GetBits(n int) *bitstring.BitString {
+	if n <= 0 {
+		panic("JitterInput.GetBits(n) requires n > 0")
+	}
+
+	for j.buffer.Length < n {
+		hash := sha256.New()
+		var b [8]byte
+		for collected := 0; collected < sha256.Size*8*j.osr; {
+			delta, ok := j.sample()
+			if ok {
+				binary.LittleEndian.PutUint64(b[:], uint64(delta))
+				hash.Write(b[:])
+				collected++
+			}
+		}
+		binary.LittleEndian.PutUint64(b[:], j.pool)
+		hash.Write(b[:])
+		sum := hash.Sum(nil)
+		bs, _ := bitstring.BitStringFromBytes(&sum)
+		j.buffer = j.buffer.Extend(bs)
+	}
+
+	bs := j.buffer.First(n)
+	j.buffer = j.buffer.Substring(n, j.buffer.Length-n)
+	return bs
+}
+
+func (j *JitterInput) now() int64 {
+	return time.Since(jitterEpoch).Nanoseconds()
+}
+
+// Takes one timing sample, returning the time delta and whether it is usable (not stuck). Panics when the
+// continuous health tests fail
+func (j *JitterInput) sample() (int64, bool) {
+	j.memoryAccess()
+	j.branchLoop()
+
+	t := j.now()
+	delta := t - j.prevTime
+	delt2 := delta - j.prevDelta
+	delt3 := delt2 - j.prevDelt2
+	j.prevTime, j.prevDelta, j.prevDelt2 = t, delta, delt2
+
+	// Run the health tests over the raw delta
+	if !j.rct.Test(int(delta)) || !j.apt.Test(int(delta&0xFF)) {
+		panic("JitterInput: continuous health test failure")
+	}
+
+	// A delta is stuck if it, or its first or second derivative, is zero
+	return delta, delta != 0 && delt2 != 0 && delt3 != 0
+}
+
+// Walks the memory buffer, reading and writing locations spread beyond a single cache line
+func (j *JitterInput) memoryAccess() {
+	for i := 0; i < jitterMemoryAccesses; i++ {
+		j.memory[j.index]++
+		j.index = (j.index + 127 + int(j.memory[j.index])) % jitterMemorySize
+	}
+}
+
+// Folds the current time into the pool with an LFSR, where both the number of iterations and the branches taken
+// depend on the data
+func (j *JitterInput) branchLoop() {
+	t := uint64(j.now())
+	rounds := 1 + int(t&0xF)
+	for r := 0; r < rounds; r++ {
+		for i := uint(0); i < 64; i++ {
+			bit := (t >> i) & 1
+			if j.pool&1 == 1 {
+				j.pool = (j.pool >> 1) ^ 0xD800000000000000
+			} else {
+				j.pool >>= 1
+			}
+			if bit == 1 {
+				j.pool ^= 1 << 63
+			}
+		}
+	}
+}
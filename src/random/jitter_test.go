@@ -0,0 +1,19 @@
+package random
+
+import "testing"
+
+func TestJitterInput(t *testing.T) {
+	j := NewJitterInput(0)
+	for _, n := range []int{1, 100, 300} {
+		if bs := j.GetBits(n); bs.Length != n {
+			t.Errorf("JitterInput.GetBits(%d) contained %d bits", n, bs.Length)
+		}
+	}
+	if a, b := j.GetBits(64), j.GetBits(64); a.Equals(b) {
+		t.Errorf("JitterInput.GetBits(64) returned %s twice", a)
+	}
+	r := NewGeneratorFromConfig("jitter")
+	if bs := r.GetBits(64); bs.Length != 64 {
+		t.Errorf("NewGeneratorFromConfig(jitter).GetBits(64) contained %d bits", bs.Length)
+	}
+}
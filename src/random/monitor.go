@@ -0,0 +1,238 @@
+/* Continuous statistical monitoring of a running generator, complementing the health tests by applying a few of the
+ * NIST tests to windows of its output
+ */
+
+package random
+
+import (
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"log"
+	"sync"
+)
+
+const (
+	defaultMonitorWindow      = 1 << 16 // Bits in each window tested by a Monitor
+	defaultMonitorThreshold   = 0.001   // P value below which a window is suspect
+	defaultMonitorConsecutive = 3       // Suspect windows in a row before an alarm is raised
+)
+
+// Configuration of a Monitor, zero values are replaced by defaults
+type MonitorConfig struct {
+	SampleRate  float64      // Fraction of windows tested, all of them if zero
+	WindowBits  int          // Bits in each window
+	Threshold   float64      // P value below which a window is suspect
+	Consecutive int          // Suspect windows in a row of the same test that raise an alarm
+	Breaker     bool         // Whether an alarm trips the circuit breaker, refusing all further output until Reset
+	OnAlarm     func(Alarm)  // Called with each alarm, before any output of the failing window could be returned
+	Alarms      chan<- Alarm // Sent each alarm, unless it is full, so a slow reader never holds up output
+	Logger      *log.Logger  // Logs each alarm
+}
+
+// Raised when a test has been suspect over several consecutive windows
+type Alarm struct {
+	Test        string     // Name of the suspect test
+	Window      int        // Index of the window that raised the alarm, counting every window of output
+	Consecutive int        // Number of suspect windows in a row
+	Result      TestResult // Result of the test over the window that raised the alarm
+	Tripped     bool       // Whether the alarm tripped the circuit breaker
+}
+
+func (a Alarm) String() string {
+	s := fmt.Sprintf("monitor: %s suspect over %d windows, P = %f in window %d", a.Test, a.Consecutive, a.Result.P,
+		a.Window)
+	if a.Tripped {
+		s += ", circuit breaker tripped"
+	}
+	return s
+}
+
+// Error reported for requests refused while the circuit breaker is open
+type BreakerError struct {
+	Alarm Alarm // The alarm that tripped the breaker
+}
+
+func (e *BreakerError) Error() string {
+	return "monitor: circuit breaker open after alarm: " + e.Alarm.String()
+}
+
+// Wraps a generator, running the frequency, runs and approximate entropy tests over a sample of the windows of its
+// output. Each test keeps its own count of consecutive suspect windows, so a drifting source raises an alarm while a
+// single unlucky window does not. A Monitor is itself Extractable, so wrapping it in another Generator monitors the
+// typed values that generator produces. The windows follow one another rather than overlapping, and the generator is
+// read a whole window at a time, so no bit is returned until its window has been judged and the window that trips the
+// circuit breaker is never served, at the cost of holding back up to a window of output. It is safe for concurrent use
+type Monitor struct {
+	g       *Generator
+	config  MonitorConfig
+	mu      sync.Mutex
+	ready   []bool  // Bits of windows already judged, not yet returned
+	window  int     // Index of the next window
+	suspect []int   // Consecutive suspect windows of each test
+	tested  int     // Number of windows tested
+	alarms  int     // Number of alarms raised
+	tripped *Alarm  // The alarm that tripped the breaker, if it is open
+	pending []Alarm // Alarms to raise once the lock is released
+}
+
+// Builds a monitor over the output of [g]
+func NewMonitor(g *Generator, config MonitorConfig) *Monitor {
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		panic("NewMonitor: sample rate must be in [0, 1]")
+	}
+	if config.WindowBits <= 0 {
+		config.WindowBits = defaultMonitorWindow
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = defaultMonitorThreshold
+	}
+	if config.Consecutive <= 0 {
+		config.Consecutive = defaultMonitorConsecutive
+	}
+	return &Monitor{g: g, config: config, suspect: make([]int, len(monitorTests(config.WindowBits)))}
+}
+
+// Accumulators for the tests run over each window of [n] bits
+func monitorTests(n int) []Accumulator {
+	return []Accumulator{NewFrequencyAccumulator(), NewRunsAccumulator(),
+		NewApproximateEntropyAccumulator(approximateEntropyBlockLength(n))}
+}
+
+// Gets bits from the generator, panicking with a *BreakerError if the circuit breaker is open
+func (m *Monitor) GetBits(n int) *bitstring.BitString {
+	bs, err := m.TryGetBits(n)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+// Gets bits from the generator, once the windows they fall in have been tested. Returns a *BreakerError instead if
+// the circuit breaker is open, or is tripped by the window these bits fall in, and any error of the generator
+func (m *Monitor) TryGetBits(n int) (*bitstring.BitString, error) {
+	m.mu.Lock()
+	bs, err := m.next(n)
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	// Alarms are raised without the lock held, so handlers may query the monitor
+	for _, a := range pending {
+		m.raise(a)
+	}
+	return bs, err
+}
+
+// Gets [n] bits from windows that have been judged, reading and judging more windows as needed, with the lock held
+func (m *Monitor) next(n int) (*bitstring.BitString, error) {
+	for m.tripped == nil && len(m.ready) < n {
+		bs, err := m.g.TryGetBits(m.config.WindowBits)
+		if err != nil {
+			return nil, err
+		}
+		if m.judge(bs) {
+			m.ready = append(m.ready, bs.Data...)
+		}
+	}
+	if m.tripped != nil {
+		return nil, &BreakerError{*m.tripped}
+	}
+	bs := bitstring.BitStringOfLength(n)
+	copy(bs.Data, m.ready)
+	m.ready = m.ready[n:]
+	return bs, nil
+}
+
+// Reports whether window [w] is tested, so that the windows tested are spread evenly at the sample rate
+func (m *Monitor) sampled(w int) bool {
+	rate := m.config.SampleRate
+	return int(float64(w+1)*rate) > int(float64(w)*rate)
+}
+
+// Judges the next window [bs] if it is sampled, raising an alarm for each test suspect for too long. Reports whether
+// the window may be returned, which it may not if it tripped the breaker
+func (m *Monitor) judge(bs *bitstring.BitString) bool {
+	w := m.window
+	m.window++
+	if !m.sampled(w) {
+		return true
+	}
+	m.tested++
+	for i, a := range monitorTests(m.config.WindowBits) {
+		a.Update(bs)
+		r := a.Finalize()[0]
+		switch {
+		case r.Status == StatusInconclusive:
+			continue
+		case r.P >= m.config.Threshold:
+			m.suspect[i] = 0
+			continue
+		}
+		m.suspect[i]++
+		if m.suspect[i] >= m.config.Consecutive {
+			m.alarm(Alarm{Test: r.Name, Window: w, Consecutive: m.suspect[i], Result: r})
+			m.suspect[i] = 0
+		}
+	}
+	return m.tripped == nil
+}
+
+// Records [a], tripping the breaker if configured
+func (m *Monitor) alarm(a Alarm) {
+	m.alarms++
+	if m.config.Breaker && m.tripped == nil {
+		a.Tripped = true
+		m.tripped = &a
+	}
+	m.pending = append(m.pending, a)
+}
+
+// Raises [a] through every configured channel
+func (m *Monitor) raise(a Alarm) {
+	if m.config.OnAlarm != nil {
+		m.config.OnAlarm(a)
+	}
+	if m.config.Alarms != nil {
+		select {
+		case m.config.Alarms <- a:
+		default:
+		}
+	}
+	if m.config.Logger != nil {
+		m.config.Logger.Println(a)
+	}
+}
+
+// Reports whether the circuit breaker is open
+func (m *Monitor) Tripped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tripped != nil
+}
+
+// Closes the circuit breaker, resuming output, and clears the counts of suspect windows
+func (m *Monitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tripped = nil
+	for i := range m.suspect {
+		m.suspect[i] = 0
+	}
+}
+
+// Number of windows tested so far
+func (m *Monitor) Windows() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tested
+}
+
+// Number of alarms raised so far
+func (m *Monitor) Alarms() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.alarms
+}
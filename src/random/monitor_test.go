@@ -0,0 +1,74 @@
+package random
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	// A healthy source raises no alarms, however its output is requested, reading whole windows at a time
+	m := NewMonitor(NewGeneratorFromExtractable(NewPseudoRandomExtractor(5)), MonitorConfig{WindowBits: 4096})
+	for _, n := range []int{1, 4095, 10000, 50000, 17} {
+		if got := m.GetBits(n); got.Length != n {
+			t.Errorf("Monitor.GetBits(%d) returned %d bits", n, got.Length)
+		}
+	}
+	if m.Windows() != 16 || m.Alarms() != 0 || m.Tripped() {
+		t.Errorf("Monitor over a healthy source tested %d windows raising %d alarms, want 16 and 0", m.Windows(),
+			m.Alarms())
+	}
+
+	// Only every other window is tested at a sample rate of a half
+	m = NewMonitor(NewGeneratorFromExtractable(NewPseudoRandomExtractor(5)), MonitorConfig{WindowBits: 4096,
+		SampleRate: 0.5})
+	m.GetBits(10 * 4096)
+	if m.Windows() != 5 {
+		t.Errorf("Monitor at sample rate 0.5 tested %d of 10 windows, want 5", m.Windows())
+	}
+}
+
+func TestMonitorAlarm(t *testing.T) {
+	// The source gets stuck after two windows, so the third suspect window raises alarms and trips the breaker
+	var called []Alarm
+	alarms := make(chan Alarm, 1)
+	var logged bytes.Buffer
+	m := NewMonitor(NewGeneratorFromExtractable(&stuckInput{NewPseudoRandomExtractor(5), 2 * 4096}), MonitorConfig{
+		WindowBits: 4096, Breaker: true, Alarms: alarms, Logger: log.New(&logged, "", 0),
+		OnAlarm: func(a Alarm) { called = append(called, a) },
+	})
+	// Output is held back until its window is judged, so none of the window raising the alarm is served
+	served := 0
+	for ; served < 5*4096; served += 1000 {
+		if _, err := m.TryGetBits(1000); err != nil {
+			break
+		}
+	}
+	if served != 16000 || !m.Tripped() {
+		t.Fatalf("Monitor served %d bits before tripping, want the 16000 falling within the first 4 windows", served)
+	}
+	if _, err := m.TryGetBits(1); err == nil {
+		t.Errorf("Monitor served output with the breaker open")
+	} else if _, ok := err.(*BreakerError); !ok {
+		t.Errorf("Monitor refused output with %T, want *BreakerError", err)
+	}
+
+	// Every failing test is reported through the callback and log, while the full channel drops the later alarms
+	if len(called) != 3 || called[0].Test != "Frequency" || called[0].Window != 4 || called[0].Consecutive != 3 ||
+		!called[0].Tripped || called[1].Tripped {
+		t.Errorf("Monitor called back with %v, want alarms for the three tests in window 4", called)
+	}
+	if a := <-alarms; a.Test != "Frequency" {
+		t.Errorf("Monitor sent alarm %v, want the frequency test", a)
+	}
+	if got := strings.Count(logged.String(), "\n"); got != 3 {
+		t.Errorf("Monitor logged %d alarms, want 3", got)
+	}
+
+	m.Reset()
+	if m.Tripped() {
+		t.Errorf("Monitor.Reset() left the breaker open")
+	}
+	m.GetBits(4096)
+}
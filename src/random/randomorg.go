@@ -0,0 +1,323 @@
+package random
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	RandomOrgURL          = "https://api.random.org/json-rpc/4/invoke"
+	RandomOrgKeyEnv       = "RANDOM_ORG_API_KEY" // Environment variable holding the API key when none is configured
+	defaultRandomOrgBatch = 8192                 // Number of bits requested per API call
+	defaultRandomOrgRetry = 4
+	defaultRandomOrgWait  = 500 * time.Millisecond
+	randomOrgIntegerBits  = 16 // generateIntegers requests values in [0, 2^16)
+)
+
+var (
+	ErrRandomOrgQuota     = errors.New("randomorg: bit quota exhausted")
+	ErrRandomOrgSignature = errors.New("randomorg: response signature verification failed")
+)
+
+// Configuration of a RandomOrgSource, zero values are replaced by defaults
+type RandomOrgConfig struct {
+	APIKey     string         // Defaults to the value of $RANDOM_ORG_API_KEY
+	URL        string         // JSON-RPC endpoint, defaults to RandomOrgURL
+	Method     string         // One of "generateBlobs", "generateIntegers" or "generateSignedBlobs"
+	BatchBits  int            // Bits requested per call, fewer once the quota runs low
+	MaxRetries int            // Attempts made after a transport or server error before giving up
+	Backoff    time.Duration  // Initial wait between retries, doubled after each failure
+	PublicKey  *rsa.PublicKey // Key used to verify signed responses, required for "generateSignedBlobs"
+	Client     *http.Client
+}
+
+// JSON-RPC error returned by the API
+type RandomOrgError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RandomOrgError) Error() string {
+	return fmt.Sprintf("randomorg: error %d: %s", e.Code, e.Message)
+}
+
+type randomOrgRequest struct {
+	JsonRPC string                 `json:"jsonrpc"`
+	Method  string                 `json:"method"`
+	Params  map[string]interface{} `json:"params"`
+	Id      int                    `json:"id"`
+}
+
+type randomOrgResponse struct {
+	Error  *RandomOrgError `json:"error"`
+	Result *struct {
+		Random        json.RawMessage `json:"random"`
+		Signature     string          `json:"signature"`
+		BitsLeft      int             `json:"bitsLeft"`
+		RequestsLeft  int             `json:"requestsLeft"`
+		AdvisoryDelay int             `json:"advisoryDelay"`
+	} `json:"result"`
+}
+
+type randomOrgData struct {
+	Data []json.RawMessage `json:"data"`
+}
+
+// Input fetching true random bits from the random.org JSON-RPC API
+type RandomOrgSource struct {
+	config      RandomOrgConfig
+	buffer      []byte
+	id          int
+	bitsLeft    int       // Quota reported by the last response, -1 if unknown
+	nextRequest time.Time // Earliest time the next request may be sent, as advised by the server
+}
+
+// Builds a new random.org input from [config], taking the API key from the environment if it is not given
+func NewRandomOrgSource(config RandomOrgConfig) *RandomOrgSource {
+	if config.APIKey == "" {
+		config.APIKey = os.Getenv(RandomOrgKeyEnv)
+	}
+	if config.APIKey == "" {
+		panic("RandomOrgSource: no API key configured and $" + RandomOrgKeyEnv + " is not set")
+	}
+	if config.URL == "" {
+		config.URL = RandomOrgURL
+	}
+	if config.Method == "" {
+		config.Method = "generateBlobs"
+	}
+	switch config.Method {
+	case "generateBlobs", "generateIntegers":
+	case "generateSignedBlobs":
+		if config.PublicKey == nil {
+			panic("RandomOrgSource: generateSignedBlobs requires a public key")
+		}
+	default:
+		panic(fmt.Sprintf("RandomOrgSource: unsupported method '%s'", config.Method))
+	}
+	if config.BatchBits <= 0 {
+		config.BatchBits = defaultRandomOrgBatch
+	}
+	// Blob sizes must be a whole number of bytes
+	config.BatchBits = ((config.BatchBits-1)/8 + 1) * 8
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = defaultRandomOrgRetry
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultRandomOrgWait
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &RandomOrgSource{config: config, bitsLeft: -1}
+}
+
+// Reads an RSA public key from the PEM file at [path]
+func LoadRandomOrgPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("randomorg: no PEM data in '%s'", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("randomorg: '%s' does not hold an RSA public key", path)
+	}
+	return rsaKey, nil
+}
+
+// Number of bits remaining in the API key's quota, or -1 before the first request
+func (s *RandomOrgSource) BitsLeft() int {
+	return s.bitsLeft
+}
+
+// random.org's atmospheric noise is trusted to provide full entropy output
+func (s *RandomOrgSource) EntropyBound(n int) EntropyBound {
+	return rateBound(1, n)
+}
+
+// Fetches n bits, requesting new batches from the API as needed. Panics if the API cannot supply them
+func (s *RandomOrgSource) GetBits(n int) *bitstring.BitString {
+	if n <= 0 {
+		panic("RandomOrgSource.GetBits(n) requires n > 0")
+	}
+
+	// round up n bits to closest byte boundary
+	numBytes := ((n - 1) / 8) + 1
+	for len(s.buffer) < numBytes {
+		if err := s.Fetch(); err != nil {
+			panic(fmt.Sprintf("RandomOrgSource.GetBits: %v", err))
+		}
+	}
+
+	bytes := s.buffer[:numBytes]
+	s.buffer = s.buffer[numBytes:]
+	bs, _ := bitstring.BitStringFromBytes(&bytes)
+	return bs.Substring(0, n)
+}
+
+// Requests a single batch of random data from the API and adds it to the buffer, retrying with exponential backoff
+// on transport and server errors. The batch is shrunk to fit the remaining quota
+func (s *RandomOrgSource) Fetch() error {
+	if s.batchBits() == 0 {
+		return ErrRandomOrgQuota
+	}
+
+	var err error
+	wait := s.config.Backoff
+	for attempt := 0; attempt <= s.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+
+		var retry bool
+		retry, err = s.fetch()
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("randomorg: giving up after %d attempts: %v", s.config.MaxRetries+1, err)
+}
+
+// Performs one API call, reporting whether a failure is worth retrying
+func (s *RandomOrgSource) fetch() (bool, error) {
+	// Respect the delay advised by the previous response
+	if wait := time.Until(s.nextRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	s.id++
+	request := &randomOrgRequest{JsonRPC: "2.0", Method: s.config.Method, Params: s.params(), Id: s.id}
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(request)
+
+	resp, err := s.config.Client.Post(s.config.URL, "application/json-rpc", b)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, fmt.Errorf("randomorg: invalid return code: %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("randomorg: invalid return code: %d", resp.StatusCode)
+	}
+
+	var data randomOrgResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return true, fmt.Errorf("randomorg: malformed response: %v", err)
+	}
+	if data.Error != nil {
+		return false, data.Error
+	}
+	if data.Result == nil {
+		return false, errors.New("randomorg: response contains neither a result nor an error")
+	}
+
+	result := data.Result
+	s.bitsLeft = result.BitsLeft
+	s.nextRequest = time.Now().Add(time.Duration(result.AdvisoryDelay) * time.Millisecond)
+
+	if s.config.Method == "generateSignedBlobs" {
+		if err := verifyRandomOrgSignature(s.config.PublicKey, result.Random, result.Signature); err != nil {
+			return false, err
+		}
+	}
+
+	var random randomOrgData
+	if err := json.Unmarshal(result.Random, &random); err != nil {
+		return false, fmt.Errorf("randomorg: malformed random data: %v", err)
+	}
+	return false, s.decode(random.Data)
+}
+
+// Bits requested by the next call, the configured batch or as much of the remaining quota as can be requested, in
+// whole integers or bytes. Zero if the quota is exhausted
+func (s *RandomOrgSource) batchBits() int {
+	unit := 8
+	if s.config.Method == "generateIntegers" {
+		unit = randomOrgIntegerBits
+	}
+	bits := (s.config.BatchBits-1)/unit*unit + unit
+	if s.bitsLeft >= 0 && s.bitsLeft < bits {
+		bits = s.bitsLeft / unit * unit
+	}
+	return bits
+}
+
+// Builds the method parameters for a single batch
+func (s *RandomOrgSource) params() map[string]interface{} {
+	if s.config.Method == "generateIntegers" {
+		return map[string]interface{}{
+			"apiKey": s.config.APIKey,
+			"n":      s.batchBits() / randomOrgIntegerBits,
+			"min":    0,
+			"max":    1<<randomOrgIntegerBits - 1,
+		}
+	}
+	return map[string]interface{}{
+		"apiKey": s.config.APIKey,
+		"n":      1,
+		"size":   s.batchBits(),
+		"format": "base64",
+	}
+}
+
+// Decodes the data array of a response into the buffer
+func (s *RandomOrgSource) decode(data []json.RawMessage) error {
+	for _, datum := range data {
+		if s.config.Method == "generateIntegers" {
+			var v int
+			if err := json.Unmarshal(datum, &v); err != nil {
+				return fmt.Errorf("randomorg: malformed integer: %v", err)
+			}
+			s.buffer = append(s.buffer, byte(v>>8), byte(v))
+			continue
+		}
+
+		var blob string
+		if err := json.Unmarshal(datum, &blob); err != nil {
+			return fmt.Errorf("randomorg: malformed blob: %v", err)
+		}
+		bytes, err := base64.StdEncoding.DecodeString(blob)
+		if err != nil {
+			return fmt.Errorf("randomorg: malformed blob: %v", err)
+		}
+		s.buffer = append(s.buffer, bytes...)
+	}
+	return nil
+}
+
+// Verifies the SHA-512 RSA signature random.org attaches to the serialised random object of a signed response
+func verifyRandomOrgSignature(key *rsa.PublicKey, random json.RawMessage, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrRandomOrgSignature
+	}
+	hash := sha512.Sum512(random)
+	if rsa.VerifyPKCS1v15(key, crypto.SHA512, hash[:], sig) != nil {
+		return ErrRandomOrgSignature
+	}
+	return nil
+}
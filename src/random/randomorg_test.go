@@ -0,0 +1,235 @@
+package random
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRandomOrgSource(t *testing.T) {
+	server := newFakeRandomOrgServer("key")
+	defer server.Close()
+
+	for _, method := range []string{"generateBlobs", "generateIntegers", "generateSignedBlobs"} {
+		s := NewRandomOrgSource(server.Config(method))
+		if bs := s.GetBits(10000); bs.Length != 10000 {
+			t.Errorf("RandomOrgSource(%s).GetBits(10000) contained %d bits", method, bs.Length)
+		}
+		if s.BitsLeft() != server.BitsLeft {
+			t.Errorf("RandomOrgSource(%s).BitsLeft() == %d, wanted %d", method, s.BitsLeft(), server.BitsLeft)
+		}
+	}
+}
+
+func TestRandomOrgSourceRetry(t *testing.T) {
+	server := newFakeRandomOrgServer("key")
+	defer server.Close()
+	server.FailRequests = 2
+
+	config := server.Config("generateBlobs")
+	config.Backoff = time.Millisecond
+	s := NewRandomOrgSource(config)
+	if err := s.Fetch(); err != nil {
+		t.Errorf("RandomOrgSource.Fetch() failed after retrying: %v", err)
+	}
+	if requests := server.requests(); requests != 3 {
+		t.Errorf("RandomOrgSource.Fetch() made %d requests, wanted 3", requests)
+	}
+
+	server.FailRequests = 10
+	if err := s.Fetch(); err == nil {
+		t.Error("RandomOrgSource.Fetch() succeeded against a failing server")
+	}
+}
+
+func TestRandomOrgSourceQuota(t *testing.T) {
+	server := newFakeRandomOrgServer("key")
+	defer server.Close()
+	server.BitsLeft = 3 * defaultRandomOrgBatch / 2
+	server.AdvisoryDelay = 20
+
+	// The second batch is shrunk to the half batch left, after which the quota is exhausted
+	s := NewRandomOrgSource(server.Config("generateBlobs"))
+	if err := s.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if bs := s.GetBits(3 * defaultRandomOrgBatch / 2); bs.Length != 3*defaultRandomOrgBatch/2 {
+		t.Errorf("RandomOrgSource.GetBits() returned %d bits, wanted %d", bs.Length, 3*defaultRandomOrgBatch/2)
+	}
+	if err := s.Fetch(); err != ErrRandomOrgQuota {
+		t.Errorf("RandomOrgSource.Fetch() == %v, wanted ErrRandomOrgQuota", err)
+	}
+	if requests := server.requests(); requests != 2 {
+		t.Errorf("RandomOrgSource made %d requests, wanted 2 and none with the quota exhausted", requests)
+	}
+
+	server.BitsLeft = 250000
+	s = NewRandomOrgSource(server.Config("generateBlobs"))
+	s.Fetch()
+	s.Fetch()
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("RandomOrgSource ignored the advisory delay")
+	}
+}
+
+func TestRandomOrgSourceSignature(t *testing.T) {
+	server := newFakeRandomOrgServer("key")
+	defer server.Close()
+	other := newFakeRandomOrgServer("key")
+	defer other.Close()
+
+	config := server.Config("generateSignedBlobs")
+	config.PublicKey = other.PublicKey()
+	s := NewRandomOrgSource(config)
+	if err := s.Fetch(); err != ErrRandomOrgSignature {
+		t.Errorf("RandomOrgSource.Fetch() with the wrong key == %v, wanted ErrRandomOrgSignature", err)
+	}
+
+	config.APIKey = "wrong"
+	config.PublicKey = server.PublicKey()
+	s = NewRandomOrgSource(config)
+	if err, ok := s.Fetch().(*RandomOrgError); !ok {
+		t.Errorf("RandomOrgSource.Fetch() with an invalid key == %v, wanted a RandomOrgError", err)
+	}
+}
+
+// Offline stand-in for the random.org JSON-RPC API, serving generateBlobs, generateIntegers and generateSignedBlobs
+// requests from a local reader so RandomOrgSource can be tested without network access
+type fakeRandomOrgServer struct {
+	*httptest.Server
+	APIKey        string
+	BitsLeft      int       // Remaining quota, decremented by each request
+	AdvisoryDelay int       // Delay in milliseconds advised in each response
+	FailRequests  int       // Number of upcoming requests answered with 503 Service Unavailable
+	Source        io.Reader // Source of the served random data, crypto/rand by default
+	Requests      int       // Number of requests received so far
+	key           *rsa.PrivateKey
+	mu            sync.Mutex
+}
+
+// Starts a fake random.org server accepting [apiKey]
+func newFakeRandomOrgServer(apiKey string) *fakeRandomOrgServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("fakeRandomOrgServer: could not generate signing key")
+	}
+	s := &fakeRandomOrgServer{APIKey: apiKey, BitsLeft: 250000, Source: rand.Reader, key: key}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Number of requests received so far
+func (s *fakeRandomOrgServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Requests
+}
+
+// The public key matching signatures on generateSignedBlobs responses
+func (s *fakeRandomOrgServer) PublicKey() *rsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+// A config pointing a RandomOrgSource at this server
+func (s *fakeRandomOrgServer) Config(method string) RandomOrgConfig {
+	return RandomOrgConfig{APIKey: s.APIKey, URL: s.URL, Method: method, PublicKey: s.PublicKey()}
+}
+
+func (s *fakeRandomOrgServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Requests++
+	if s.FailRequests > 0 {
+		s.FailRequests--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var request struct {
+		Method string `json:"method"`
+		Params struct {
+			ApiKey string `json:"apiKey"`
+			N      int    `json:"n"`
+			Size   int    `json:"size"`
+			Min    int    `json:"min"`
+			Max    int    `json:"max"`
+		} `json:"params"`
+		Id int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.reply(w, request.Id, nil, &RandomOrgError{-32700, "Parse error"})
+		return
+	}
+	params := request.Params
+	if params.ApiKey != s.APIKey {
+		s.reply(w, request.Id, nil, &RandomOrgError{400, "The API key you specified does not exist"})
+		return
+	}
+
+	// Build the random data for each supported method
+	var data []interface{}
+	var bits int
+	switch request.Method {
+	case "generateBlobs", "generateSignedBlobs":
+		for i := 0; i < params.N; i++ {
+			blob := make([]byte, params.Size/8)
+			io.ReadFull(s.Source, blob)
+			data = append(data, base64.StdEncoding.EncodeToString(blob))
+		}
+		bits = params.N * params.Size
+	case "generateIntegers":
+		span := params.Max - params.Min + 1
+		for i := 0; i < params.N; i++ {
+			b := make([]byte, 4)
+			io.ReadFull(s.Source, b)
+			v := int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+			data = append(data, params.Min+v%span)
+		}
+		bits = params.N * randomOrgIntegerBits
+	default:
+		s.reply(w, request.Id, nil, &RandomOrgError{-32601, "Method not found"})
+		return
+	}
+	if bits > s.BitsLeft {
+		s.reply(w, request.Id, nil, &RandomOrgError{403, "The API key you specified has run out of bits"})
+		return
+	}
+	s.BitsLeft -= bits
+
+	random, _ := json.Marshal(map[string]interface{}{"method": request.Method, "data": data})
+	result := map[string]interface{}{
+		"random":        json.RawMessage(random),
+		"bitsUsed":      bits,
+		"bitsLeft":      s.BitsLeft,
+		"requestsLeft":  1000,
+		"advisoryDelay": s.AdvisoryDelay,
+	}
+	if request.Method == "generateSignedBlobs" {
+		hash := sha512.Sum512(random)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA512, hash[:])
+		result["signature"] = base64.StdEncoding.EncodeToString(sig)
+	}
+	s.reply(w, request.Id, result, nil)
+}
+
+func (s *fakeRandomOrgServer) reply(w http.ResponseWriter, id int, result interface{}, err *RandomOrgError) {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		response["error"] = err
+	} else {
+		response["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,225 @@
+package random
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const DefaultSignificance float64 = 0.01 // Level every P value must reach unless a check is configured otherwise
+
+// Outcome of a single test
+type TestStatus int
+
+const (
+	StatusPass         TestStatus = iota
+	StatusFail                    // Some P value fell below the significance level
+	StatusInconclusive            // The input is outside the spec's recommendations, so the P values are not meaningful
+)
+
+var statusNames = []string{"pass", "fail", "inconclusive"}
+
+func (s TestStatus) String() string {
+	return statusNames[s]
+}
+
+func (s TestStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// A named value reported by a test, such as one of its P values, statistics or parameters
+type Value struct {
+	Name  string
+	Value float64
+}
+
+// Encodes the value as an object, writing non-finite values, which JSON cannot represent, as null
+func (v Value) MarshalJSON() ([]byte, error) {
+	var value interface{} = v.Value
+	if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+		value = nil
+	}
+	return json.Marshal(struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}{v.Name, value})
+}
+
+// The single P value of a test defining only one
+func pValue(p float64) Value {
+	return Value{"P", p}
+}
+
+// Result of a statistical test over a sequence. Tests always report every P value they define, as zero when the
+// input was too short to compute it
+type TestResult struct {
+	Name         string     `json:"name"`
+	P            float64    `json:"p"`       // Smallest of PValues
+	PValues      []Value    `json:"pValues"` // Every P value the test defines
+	Statistics   []Value    `json:"statistics,omitempty"`
+	Parameters   []Value    `json:"parameters,omitempty"`
+	SampleSize   int        `json:"sampleSize"` // Number of bits tested
+	Significance float64    `json:"significance"`
+	Result       bool       `json:"passed"` // Whether every P value reached the significance level
+	Status       TestStatus `json:"status"`
+	Reason       string     `json:"reason,omitempty"` // Why the result is inconclusive, if it is
+}
+
+// Builds the result of a test over [n] bits giving P values [ps], judged at the default significance level. A P
+// value that could not be computed is reported as zero
+func newResult(name string, n int, ps ...Value) TestResult {
+	pvalues := make([]Value, len(ps))
+	for i, p := range ps {
+		if math.IsNaN(p.Value) {
+			p.Value = 0
+		}
+		pvalues[i] = p
+	}
+	return TestResult{Name: name, PValues: pvalues, SampleSize: n}.WithSignificance(DefaultSignificance)
+}
+
+// Judges [r] again at significance level [alpha]
+func (r TestResult) WithSignificance(alpha float64) TestResult {
+	r.Significance = alpha
+	r.P = 0
+	r.Result = len(r.PValues) > 0
+	for i, p := range r.PValues {
+		if i == 0 || p.Value < r.P {
+			r.P = p.Value
+		}
+		r.Result = r.Result && p.Value >= alpha
+	}
+	switch {
+	case r.Reason != "":
+		r.Status = StatusInconclusive
+	case r.Result:
+		r.Status = StatusPass
+	default:
+		r.Status = StatusFail
+	}
+	return r
+}
+
+// Marks [r] as inconclusive, explaining why
+func (r TestResult) insufficient(format string, args ...interface{}) TestResult {
+	r.Status = StatusInconclusive
+	r.Reason = fmt.Sprintf(format, args...)
+	return r
+}
+
+func (r TestResult) withParameters(vs ...Value) TestResult {
+	r.Parameters = append(r.Parameters, vs...)
+	return r
+}
+
+func (r TestResult) withStatistics(vs ...Value) TestResult {
+	r.Statistics = append(r.Statistics, vs...)
+	return r
+}
+
+// Splits a result with several P values into one result per P value, named after both the test and the P value, so
+// that each can be summarised separately as NIST's assess does
+func (r TestResult) perPValue() []TestResult {
+	if len(r.PValues) <= 1 {
+		return []TestResult{r}
+	}
+	results := make([]TestResult, len(r.PValues))
+	for i, p := range r.PValues {
+		s := r
+		s.Name = fmt.Sprintf("%s (%s)", r.Name, p.Name)
+		s.PValues = []Value{p}
+		results[i] = s.WithSignificance(r.Significance)
+	}
+	return results
+}
+
+// Writes [results] to [w] as an indented JSON array
+func WriteJSON(w io.Writer, results []TestResult) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(results)
+}
+
+// Writes [results] to [w] as CSV with a header row, giving each P value a row of its own
+func WriteCSV(w io.Writer, results []TestResult) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"test", "p", "status", "significance", "sampleSize", "parameters", "statistics", "reason"})
+	for _, result := range results {
+		for _, r := range result.perPValue() {
+			c.Write([]string{r.Name, formatFloat(r.P), r.Status.String(), formatFloat(r.Significance),
+				strconv.Itoa(r.SampleSize), formatValues(r.Parameters), formatValues(r.Statistics), r.Reason})
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// Writes [results] to [w] as a JUnit XML test suite named [suite], where failing tests are failures and
+// inconclusive tests are skipped
+func WriteJUnit(w io.Writer, suite string, results []TestResult) error {
+	s := junitSuite{Name: suite, Tests: len(results)}
+	for _, r := range results {
+		c := junitCase{Name: r.Name, Classname: suite, SystemOut: fmt.Sprintf("P values: %s\nparameters: %s",
+			formatValues(r.PValues), formatValues(r.Parameters))}
+		switch r.Status {
+		case StatusFail:
+			s.Failures++
+			c.Failure = &junitMessage{fmt.Sprintf("P = %s is below the significance level %s", formatFloat(r.P),
+				formatFloat(r.Significance))}
+		case StatusInconclusive:
+			s.Skipped++
+			c.Skipped = &junitMessage{r.Reason}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Formats [vs] as name=value pairs separated by semicolons
+func formatValues(vs []Value) string {
+	pairs := make([]string, len(vs))
+	for i, v := range vs {
+		pairs[i] = v.Name + "=" + formatFloat(v.Value)
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,92 @@
+package random
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+)
+
+// A passing, failing and inconclusive result, the first with two P values
+func sampleResults() []TestResult {
+	return []TestResult{
+		newResult("Serial", 1000, Value{"P1", 0.5}, Value{"P2", 0.2}).withParameters(Value{"m", 4}),
+		newResult("Frequency", 1000, pValue(0.001)).withStatistics(Value{"s_obs", math.Inf(1)}),
+		newResult("Linear Complexity", 1000, pValue(0.3)).insufficient("too short"),
+	}
+}
+
+func TestWithSignificance(t *testing.T) {
+	r := newResult("Serial", 1000, Value{"P1", 0.5}, Value{"P2", 0.02})
+	if r.P != 0.02 || r.Status != StatusPass {
+		t.Errorf("result has P %f, status %s, want 0.02, pass", r.P, r.Status)
+	}
+	if r = r.WithSignificance(0.05); r.Result || r.Status != StatusFail {
+		t.Errorf("result at significance 0.05 has status %s, want fail", r.Status)
+	}
+	if r = r.insufficient("too short").WithSignificance(0.01); r.Status != StatusInconclusive {
+		t.Errorf("inconclusive result has status %s after WithSignificance", r.Status)
+	}
+	if got := newResult("NaN", 10, pValue(math.NaN())); got.P != 0 || got.Status != StatusFail {
+		t.Errorf("result with NaN P value has P %f, status %s, want 0, fail", got.P, got.Status)
+	}
+
+	split := newResult("Serial", 1000, Value{"P1", 0.5}, Value{"P2", 0.001}).perPValue()
+	if len(split) != 2 || split[0].Name != "Serial (P1)" || split[0].Status != StatusPass ||
+		split[1].Status != StatusFail {
+		t.Errorf("perPValue() == %+v, want a passing Serial (P1) and failing Serial (P2)", split)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	b := new(bytes.Buffer)
+	if err := WriteJSON(b, sampleResults()); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON wrote invalid JSON: %v\n%s", err, b)
+	}
+	if len(decoded) != 3 || decoded[0]["status"] != "pass" || decoded[1]["status"] != "fail" ||
+		decoded[2]["reason"] != "too short" {
+		t.Errorf("WriteJSON wrote unexpected results:\n%s", b)
+	}
+	if !strings.Contains(b.String(), `"value": null`) {
+		t.Errorf("WriteJSON did not encode an infinite statistic as null:\n%s", b)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	b := new(bytes.Buffer)
+	if err := WriteCSV(b, sampleResults()); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := []string{
+		"test,p,status,significance,sampleSize,parameters,statistics,reason",
+		"Serial (P1),0.5,pass,0.01,1000,m=4,,",
+		"Serial (P2),0.2,pass,0.01,1000,m=4,,",
+		"Frequency,0.001,fail,0.01,1000,,s_obs=+Inf,",
+		"Linear Complexity,0.3,inconclusive,0.01,1000,,,too short",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("WriteCSV wrote:\n%s\nwant:\n%s", b, strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	b := new(bytes.Buffer)
+	if err := WriteJUnit(b, "nist", sampleResults()); err != nil {
+		t.Fatalf("WriteJUnit failed: %v", err)
+	}
+	var suite junitSuite
+	if err := xml.Unmarshal(b.Bytes(), &suite); err != nil {
+		t.Fatalf("WriteJUnit wrote invalid XML: %v\n%s", err, b)
+	}
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 || suite.Cases[1].Failure == nil ||
+		suite.Cases[2].Skipped == nil || suite.Cases[2].Skipped.Message != "too short" {
+		t.Errorf("WriteJUnit wrote unexpected suite:\n%s", b)
+	}
+}
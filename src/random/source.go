@@ -0,0 +1,190 @@
+package random
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/adamhosier/random/src/bitstring"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Policy for a FileInput when the end of the file is reached
+type EOFPolicy int
+
+const (
+	EOFFail   EOFPolicy = iota // Panic when the file has been exhausted
+	EOFRewind                  // Seek back to the start of the file and keep reading (replay)
+	EOFReopen                  // Close and reopen the file, blocking until a new writer appears (named pipes)
+)
+
+const defaultSocketTimeout = 10 * time.Second
+
+// Builds a BitString of length [n] from [r], reading whole bytes and discarding the extra bits
+func readBits(r io.Reader, n int) *bitstring.BitString {
+	if n <= 0 {
+		panic("readBits(n) requires n > 0")
+	}
+
+	// round up n bits to closest byte boundary
+	bytes := make([]byte, ((n-1)/8)+1)
+	if _, err := io.ReadFull(r, bytes); err != nil {
+		panic(fmt.Sprintf("readBits: could not read %d bytes: %v", len(bytes), err))
+	}
+	bs, _ := bitstring.BitStringFromBytes(&bytes)
+
+	// discard extra bits
+	return bs.Substring(0, n)
+}
+
+// Input reading bits from any io.Reader
+type ReaderInput struct {
+	r io.Reader
+}
+
+// Builds a new input reading from [r]
+func NewReaderInput(r io.Reader) *ReaderInput {
+	return &ReaderInput{r}
+}
+
+// Fetches n bits from the reader, panicking if the reader cannot supply them
+func (i *ReaderInput) GetBits(n int) *bitstring.BitString {
+	return readBits(i.r, n)
+}
+
+// Input reading bits from a file, named pipe or character device
+type FileInput struct {
+	path   string
+	policy EOFPolicy
+	file   *os.File
+}
+
+// Builds a new input reading from the file at [path], applying [policy] once the file is exhausted
+func NewFileInput(path string, policy EOFPolicy) *FileInput {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("FileInput: could not open '%s': %v\n", path, err))
+	}
+	return &FileInput{path, policy, file}
+}
+
+// Builds a new input reading from a named pipe at [path]. Each time the writer closes the pipe it is reopened, so
+// the input blocks until the next writer connects
+func NewPipeInput(path string) *FileInput {
+	return NewFileInput(path, EOFReopen)
+}
+
+// Builds a new input reading from a character device such as /dev/urandom or /dev/hwrng
+func NewDeviceInput(path string) *FileInput {
+	info, err := os.Stat(path)
+	if err != nil {
+		panic(fmt.Sprintf("DeviceInput: device not found '%s'\n", path))
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		panic(fmt.Sprintf("DeviceInput: '%s' is not a character device\n", path))
+	}
+	return NewFileInput(path, EOFFail)
+}
+
+// Implements io.Reader, handling the end of the file according to the input's EOF policy
+func (i *FileInput) Read(p []byte) (int, error) {
+	for {
+		n, err := i.file.Read(p)
+		if err != io.EOF || n > 0 {
+			return n, err
+		}
+
+		switch i.policy {
+		case EOFRewind:
+			if _, err := i.file.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			// An empty file can never be rewound into data
+			if info, err := i.file.Stat(); err != nil || info.Size() == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+		case EOFReopen:
+			i.file.Close()
+			file, err := os.Open(i.path)
+			if err != nil {
+				return 0, err
+			}
+			i.file = file
+		default:
+			return 0, io.EOF
+		}
+	}
+}
+
+// Fetches n bits from the file
+func (i *FileInput) GetBits(n int) *bitstring.BitString {
+	return readBits(i, n)
+}
+
+// Closes the underlying file
+func (i *FileInput) Close() error {
+	return i.file.Close()
+}
+
+// Input reading bits from a stream socket (e.g. "tcp" or "unix")
+type SocketInput struct {
+	network string
+	address string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+// Builds a new input reading from the socket at [address] on [network], connecting immediately
+func NewSocketInput(network, address string) *SocketInput {
+	i := &SocketInput{network, address, defaultSocketTimeout, nil}
+	if err := i.connect(); err != nil {
+		panic(fmt.Sprintf("SocketInput: could not connect to %s '%s': %v\n", network, address, err))
+	}
+	return i
+}
+
+// (Re)establishes the connection to the remote end
+func (i *SocketInput) connect() error {
+	if i.conn != nil {
+		i.conn.Close()
+	}
+	conn, err := net.DialTimeout(i.network, i.address, i.timeout)
+	if err != nil {
+		return err
+	}
+	i.conn = conn
+	return nil
+}
+
+// Fetches n bits from the socket, reconnecting once if the remote end has closed the connection
+func (i *SocketInput) GetBits(n int) *bitstring.BitString {
+	bytes := make([]byte, ((n-1)/8)+1)
+	if _, err := io.ReadFull(i.conn, bytes); err != nil {
+		if err := i.connect(); err != nil {
+			panic(fmt.Sprintf("SocketInput: lost connection to '%s': %v", i.address, err))
+		}
+		return readBits(i.conn, n)
+	}
+	bs, _ := bitstring.BitStringFromBytes(&bytes)
+	return bs.Substring(0, n)
+}
+
+// Closes the underlying connection
+func (i *SocketInput) Close() error {
+	return i.conn.Close()
+}
+
+// Input reading from the operating system's CSPRNG (crypto/rand.Reader)
+type OSRandomInput struct {
+	ReaderInput
+}
+
+func NewOSRandomInput() *OSRandomInput {
+	return &OSRandomInput{ReaderInput{rand.Reader}}
+}
+
+// The operating system's CSPRNG is trusted to provide full entropy output
+func (i *OSRandomInput) EntropyBound(n int) EntropyBound {
+	return rateBound(1, n)
+}
@@ -0,0 +1,86 @@
+package random
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+// Writes [data] to a temporary file, returning its path
+func tempFile(t *testing.T, data []byte) string {
+	dir, err := ioutil.TempDir("", "random")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.Join(dir, "input")
+	if err := ioutil.WriteFile(p, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFileInput(t *testing.T) {
+	p := tempFile(t, []byte{0xF0, 0x0F})
+	defer os.RemoveAll(path.Dir(p))
+
+	i := NewFileInput(p, EOFFail)
+	if got := i.GetBits(4).String(); got != "1111" {
+		t.Errorf("FileInput.GetBits(4) == %s, wanted 1111", got)
+	}
+	if got := i.GetBits(8).String(); got != "00001111" {
+		t.Errorf("FileInput.GetBits(8) == %s, wanted 00001111", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("FileInput.GetBits past EOF with EOFFail did not panic")
+		}
+	}()
+	i.GetBits(1)
+}
+
+func TestFileInputRewind(t *testing.T) {
+	p := tempFile(t, []byte{0xAA})
+	defer os.RemoveAll(path.Dir(p))
+
+	i := NewFileInput(p, EOFRewind)
+	for j := 0; j < 4; j++ {
+		if got := i.GetBits(16).String(); got != "1010101010101010" {
+			t.Errorf("FileInput.GetBits(16) with EOFRewind == %s, wanted 1010101010101010", got)
+		}
+	}
+}
+
+func TestSocketInput(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte{0x81})
+		conn.Close()
+	}()
+
+	i := NewSocketInput("tcp", l.Addr().String())
+	defer i.Close()
+	if got := i.GetBits(8).String(); got != "10000001" {
+		t.Errorf("SocketInput.GetBits(8) == %s, wanted 10000001", got)
+	}
+}
+
+func TestOSRandomInput(t *testing.T) {
+	i := NewOSRandomInput()
+	if bs := i.GetBits(100); bs.Length != 100 {
+		t.Errorf("OSRandomInput.GetBits(100) contained %d bits", bs.Length)
+	}
+	r := NewGeneratorFromConfig("osrandom")
+	if bs := r.GetBits(64); bs.Length != 64 {
+		t.Errorf("NewGeneratorFromConfig(osrandom).GetBits(64) contained %d bits", bs.Length)
+	}
+}
@@ -0,0 +1,82 @@
+package random
+
+import (
+	"github.com/adamhosier/random/src/bitstring"
+	"math"
+	"sync"
+)
+
+const (
+	defaultChunkBits = 1 << 16 // Bits read from the source at a time by StreamCheck
+	streamBuffer     = 2       // Chunks queued for each accumulator before StreamCheck waits on the slowest
+)
+
+// A statistical test run in a single pass over a sequence given in consecutive chunks of any length. Finalize is
+// called once, after the last chunk, and gives the same results as the test over the whole sequence
+type Accumulator interface {
+	Update(chunk *bitstring.BitString)
+	Finalize() []TestResult
+}
+
+// Runs the accumulator [a] over the whole of [bs]
+func accumulate(a Accumulator, bs *bitstring.BitString) []TestResult {
+	a.Update(bs)
+	return a.Finalize()
+}
+
+// Options of StreamCheck, zero values are replaced by defaults
+type StreamOptions struct {
+	CheckOptions
+	ChunkBits int // Bits read from the source at a time, defaultChunkBits if zero
+}
+
+// Runs the checks of CheckRandom over [n] bits read from [source] in chunks, returning the same results as CheckRandom
+// over those bits. Every test consumes each chunk concurrently, and chunks are read only as fast as the slowest test
+// consumes them, so memory use is bounded by a few chunks rather than [n]. The discrete Fourier transform test only
+// transforms the first 2^20 bits. Panics if [options] names an unknown test or a significance level outside (0, 1)
+func StreamCheck(source Extractable, n int, options StreamOptions) (bool, []TestResult) {
+	alpha, selected := selectChecks("StreamCheck", options.CheckOptions)
+	chunkBits := options.ChunkBits
+	if chunkBits == 0 {
+		chunkBits = defaultChunkBits
+	}
+	if chunkBits < 0 {
+		panic("StreamCheck: chunk size must be positive")
+	}
+
+	// Start a goroutine for each test, consuming chunks until its channel is closed
+	results := make([][]TestResult, len(selected))
+	chunks := make([]chan *bitstring.BitString, len(selected))
+	var wg sync.WaitGroup
+	for i, c := range selected {
+		chunks[i] = make(chan *bitstring.BitString, streamBuffer)
+		wg.Add(1)
+		go func(i int, a Accumulator) {
+			defer wg.Done()
+			for chunk := range chunks[i] {
+				a.Update(chunk)
+			}
+			results[i] = a.Finalize()
+		}(i, c.new(n))
+	}
+
+	// Share each chunk between the tests, which only read it
+	for read := 0; read < n; read += chunkBits {
+		chunk := source.GetBits(int(math.Min(float64(chunkBits), float64(n-read))))
+		for _, ch := range chunks {
+			ch <- chunk
+		}
+	}
+	for _, ch := range chunks {
+		close(ch)
+	}
+	wg.Wait()
+
+	overallResult := true
+	var all []TestResult
+	for i, c := range selected {
+		overallResult = judge(c, results[i], alpha) && overallResult
+		all = append(all, results[i]...)
+	}
+	return overallResult, all
+}
@@ -0,0 +1,48 @@
+package random
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamCheck(t *testing.T) {
+	// Chunks of 33 words end part way through the blocks of every test, and the last chunk is shorter
+	n := 300000
+	wantPassed, want := CheckRandom(NewPseudoRandomExtractor(7).GetBits(n), CheckOptions{})
+	passed, got := StreamCheck(NewPseudoRandomExtractor(7), n, StreamOptions{ChunkBits: 33 * 32})
+	if passed != wantPassed || !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamCheck == %t, %+v, want %t, %+v", passed, got, wantPassed, want)
+	}
+
+	_, got = StreamCheck(NewPseudoRandomExtractor(7), n, StreamOptions{CheckOptions: CheckOptions{
+		Significance: 0.05, Tests: []string{"runs", "serial"}}})
+	if len(got) != 2 || got[0].Name != "Consecutive Runs" || got[1].Name != "Serial" || got[1].Significance != 0.05 {
+		t.Errorf("StreamCheck gave %+v, want the runs and serial tests at significance 0.05", got)
+	}
+}
+
+func TestBlockCounter(t *testing.T) {
+	// Counting over chunks matches counting with wrap around over the whole sequence
+	bs := NewPseudoRandomExtractor(3).GetBits(320)
+	c := newBlockCounter(5, 4, 0)
+	for i := 0; i < bs.Length; i += 64 {
+		c.update(bs.Substring(i, 64))
+	}
+	counts := c.finish()
+	for k, m := range []int{5, 4, 0} {
+		want := make([]int, 1<<uint(m))
+		for i := 0; i < bs.Length; i++ {
+			v := 0
+			for j := 0; j < m; j++ {
+				v <<= 1
+				if bs.Data[(i+j)%bs.Length] {
+					v |= 1
+				}
+			}
+			want[v]++
+		}
+		if !reflect.DeepEqual(counts[k], want) {
+			t.Errorf("blockCounter counts of length %d == %v, want %v", m, counts[k], want)
+		}
+	}
+}
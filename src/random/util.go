@@ -3,6 +3,7 @@ package random
 import (
 	"github.com/adamhosier/random/src/bitstring"
 	"math"
+	"math/cmplx"
 )
 
 const (
@@ -96,6 +97,152 @@ func stdNormal(x float64) float64 {
 	return 0.5 * (math.Erfc(-x / math.Sqrt2))
 }
 
+// Computes the discrete Fourier transform of [x] with a radix-2 FFT, using Bluestein's algorithm to express
+// transforms of other lengths as a convolution of power of two length
+func dft(x []complex128) []complex128 {
+	n := len(x)
+	if n&(n-1) == 0 {
+		out := make([]complex128, n)
+		copy(out, x)
+		fft(out, false)
+		return out
+	}
+
+	// Chirp w[k] = exp(-πik²/n), reducing k² mod 2n to keep the angle accurate
+	w := make([]complex128, n)
+	for k := range w {
+		w[k] = cmplx.Rect(1, -math.Pi*float64((k*k)%(2*n))/float64(n))
+	}
+
+	// Convolve x*w with the conjugate chirp
+	m := 1
+	for m < 2*n-1 {
+		m <<= 1
+	}
+	a := make([]complex128, m)
+	b := make([]complex128, m)
+	for k := 0; k < n; k++ {
+		a[k] = x[k] * w[k]
+		b[k] = cmplx.Conj(w[k])
+		if k > 0 {
+			b[m-k] = b[k]
+		}
+	}
+	fft(a, false)
+	fft(b, false)
+	for i := range a {
+		a[i] *= b[i]
+	}
+	fft(a, true)
+
+	out := make([]complex128, n)
+	for k := range out {
+		out[k] = a[k] * w[k] / complex(float64(m), 0)
+	}
+	return out
+}
+
+// In place iterative radix-2 FFT, where the length of [x] must be a power of two. The inverse is unnormalised
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+
+	// Bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	// Butterflies, computing each stage's twiddle factors directly to avoid accumulating error
+	for size := 2; size <= n; size <<= 1 {
+		angle := -2 * math.Pi / float64(size)
+		if inverse {
+			angle = -angle
+		}
+		twiddles := make([]complex128, size/2)
+		for k := range twiddles {
+			twiddles[k] = cmplx.Rect(1, angle*float64(k))
+		}
+		for start := 0; start < n; start += size {
+			for k, t := range twiddles {
+				u := x[start+k]
+				v := x[start+k+size/2] * t
+				x[start+k] = u + v
+				x[start+k+size/2] = u - v
+			}
+		}
+	}
+}
+
+// Finds the rank over GF(2) of the matrix made up of [rows] by Gaussian elimination, modifying the rows
+func binaryRank(rows [][]bool) int {
+	rank := 0
+	for c := 0; c < len(rows[0]) && rank < len(rows); c++ {
+		// Find a pivot in this column
+		pivot := -1
+		for r := rank; r < len(rows); r++ {
+			if rows[r][c] {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[rank], rows[pivot] = rows[pivot], rows[rank]
+
+		// Eliminate this column from every other row
+		for r := range rows {
+			if r != rank && rows[r][c] {
+				for j := c; j < len(rows[r]); j++ {
+					rows[r][j] = rows[r][j] != rows[rank][j]
+				}
+			}
+		}
+		rank++
+	}
+	return rank
+}
+
+// Finds the length of the shortest LFSR generating [s] using the Berlekamp-Massey algorithm
+func linearComplexity(s []bool) int {
+	n := len(s)
+	c := make([]bool, n+1) // Current connection polynomial
+	b := make([]bool, n+1) // Connection polynomial before the last length change
+	c[0], b[0] = true, true
+	l, m := 0, -1
+	for i := 0; i < n; i++ {
+		// Discrepancy between the next bit and the LFSR's prediction
+		d := s[i]
+		for j := 1; j <= l; j++ {
+			if c[j] && s[i-j] {
+				d = !d
+			}
+		}
+		if !d {
+			continue
+		}
+		t := make([]bool, n+1)
+		copy(t, c)
+		for j := 0; j+i-m <= n; j++ {
+			if b[j] {
+				c[j+i-m] = !c[j+i-m]
+			}
+		}
+		if l <= i/2 {
+			l = i + 1 - l
+			m = i
+			b = t
+		}
+	}
+	return l
+}
+
 // Mock input structure for testing
 type MockInput struct {
 	MockGetBits func(int) *bitstring.BitString